@@ -24,56 +24,89 @@ typedef long long __s64;
 #ifndef ETH_P_IP
 #define ETH_P_IP 0x0800
 #endif
+#ifndef ETH_P_IPV6
+#define ETH_P_IPV6 0x86DD
+#endif
 #ifndef IPPROTO_UDP
 #define IPPROTO_UDP 17
 #endif
-#ifndef TC_ACT_OK
-#define TC_ACT_OK 0
+// 소비하지 않은 트래픽은 TC_ACT_UNSPEC(= TCX_NEXT)로 돌려준다. TC_ACT_OK(= TCX_PASS)는
+// tcx 체인과 direct-action cls_bpf 필터 목록을 거기서 끝내므로 뒤에 붙은 프로그램(Cilium 등)이 돌지 않는다.
+#ifndef TC_ACT_UNSPEC
+#define TC_ACT_UNSPEC (-1)
 #endif
 #ifndef TC_ACT_SHOT
 #define TC_ACT_SHOT 2
 #endif
+#ifndef offsetof
+#define offsetof(type, member) __builtin_offsetof(type, member)
+#endif
 
 // ------- 프로토콜 고정형 토픽 헤더 -------
+// 와이어 포맷이므로 모든 필드는 NBO (pkg/proto.TopicHdr, publisher/broker/subscriber와 같다).
+// 맵 키와 이벤트의 topic_id는 host order로 바꿔 쓴다.
 struct topic_hdr {
-  __u32 topic_id;  // host order
-  __u16 flags;     // reserved
-  __u16 hop;       // 0:소스, 1:노드, >=2:패스스루
+  __u32 topic_id;  // NBO
+  __u16 flags;     // NBO, reserved
+  __u16 hop;       // NBO, 0:소스, 1:노드, >=2:패스스루
 } __attribute__((packed));
 
 // ------- map value 구조 -------
+// 주소는 IPv4/IPv6 공용 16바이트, family는 IP 버전(4|6). IPv4는 daddr[0]만 쓴다.
+// 패킷과 family가 다른 목적지는 헤더를 바꿀 수 없으므로 건너뛴다(DR_FAMILY).
 struct node_dest {
   __u32 node_id;
-  __u32 daddr;  // NBO
-  __u16 dport;  // NBO
-  __u16 _pad;
+  __u32 daddr[4];  // NBO
+  __u16 dport;     // NBO
+  __u8 family;     // 4 | 6
+  __u8 flags;      // ND_F_*
 };
 
+// direct 토픽: 목적지가 노드가 아니라 구독자 Pod다. hop을 2로 보내 받는 노드가 2차 fan-out 없이 통과시킨다.
+#define ND_F_DIRECT 1
+
 struct sub_dest {
-  __u32 ifindex;  // 0이면 cfg.local_route_ifindex 사용
-  __u32 daddr;    // NBO
-  __u16 dport;    // NBO
-  __u16 _pad;
+  __u32 ifindex;   // 0이면 cfg.local_route_ifindex 사용
+  __u32 daddr[4];  // NBO
+  __u16 dport;     // NBO
+  __u8 family;     // 4 | 6
+  __u8 _pad;
 };
 
-// 런타임 설정 (키=0 고정)
+// 2차(노드 로컬) fan-out 키: 같은 노드라도 토픽별로 구독자 집합이 다르다
+struct local_key {
+  __u32 node_id;
+  __u32 topic_id;
+};
+
+// 런타임 설정 (키=0 고정). 필드 소유권/갱신 규약은 pkg/maps/config.go
 struct cfg_rec {
   __u32 egress_ifindex;       // 1차 복제 출력 ifindex(소스)
   __u32 local_route_ifindex;  // 2차 복제 기본 ifindex(노드)
   __u32 local_node_id;        // 현재 노드 ID
-  __u32 active_gen;           // 0 또는 1 (세대 플립)
+  __u32 active_gen;           // 0 또는 1 (세대 플립). 활성 세대의 유일한 원천
+  __u32 sample_rate;          // m_ring 이벤트 1/N 샘플링 (0이면 끔)
+  // psbench 트래픽 필터 (host order). UDP dport가 tier1_port이거나
+  // [tier2_port_min, tier2_port_max] 안이어야 토픽 메시지로 본다. 둘 다 0이면 모든 UDP.
+  __u16 tier1_port;      // 1차(노드) 수신 포트
+  __u16 tier2_port_min;  // 2차(구독자) 포트 범위
+  __u16 tier2_port_max;
+  __u16 hdr_magic;       // (topic_hdr.flags & hdr_magic_mask) == hdr_magic 이어야 한다
+  __u16 hdr_magic_mask;  // 0이면 헤더 검사 안 함
+  __u16 _pad;
 };
 
 // 드롭/계측
 enum drop_reason {
   DR_OK = 0,
-  DR_NOT_UDP,
+  DR_NOT_UDP,  // 더 이상 세지 않는다 (IP/UDP가 아닌 프레임은 metrics.skipped). 라벨/인덱스 호환용
   DR_TOO_SHORT,
   DR_NO_TOPIC,
   DR_NO_NODESET,
   DR_NO_LOCALSET,
   DR_CLONE_FAIL,
   DR_HELPER_ERR,
+  DR_FAMILY,  // 목적지 family != 패킷 family (토픽 family 설정 오류)
   DR_MAX
 };
 
@@ -81,6 +114,17 @@ struct metrics {
   __u64 tier1_clones;
   __u64 tier2_clones;
   __u64 drops[DR_MAX];
+  __u64 skipped;  // psbench가 아닌 트래픽(비IP, 비UDP, 필터에 안 맞는 UDP). 드롭이 아니므로 drops와 따로 센다
+};
+
+// m_ring 샘플 이벤트 (패킷당 최대 1건)
+struct pkt_event {
+  __u64 ktime_ns;
+  __u32 topic_id;
+  __u16 hop;          // 수신 시점 hop
+  __u16 fanout;       // hop0: 노드 수, hop1: 로컬 구독자 수
+  __u32 drop_reason;  // DR_OK 또는 마지막으로 발생한 drop_reason
+  __u32 _pad;
 };
 
 // 상수 바운드 (검증기 우선)
@@ -88,8 +132,12 @@ struct metrics {
 #define MAX_NODES 256
 #define MAX_FANOUT 256
 #define MAX_LOCAL_SUB 512
+#define MAX_LOCAL_SETS 16384  // (node, topic) 쌍 수
 #define RINGBUF_SZ (1 << 20)
 
 // 계측 헬퍼 선언(정의는 .c)
 static __always_inline void count_drop(__u32 idx, __u32 reason);
 static __always_inline void count_clone(__u32 tier);
+static __always_inline void count_skip(void);
+static __always_inline void emit_event(struct cfg_rec *cfg, __u32 topic_id,
+                                       __u16 hop, __u32 fanout, __u32 reason);
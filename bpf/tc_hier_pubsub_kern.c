@@ -3,38 +3,36 @@
 
 // -------------------------- BPF MAPS --------------------------
 
-// 1) 내부 템플릿(반드시 .maps 섹션에서 앞에 위치)
-//    - topic->node_set 의 inner array (node_dest)
-struct {
+// 1) inner array 타입 (map-in-map 값). 실제 inner 맵은 사용자 공간이 세대마다 만들어 끼운다.
+//    - topic->node_set (node_dest)
+struct inner_node_set {
   __uint(type, BPF_MAP_TYPE_ARRAY);
   __uint(max_entries, MAX_FANOUT);
   __type(key, __u32);
   __type(value, struct node_dest);
-} inner_node_set_tmpl SEC(".maps");
+};
 
-//    - node_id->local_sub 의 inner array (sub_dest)
-struct {
+//    - (node_id, topic_id)->local_sub (sub_dest)
+struct inner_local_sub {
   __uint(type, BPF_MAP_TYPE_ARRAY);
   __uint(max_entries, MAX_LOCAL_SUB);
   __type(key, __u32);
   __type(value, struct sub_dest);
-} inner_local_sub_tmpl SEC(".maps");
+};
 
 // 2) topic -> node_set (gen0/gen1), ARRAY_OF_MAPS
 struct {
   __uint(type, BPF_MAP_TYPE_ARRAY_OF_MAPS);
   __uint(max_entries, MAX_TOPICS);
   __type(key, __u32);
-  __type(value, __u32);      // inner map fd slot
-  __uint(inner_map_idx, 0);  // inner_node_set_tmpl
+  __array(values, struct inner_node_set);
 } topic_to_node_set_gen0 SEC(".maps");
 
 struct {
   __uint(type, BPF_MAP_TYPE_ARRAY_OF_MAPS);
   __uint(max_entries, MAX_TOPICS);
   __type(key, __u32);
-  __type(value, __u32);
-  __uint(inner_map_idx, 0);  // inner_node_set_tmpl
+  __array(values, struct inner_node_set);
 } topic_to_node_set_gen1 SEC(".maps");
 
 // 3) topic fanout count (gen0/gen1)
@@ -52,35 +50,33 @@ struct {
   __type(value, __u32);
 } topic_fanout_cnt_gen1 SEC(".maps");
 
-// 4) node_id -> local_sub (gen0/gen1), ARRAY_OF_MAPS
+// 4) (node_id, topic_id) -> local_sub (gen0/gen1), HASH_OF_MAPS
 struct {
-  __uint(type, BPF_MAP_TYPE_ARRAY_OF_MAPS);
-  __uint(max_entries, MAX_NODES);
-  __type(key, __u32);
-  __type(value, __u32);
-  __uint(inner_map_idx, 1);  // inner_local_sub_tmpl
+  __uint(type, BPF_MAP_TYPE_HASH_OF_MAPS);
+  __uint(max_entries, MAX_LOCAL_SETS);
+  __type(key, struct local_key);
+  __array(values, struct inner_local_sub);
 } node_to_local_sub_gen0 SEC(".maps");
 
 struct {
-  __uint(type, BPF_MAP_TYPE_ARRAY_OF_MAPS);
-  __uint(max_entries, MAX_NODES);
-  __type(key, __u32);
-  __type(value, __u32);
-  __uint(inner_map_idx, 1);  // inner_local_sub_tmpl
+  __uint(type, BPF_MAP_TYPE_HASH_OF_MAPS);
+  __uint(max_entries, MAX_LOCAL_SETS);
+  __type(key, struct local_key);
+  __array(values, struct inner_local_sub);
 } node_to_local_sub_gen1 SEC(".maps");
 
-// 5) local_sub count (gen0/gen1)
+// 5) local_sub count (gen0/gen1), (node_id, topic_id) 키
 struct {
-  __uint(type, BPF_MAP_TYPE_ARRAY);
-  __uint(max_entries, MAX_NODES);
-  __type(key, __u32);
+  __uint(type, BPF_MAP_TYPE_HASH);
+  __uint(max_entries, MAX_LOCAL_SETS);
+  __type(key, struct local_key);
   __type(value, __u32);
 } node_local_cnt_gen0 SEC(".maps");
 
 struct {
-  __uint(type, BPF_MAP_TYPE_ARRAY);
-  __uint(max_entries, MAX_NODES);
-  __type(key, __u32);
+  __uint(type, BPF_MAP_TYPE_HASH);
+  __uint(max_entries, MAX_LOCAL_SETS);
+  __type(key, struct local_key);
   __type(value, __u32);
 } node_local_cnt_gen1 SEC(".maps");
 
@@ -100,7 +96,7 @@ struct {
   __type(value, struct metrics);
 } m_metrics SEC(".maps");
 
-// 8) ringbuf (옵션)
+// 8) ringbuf: 샘플 이벤트 (cfg.sample_rate)
 struct {
   __uint(type, BPF_MAP_TYPE_RINGBUF);
   __uint(max_entries, RINGBUF_SZ);
@@ -125,66 +121,188 @@ static __always_inline void count_clone(__u32 tier) {
     __sync_fetch_and_add(&m->tier2_clones, 1);
 }
 
-static __always_inline int parse_headers(
-    struct __sk_buff *skb, void **data_p, void **data_end_p,
-    struct ethhdr **eth_p, struct iphdr **ip_p, struct udphdr **udp_p,
-    struct topic_hdr **th_p, __u32 *l3_off_p, __u32 *l4_off_p) {
+static __always_inline void count_skip(void) {
+  __u32 zero = 0;
+  struct metrics *m = bpf_map_lookup_elem(&m_metrics, &zero);
+  if (!m) return;
+  __sync_fetch_and_add(&m->skipped, 1);
+}
+
+static __always_inline void emit_event(struct cfg_rec *cfg, __u32 topic_id,
+                                       __u16 hop, __u32 fanout, __u32 reason) {
+  __u32 rate = cfg->sample_rate;
+  if (!rate) return;
+  if (rate > 1 && bpf_get_prandom_u32() % rate) return;
+  // 예약 실패(버퍼 가득)는 샘플 유실일 뿐 패킷 드롭이 아니므로 계측하지 않는다
+  struct pkt_event *e = bpf_ringbuf_reserve(&m_ring, sizeof(*e), 0);
+  if (!e) return;
+  e->ktime_ns = bpf_ktime_get_ns();
+  e->topic_id = topic_id;
+  e->hop = hop;
+  e->fanout = fanout;
+  e->drop_reason = reason;
+  e->_pad = 0;
+  bpf_ringbuf_submit(e, 0);
+}
+
+// 파싱 결과. csum_replace/clone_redirect 헬퍼가 패킷 포인터를 무효로 만들므로 재작성은 오프셋으로만 한다.
+struct pkt_info {
+  __u32 l3_off;
+  __u32 l4_off;
+  __u8 family;    // 4 | 6
+  __u8 udp_csum;  // UDP 체크섬 사용 여부 (0이면 미사용)
+};
+
+// parse_headers 반환값: psbench 트래픽이 아님 (drop_reason과 겹치지 않는다)
+#define PARSE_FOREIGN -1
+
+// cfg의 포트 필터. 포트가 하나도 설정되지 않았으면 모든 UDP를 받는다.
+static __always_inline int port_match(const struct cfg_rec *cfg, __u16 dport) {
+  if (!cfg->tier1_port && !cfg->tier2_port_max) return 1;
+  if (dport == cfg->tier1_port) return 1;
+  return cfg->tier2_port_max && dport >= cfg->tier2_port_min &&
+         dport <= cfg->tier2_port_max;
+}
+
+// eth + IPv4/IPv6 + UDP + topic_hdr. IPv6 확장 헤더는 따라가지 않는다(UDP가 바로 오는 패킷만).
+// 포트는 토픽 헤더보다 먼저 본다: 다른 UDP(DNS 등)는 짧아도 too_short가 아니라 PARSE_FOREIGN.
+// 반환: DR_OK, DR_TOO_SHORT(헤더가 잘린 프레임),
+//       PARSE_FOREIGN(IP/UDP가 아님, 포트 또는 헤더 매직 불일치)
+static __always_inline int parse_headers(struct __sk_buff *skb,
+                                         const struct cfg_rec *cfg,
+                                         struct pkt_info *pi,
+                                         struct topic_hdr **th_p) {
   // data/data_end
   void *data = (void *)(long)skb->data;
   void *data_end = (void *)(long)skb->data_end;
 
   // 이더넷 최소 길이 보장
   if ((void *)((struct ethhdr *)data + 1) > data_end) {
-    if (bpf_skb_pull_data(skb, 14)) return -1;
+    if (bpf_skb_pull_data(skb, 14)) return DR_TOO_SHORT;
     data = (void *)(long)skb->data;
     data_end = (void *)(long)skb->data_end;
-    if ((void *)((struct ethhdr *)data + 1) > data_end) return -1;
+    if ((void *)((struct ethhdr *)data + 1) > data_end) return DR_TOO_SHORT;
   }
 
   struct ethhdr *eth = data;
   __u16 h_proto = bpf_ntohs(eth->h_proto);
-  if (h_proto != ETH_P_IP) return -1;
+  __u32 l3_off = 14, l4_off;
+
+  if (h_proto == ETH_P_IP) {
+    if (data + l3_off + sizeof(struct iphdr) > data_end) {
+      if (bpf_skb_pull_data(skb, l3_off + sizeof(struct iphdr)))
+        return DR_TOO_SHORT;
+      data = (void *)(long)skb->data;
+      data_end = (void *)(long)skb->data_end;
+      if (data + l3_off + sizeof(struct iphdr) > data_end) return DR_TOO_SHORT;
+    }
+    struct iphdr *ip = (void *)(data + l3_off);
+    if (ip->protocol != IPPROTO_UDP) return PARSE_FOREIGN;
+    __u32 ihl = ip->ihl * 4;
+    if (ihl < sizeof(*ip)) return DR_TOO_SHORT;
+    l4_off = l3_off + ihl;
+    pi->family = 4;
+  } else if (h_proto == ETH_P_IPV6) {
+    if (data + l3_off + sizeof(struct ipv6hdr) > data_end) {
+      if (bpf_skb_pull_data(skb, l3_off + sizeof(struct ipv6hdr)))
+        return DR_TOO_SHORT;
+      data = (void *)(long)skb->data;
+      data_end = (void *)(long)skb->data_end;
+      if (data + l3_off + sizeof(struct ipv6hdr) > data_end)
+        return DR_TOO_SHORT;
+    }
+    struct ipv6hdr *ip6 = (void *)(data + l3_off);
+    if (ip6->nexthdr != IPPROTO_UDP) return PARSE_FOREIGN;
+    l4_off = l3_off + sizeof(*ip6);
+    pi->family = 6;
+  } else {
+    return PARSE_FOREIGN;  // ARP 등 IP가 아닌 프레임
+  }
 
-  // IPv4
-  __u32 l3_off = 14;
-  if (data + l3_off + sizeof(struct iphdr) > data_end) {
-    if (bpf_skb_pull_data(skb, l3_off + sizeof(struct iphdr))) return -1;
+  // UDP
+  __u32 need = l4_off + sizeof(struct udphdr);
+  if (data + need > data_end) {
+    if (bpf_skb_pull_data(skb, need)) return DR_TOO_SHORT;
     data = (void *)(long)skb->data;
     data_end = (void *)(long)skb->data_end;
-    eth = data;
-    if (data + l3_off + sizeof(struct iphdr) > data_end) return -1;
+    if (data + need > data_end) return DR_TOO_SHORT;
   }
-  struct iphdr *ip = (void *)(data + l3_off);
-  if (ip->protocol != IPPROTO_UDP) return -1;
-  __u32 ihl = ip->ihl * 4;
-  if (ihl < sizeof(*ip)) return -1;
+  struct udphdr *udp = (void *)(data + l4_off);
+  if (!port_match(cfg, bpf_ntohs(udp->dest))) return PARSE_FOREIGN;
 
-  // UDP
-  __u32 l4_off = l3_off + ihl;
-  if (data + l4_off + sizeof(struct udphdr) > data_end) {
-    if (bpf_skb_pull_data(skb, l4_off + sizeof(struct udphdr))) return -1;
+  // topic header (8B)
+  need += sizeof(struct topic_hdr);
+  if (data + need > data_end) {
+    if (bpf_skb_pull_data(skb, need)) return DR_TOO_SHORT;
     data = (void *)(long)skb->data;
     data_end = (void *)(long)skb->data_end;
-    eth = data;
-    ip = (void *)(data + l3_off);
-    if (data + l4_off + sizeof(struct udphdr) > data_end) return -1;
+    if (data + need > data_end) return DR_TOO_SHORT;
   }
-  struct udphdr *udp = (void *)(data + l4_off);
+  udp = (void *)(data + l4_off);
+  struct topic_hdr *th = (void *)(udp + 1);
+  if ((bpf_ntohs(th->flags) & cfg->hdr_magic_mask) != cfg->hdr_magic)
+    return PARSE_FOREIGN;
+
+  pi->l3_off = l3_off;
+  pi->l4_off = l4_off;
+  pi->udp_csum = udp->check != 0;
+  *th_p = th;
+  return DR_OK;
+}
 
-  // topic header (8B) 존재 확인
-  if (data + l4_off + sizeof(*udp) + sizeof(struct topic_hdr) > data_end)
+// hop 갱신 (old/hop은 host order). topic_hdr는 UDP 페이로드이므로 체크섬도 고친다.
+static __always_inline int set_hop(struct __sk_buff *skb,
+                                   const struct pkt_info *pi, __u16 old,
+                                   __u16 hop) {
+  __u32 csum_off = pi->l4_off + offsetof(struct udphdr, check);
+  __u32 off =
+      pi->l4_off + sizeof(struct udphdr) + offsetof(struct topic_hdr, hop);
+  __u16 old_nbo = bpf_htons(old), hop_nbo = bpf_htons(hop);
+  if (pi->udp_csum && bpf_l4_csum_replace(skb, csum_off, old_nbo, hop_nbo,
+                                          BPF_F_MARK_MANGLED_0 | 2))
     return -1;
-  struct topic_hdr *th = (void *)(data + l4_off + sizeof(*udp));
+  return bpf_skb_store_bytes(skb, off, &hop_nbo, sizeof(hop_nbo), 0) ? -1 : 0;
+}
 
-  *data_p = data;
-  *data_end_p = data_end;
-  *eth_p = eth;
-  *ip_p = ip;
-  *udp_p = udp;
-  *th_p = th;
-  *l3_off_p = l3_off;
-  *l4_off_p = l4_off;
-  return 0;
+// 목적지 주소/포트 재작성. IPv4는 IP 헤더와 UDP 의사 헤더 체크섬을,
+// IPv6는 (IP 헤더 체크섬이 없으므로) UDP 의사 헤더만 4바이트씩 고친다.
+static __always_inline int rewrite_dest(struct __sk_buff *skb,
+                                        const struct pkt_info *pi,
+                                        const __u32 *daddr, __u16 dport) {
+  __u32 csum_off = pi->l4_off + offsetof(struct udphdr, check);
+  __u64 pseudo = BPF_F_PSEUDO_HDR | BPF_F_MARK_MANGLED_0 | 4;
+
+  if (pi->family == 4) {
+    __u32 off = pi->l3_off + offsetof(struct iphdr, daddr);
+    __u32 old;
+    if (bpf_skb_load_bytes(skb, off, &old, 4)) return -1;
+    if (bpf_l3_csum_replace(skb, pi->l3_off + offsetof(struct iphdr, check),
+                            old, daddr[0], 4))
+      return -1;
+    if (pi->udp_csum &&
+        bpf_l4_csum_replace(skb, csum_off, old, daddr[0], pseudo))
+      return -1;
+    if (bpf_skb_store_bytes(skb, off, daddr, 4, 0)) return -1;
+  } else {
+    __u32 off = pi->l3_off + offsetof(struct ipv6hdr, daddr);
+    __u32 old[4];
+    if (bpf_skb_load_bytes(skb, off, old, sizeof(old))) return -1;
+    if (pi->udp_csum) {
+#pragma unroll
+      for (int w = 0; w < 4; w++)
+        if (bpf_l4_csum_replace(skb, csum_off, old[w], daddr[w], pseudo))
+          return -1;
+    }
+    if (bpf_skb_store_bytes(skb, off, daddr, 16, 0)) return -1;
+  }
+
+  __u32 port_off = pi->l4_off + offsetof(struct udphdr, dest);
+  __u16 old_port;
+  if (bpf_skb_load_bytes(skb, port_off, &old_port, 2)) return -1;
+  if (pi->udp_csum && bpf_l4_csum_replace(skb, csum_off, old_port, dport,
+                                          BPF_F_MARK_MANGLED_0 | 2))
+    return -1;
+  return bpf_skb_store_bytes(skb, port_off, &dport, 2, 0) ? -1 : 0;
 }
 
 // --------------------------- MAIN -----------------------------
@@ -194,27 +312,23 @@ int tc_hier_pubsub(struct __sk_buff *skb) {
   // 설정 읽기
   __u32 zero = 0;
   struct cfg_rec *cfg = bpf_map_lookup_elem(&m_cfg, &zero);
-  if (!cfg) return TC_ACT_OK;
+  if (!cfg) return TC_ACT_UNSPEC;
 
-  void *data, *data_end;
-  struct ethhdr *eth;
-  struct iphdr *ip;
-  struct udphdr *udp;
+  struct pkt_info pi = {};
   struct topic_hdr *th;
-  __u32 l3_off = 0, l4_off = 0;
 
-  if (parse_headers(skb, &data, &data_end, &eth, &ip, &udp, &th, &l3_off,
-                    &l4_off) < 0) {
-    count_drop(0, DR_NOT_UDP);
-    return TC_ACT_OK;
+  int pr = parse_headers(skb, cfg, &pi, &th);
+  if (pr == PARSE_FOREIGN) {
+    count_skip();
+    return TC_ACT_UNSPEC;
+  }
+  if (pr != DR_OK) {
+    count_drop(0, pr);
+    return TC_ACT_UNSPEC;
   }
 
-  // 체크섬 오프셋 (IPv4)
-  __u32 l3_csum_off = l3_off + 10;  // offsetof(struct iphdr, check)
-  __u32 l4_csum_off = l4_off + 6;   // offsetof(struct udphdr, check)
-
-  __u32 topic_id = th->topic_id;
-  __u16 hop = th->hop;
+  __u32 topic_id = bpf_ntohl(th->topic_id);
+  __u16 hop = bpf_ntohs(th->hop);
 
   // 활성 세대 선택
   __u32 gen = cfg->active_gen ? 1 : 0;
@@ -232,96 +346,130 @@ int tc_hier_pubsub(struct __sk_buff *skb) {
     void *inner = bpf_map_lookup_elem(topic2nodes, &topic_id);
     if (!inner) {
       count_drop(0, DR_NO_NODESET);
-      return TC_ACT_OK;
+      emit_event(cfg, topic_id, hop, 0, DR_NO_NODESET);
+      return TC_ACT_UNSPEC;
     }
     __u32 *fanoutp = bpf_map_lookup_elem(topic_cnt, &topic_id);
     __u32 fanout = fanoutp ? *fanoutp : 0;
     if (fanout == 0) {
       count_drop(0, DR_NO_NODESET);
-      return TC_ACT_OK;
+      emit_event(cfg, topic_id, hop, 0, DR_NO_NODESET);
+      return TC_ACT_UNSPEC;
     }
+    __u32 reason = DR_OK;
 
     // hop 증가 (원본 skb가 마지막 dest에 남는다)
-    th->hop = hop + 1;
+    if (set_hop(skb, &pi, hop, hop + 1)) {
+      count_drop(0, DR_HELPER_ERR);
+      return TC_ACT_UNSPEC;
+    }
 
+    // dup: 원본이 이미 clone으로 보낸 목적지를 담고 있다 (마지막 목적지를 건너뛴 경우)
+    int dup = 0;
+    __u16 cur_hop = hop + 1;
 #pragma clang loop unroll(disable)
     for (__u32 i = 0; i < MAX_FANOUT; i++) {
       if (i >= fanout) break;
       struct node_dest *nd = bpf_map_lookup_elem(inner, &i);
       if (!nd) continue;
-
-      __u32 daddr = nd->daddr;  // NBO
-      __u16 dport = nd->dport;  // NBO
-
-      // 체크섬 업데이트 + 필드 변경
-      bpf_l3_csum_replace(skb, l3_csum_off, ip->daddr, daddr, sizeof(daddr));
-      ip->daddr = daddr;
-
-      if (udp->check)  // IPv4에서 0이면 미사용
-        bpf_l4_csum_replace(skb, l4_csum_off, udp->dest, dport, sizeof(dport));
-      udp->dest = dport;
+      if (nd->family != pi.family) {
+        count_drop(0, DR_FAMILY);
+        reason = DR_FAMILY;
+        continue;
+      }
+      // Pod로 바로 가는 목적지는 hop=2 (받는 노드에서 패스스루)
+      __u16 want_hop = (nd->flags & ND_F_DIRECT) ? hop + 2 : hop + 1;
+      if (want_hop != cur_hop) {
+        if (set_hop(skb, &pi, cur_hop, want_hop)) {
+          count_drop(0, DR_HELPER_ERR);
+          reason = DR_HELPER_ERR;
+          continue;
+        }
+        cur_hop = want_hop;
+      }
+      if (rewrite_dest(skb, &pi, nd->daddr, nd->dport)) {
+        count_drop(0, DR_HELPER_ERR);
+        reason = DR_HELPER_ERR;
+        continue;
+      }
 
       // 복제: 마지막 대상은 원본 skb로 전달, 그 외는 clone
       if (i + 1 < fanout) {
         long rc = bpf_clone_redirect(skb, cfg->egress_ifindex, 0);
-        if (rc == 0)
+        if (rc == 0) {
           count_clone(1);
-        else
+        } else {
           count_drop(0, DR_CLONE_FAIL);
+          reason = DR_CLONE_FAIL;
+        }
+        dup = rc == 0;
       } else {
-        // 원본은 통과
+        dup = 0;  // 원본은 통과
       }
     }
-    return TC_ACT_OK;
+    emit_event(cfg, topic_id, hop, fanout, reason);
+    return dup ? TC_ACT_SHOT : TC_ACT_UNSPEC;
   } else if (hop == 1) {
-    // 2차: node_id -> local_sub
-    __u32 nid = cfg->local_node_id;
-    void *inner2 = bpf_map_lookup_elem(node2subs, &nid);
+    // 2차: (node_id, topic_id) -> local_sub. 이 토픽 구독자가 없는 노드면 그대로 통과
+    struct local_key lk = {.node_id = cfg->local_node_id, .topic_id = topic_id};
+    void *inner2 = bpf_map_lookup_elem(node2subs, &lk);
     if (!inner2) {
       count_drop(0, DR_NO_LOCALSET);
-      return TC_ACT_OK;
+      emit_event(cfg, topic_id, hop, 0, DR_NO_LOCALSET);
+      return TC_ACT_UNSPEC;
     }
-    __u32 *localcntp = bpf_map_lookup_elem(node_cnt, &nid);
+    __u32 *localcntp = bpf_map_lookup_elem(node_cnt, &lk);
     __u32 localcnt = localcntp ? *localcntp : 0;
     if (localcnt == 0) {
       count_drop(0, DR_NO_LOCALSET);
-      return TC_ACT_OK;
+      emit_event(cfg, topic_id, hop, 0, DR_NO_LOCALSET);
+      return TC_ACT_UNSPEC;
     }
+    __u32 reason = DR_OK;
 
-    th->hop = hop + 1;
+    if (set_hop(skb, &pi, hop, hop + 1)) {
+      count_drop(0, DR_HELPER_ERR);
+      return TC_ACT_UNSPEC;
+    }
 
+    int dup = 0;
 #pragma clang loop unroll(disable)
     for (__u32 i = 0; i < MAX_LOCAL_SUB; i++) {
       if (i >= localcnt) break;
       struct sub_dest *sd = bpf_map_lookup_elem(inner2, &i);
       if (!sd) continue;
+      if (sd->family != pi.family) {
+        count_drop(0, DR_FAMILY);
+        reason = DR_FAMILY;
+        continue;
+      }
 
-      __u32 daddr = sd->daddr;  // NBO
-      __u16 dport = sd->dport;  // NBO
       __u32 ifi = sd->ifindex ? sd->ifindex : cfg->local_route_ifindex;
-
-      bpf_l3_csum_replace(skb, l3_csum_off, ip->daddr, daddr, sizeof(daddr));
-      ip->daddr = daddr;
-
-      if (udp->check)
-        bpf_l4_csum_replace(skb, l4_csum_off, udp->dest, dport, sizeof(dport));
-      udp->dest = dport;
+      if (rewrite_dest(skb, &pi, sd->daddr, sd->dport)) {
+        count_drop(0, DR_HELPER_ERR);
+        reason = DR_HELPER_ERR;
+        continue;
+      }
 
       if (i + 1 < localcnt) {
         long rc = bpf_clone_redirect(skb, ifi, 0);
-        if (rc == 0)
+        if (rc == 0) {
           count_clone(2);
-        else
+        } else {
           count_drop(0, DR_CLONE_FAIL);
+          reason = DR_CLONE_FAIL;
+        }
+        dup = rc == 0;
       } else {
-        // 마지막 대상은 원본 skb로
+        dup = 0;  // 마지막 대상은 원본 skb로
       }
     }
-    return TC_ACT_OK;
+    emit_event(cfg, topic_id, hop, localcnt, reason);
+    return dup ? TC_ACT_SHOT : TC_ACT_UNSPEC;
   }
 
   // hop >= 2: 패스스루
-  return TC_ACT_OK;
+  return TC_ACT_UNSPEC;
 }
 
 char _license[] SEC("license") = "GPL";
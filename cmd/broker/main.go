@@ -1,12 +1,13 @@
 package main
 
 // 비교군 (A) 사용자공간 브로커 (단일 단계)
-// publisher -> broker(0.0.0.0:32000) -> subscribers (라벨/서비스 디스커버리 없이 ENV로 목록 주입)
+// publisher -> broker(:32000, IPv4/IPv6 겸용) -> subscribers (라벨/서비스 디스커버리 없이 ENV로 목록 주입)
 
 import (
 	"encoding/binary"
 	"log"
 	"net"
+	"net/netip"
 	"os"
 	"strings"
 )
@@ -28,9 +29,16 @@ func parseHdr(b []byte) (topicHdr, []byte, bool) {
 }
 
 func main() {
-	subs := strings.Split(os.Getenv("SUBS"), ",") // "10.0.0.10:31001,10.0.0.11:31001"
-	addr, _ := net.ResolveUDPAddr("udp", ":32000")
-	conn, err := net.ListenUDP("udp", addr)
+	// "10.0.0.10:31001,[fd00::11]:31001,sub-0.subs:31001" (호스트명/서비스명은 기동 시 한 번 해석)
+	var subs []netip.AddrPort
+	for _, s := range strings.Split(os.Getenv("SUBS"), ",") {
+		if s = strings.TrimSpace(s); s == "" { continue }
+		ua, err := net.ResolveUDPAddr("udp", s)
+		if err != nil { log.Fatalf("SUBS: %v", err) }
+		ap := ua.AddrPort()
+		subs = append(subs, netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())) // IPv4는 4바이트 주소로
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: 32000})
 	if err != nil { log.Fatal(err) }
 	defer conn.Close()
 	buf := make([]byte, 65535)
@@ -43,14 +51,12 @@ func main() {
 		if !ok { continue }
 		h.Hop = 1
 		for _, s := range subs {
-			ra, err := net.ResolveUDPAddr("udp", s)
-			if err != nil { continue }
 			pkt := make([]byte, 8+len(payload))
 			binary.BigEndian.PutUint32(pkt[:4], h.Topic)
 			binary.BigEndian.PutUint16(pkt[4:6], h.Flags)
 			binary.BigEndian.PutUint16(pkt[6:8], h.Hop)
 			copy(pkt[8:], payload)
-			_, _ = conn.WriteToUDP(pkt, ra)
+			_, _ = conn.WriteToUDPAddrPort(pkt, s)
 		}
 	}
 }
@@ -0,0 +1,126 @@
+package main
+
+// 용량 검사와 오버플로 정책.
+// 데이터패스 한도(commons.h): 토픽당 1차 목적지 MAX_FANOUT(또는 spec.maxFanout),
+// (노드, 토픽)당 로컬 구독자 MAX_LOCAL_SUB, 전체 (노드, 토픽) 집합 MAX_LOCAL_SETS.
+// 한도를 넘는 토픽은 push 전에 정책대로 처리하므로 loader가 세대를 거부하는 일은 없다.
+// - reject (기본): 토픽 전체를 프로그래밍하지 않고 Ready=False
+// - truncate: 정렬 순서상 앞쪽 한도만큼만 남기고 Ready=True/Truncated + 경고 메트릭
+// MAX_LOCAL_SETS 초과는 정책과 무관하게 토픽 ID 순으로 뒤쪽 토픽을 거부한다.
+// 토픽별 정책은 PubSubTopic spec.overflowPolicy, 없으면 controller overflowPolicy (-overflow-policy, config.go).
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/yourorg/psbench/pkg/kube"
+	"github.com/yourorg/psbench/pkg/maps"
+)
+
+const (
+	capProgrammed = "programmed"
+	capTruncated  = "truncated"
+	capRejected   = "rejected"
+)
+
+// topicCap: 한 토픽의 용량 사용량. 크기는 정책 적용 전(요청) 기준.
+type topicCap struct {
+	Policy       string
+	State        string
+	Fanout       int // 요청된 1차 목적지 수
+	FanoutLimit  int
+	MaxLocal     int // 가장 큰 로컬 집합
+	DroppedDests int // truncate로 잘린 1차 목적지
+	DroppedSubs  int // truncate로 잘린 로컬 구독자
+}
+
+// capReport: buildTables 한 번의 용량 보고
+type capReport struct {
+	Topics map[uint32]*topicCap
+	Locals map[maps.LocalKey]int // 프로그래밍된 로컬 집합 크기
+}
+
+func newCapReport() capReport {
+	return capReport{Topics: map[uint32]*topicCap{}, Locals: map[maps.LocalKey]int{}}
+}
+
+func validPolicy(p string) bool {
+	return p == kube.OverflowReject || p == kube.OverflowTruncate
+}
+
+// capMetrics: 마지막 보고를 /metrics로 노출
+type capMetrics struct {
+	mu       sync.Mutex
+	rep      capReport
+	nodeName map[uint32]string
+}
+
+func (c *capMetrics) set(rep capReport, nodeID map[string]uint32) {
+	names := map[uint32]string{}
+	for n, id := range nodeID {
+		names[id] = n
+	}
+	c.mu.Lock()
+	c.rep, c.nodeName = rep, names
+	c.mu.Unlock()
+}
+
+func (c *capMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	ids := make([]uint32, 0, len(c.rep.Topics))
+	for id := range c.rep.Topics {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	fmt.Fprintln(w, "# HELP psbench_topic_destinations Tier-1 destinations requested per topic (before overflow policy).")
+	fmt.Fprintln(w, "# TYPE psbench_topic_destinations gauge")
+	for _, id := range ids {
+		fmt.Fprintf(w, "psbench_topic_destinations{topic=\"%d\"} %d\n", id, c.rep.Topics[id].Fanout)
+	}
+	fmt.Fprintln(w, "# HELP psbench_topic_destinations_limit Tier-1 destination limit per topic.")
+	fmt.Fprintln(w, "# TYPE psbench_topic_destinations_limit gauge")
+	for _, id := range ids {
+		fmt.Fprintf(w, "psbench_topic_destinations_limit{topic=\"%d\"} %d\n", id, c.rep.Topics[id].FanoutLimit)
+	}
+	fmt.Fprintln(w, "# HELP psbench_topic_truncated Entries dropped by the truncate overflow policy, by tier.")
+	fmt.Fprintln(w, "# TYPE psbench_topic_truncated gauge")
+	for _, id := range ids {
+		tc := c.rep.Topics[id]
+		fmt.Fprintf(w, "psbench_topic_truncated{topic=\"%d\",tier=\"1\"} %d\n", id, tc.DroppedDests)
+		fmt.Fprintf(w, "psbench_topic_truncated{topic=\"%d\",tier=\"2\"} %d\n", id, tc.DroppedSubs)
+	}
+	fmt.Fprintln(w, "# HELP psbench_topic_rejected 1 if the topic was not programmed because it exceeds a datapath limit.")
+	fmt.Fprintln(w, "# TYPE psbench_topic_rejected gauge")
+	for _, id := range ids {
+		v := 0
+		if c.rep.Topics[id].State == capRejected { v = 1 }
+		fmt.Fprintf(w, "psbench_topic_rejected{topic=\"%d\"} %d\n", id, v)
+	}
+
+	keys := make([]maps.LocalKey, 0, len(c.rep.Locals))
+	for k := range c.rep.Locals {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].NodeID != keys[j].NodeID { return keys[i].NodeID < keys[j].NodeID }
+		return keys[i].TopicID < keys[j].TopicID
+	})
+	fmt.Fprintln(w, "# HELP psbench_local_subscribers Programmed local subscribers per (node, topic); limit is psbench_local_subscribers_limit.")
+	fmt.Fprintln(w, "# TYPE psbench_local_subscribers gauge")
+	for _, k := range keys {
+		fmt.Fprintf(w, "psbench_local_subscribers{node=%q,topic=\"%d\"} %d\n", c.nodeName[k.NodeID], k.TopicID, c.rep.Locals[k])
+	}
+	fmt.Fprintln(w, "# TYPE psbench_local_subscribers_limit gauge")
+	fmt.Fprintf(w, "psbench_local_subscribers_limit %d\n", maps.MaxLocalSub)
+	fmt.Fprintln(w, "# HELP psbench_local_sets Programmed (node, topic) local sets; limit is psbench_local_sets_limit.")
+	fmt.Fprintln(w, "# TYPE psbench_local_sets gauge")
+	fmt.Fprintf(w, "psbench_local_sets %d\n", len(c.rep.Locals))
+	fmt.Fprintln(w, "# TYPE psbench_local_sets_limit gauge")
+	fmt.Fprintf(w, "psbench_local_sets_limit %d\n", maps.MaxLocalSets)
+}
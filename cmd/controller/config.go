@@ -0,0 +1,135 @@
+package main
+
+// 배포 설정: 플래그 또는 -config 파일(YAML/JSON, 같은 이름의 필드). 둘 다 주면 명시한 플래그가 이긴다.
+// 한 클러스터에 독립 벤치마크 배포를 여럿 둘 때는 배포마다 namespace(Lease, loader)와
+// 구독자 네임스페이스/셀렉터, loader 포트, 핀 경로를 겹치지 않게 잡는다.
+//
+//	namespace: psbench-a                    # 컨트롤러 자신, Lease, loader Pod
+//	subscriberNamespaces: [team-a, team-b]  # 구독자 Pod와 PubSubTopic/Subscription. ["*"] = 모든 네임스페이스
+//	subscriberSelector: app=subscriber,bench=a
+//	loaderSelector: app=psbench-loader,bench=a
+//	loaderPort: 19465
+//	loaderTokenFile: /etc/psbench/api-token # loader API 공유 토큰 (loader PS_API_TOKEN_FILE과 같은 Secret)
+//	firstTierPort: 32100
+//	subscriberPort: 31101                   # PS_UDP_PORT도 UDP containerPort도 없는 구독자
+//	terminatingGrace: 5s                    # 종료 중 Pod를 fan-out에 남겨 drain하는 시간
+//	pinRoot: /sys/fs/bpf/psbench-a          # -dry-run diff 대상 (loader PS_PIN_ROOT와 같게)
+//	ipFamily: IPv6                          # spec.ipFamily 없는 토픽의 family, 비면 클러스터 기본 (family.go)
+//	overflowPolicy: truncate                # spec.overflowPolicy 없는 토픽의 용량 초과 처리 reject|truncate (capacity.go)
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yourorg/psbench/pkg/kube"
+	"github.com/yourorg/psbench/pkg/topology"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+type config struct {
+	Namespace            string          `json:"namespace"`
+	SubscriberNamespaces []string        `json:"subscriberNamespaces,omitempty"` // 비면 Namespace
+	SubscriberSelector   string          `json:"subscriberSelector"`
+	LoaderSelector       string          `json:"loaderSelector"`
+	LoaderPort           int             `json:"loaderPort"`
+	LoaderTokenFile      string          `json:"loaderTokenFile,omitempty"`
+	LeaseName            string          `json:"leaseName"`
+	FirstTierPort        int             `json:"firstTierPort"`
+	SubscriberPort       int             `json:"subscriberPort"`
+	TerminatingGrace     metav1.Duration `json:"terminatingGrace"`
+	PinRoot              string          `json:"pinRoot"`
+	IPFamily             string          `json:"ipFamily,omitempty"`
+	OverflowPolicy       string          `json:"overflowPolicy"`
+}
+
+func defaultConfig() config {
+	return config{
+		Namespace:          defaultNamespace,
+		SubscriberSelector: "app=subscriber",
+		LoaderSelector:     "app=psbench-loader",
+		LoaderPort:         topology.DefaultLoaderPort,
+		LeaseName:          "psbench-controller",
+		FirstTierPort:      defaultFirstTierPort,
+		SubscriberPort:     defaultSubscriberPort,
+		PinRoot:            defaultPinRoot,
+		OverflowPolicy:     kube.OverflowReject,
+	}
+}
+
+func (c *config) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Namespace, "namespace", c.Namespace, "namespace of this deployment: controller Lease and loader pods")
+	fs.Var((*listFlag)(&c.SubscriberNamespaces), "subscriber-namespaces", "comma-separated namespaces of subscriber pods and topic CRs, * for all (default: -namespace)")
+	fs.StringVar(&c.SubscriberSelector, "subscriber-selector", c.SubscriberSelector, "label selector of subscriber pods")
+	fs.StringVar(&c.LoaderSelector, "loader-selector", c.LoaderSelector, "label selector of loader pods in -namespace")
+	fs.IntVar(&c.LoaderPort, "loader-port", c.LoaderPort, "loader API port (loader PS_API_ADDR)")
+	fs.StringVar(&c.LoaderTokenFile, "loader-token-file", c.LoaderTokenFile, "file with the loader API bearer token (loader PS_API_TOKEN_FILE)")
+	fs.StringVar(&c.LeaseName, "lease", c.LeaseName, "leader election Lease name in -namespace")
+	fs.IntVar(&c.FirstTierPort, "first-tier-port", c.FirstTierPort, "UDP port of hop=1 node destinations")
+	fs.IntVar(&c.SubscriberPort, "subscriber-port", c.SubscriberPort, "subscriber port when a pod has neither PS_UDP_PORT nor a UDP containerPort")
+	fs.DurationVar(&c.TerminatingGrace.Duration, "terminating-grace", c.TerminatingGrace.Duration, "keep terminating subscriber pods in the fan-out this long after deletion to drain")
+	fs.StringVar(&c.PinRoot, "pins", c.PinRoot, "dry-run: diff against the active generation pinned here, if present")
+	fs.StringVar(&c.IPFamily, "ip-family", c.IPFamily, "IPv4|IPv6 for topics without spec.ipFamily (default: family of the first node's InternalIP)")
+	fs.StringVar(&c.OverflowPolicy, "overflow-policy", c.OverflowPolicy, "reject|truncate for topics over datapath capacity without spec.overflowPolicy")
+}
+
+// loadConfig: 플래그 → -config 파일 → 명시한 플래그 다시 적용
+func loadConfig(fs *flag.FlagSet, args []string) (config, error) {
+	c := defaultConfig()
+	c.bindFlags(fs)
+	path := fs.String("config", "", "deployment config file (YAML/JSON); explicit flags override it")
+	if err := fs.Parse(args); err != nil { return c, err }
+	if *path != "" {
+		b, err := os.ReadFile(*path)
+		if err != nil { return c, err }
+		if err := yaml.UnmarshalStrict(b, &c); err != nil { return c, fmt.Errorf("%s: %w", *path, err) }
+		if err := fs.Parse(args); err != nil { return c, err }
+	}
+	return c, c.validate()
+}
+
+func (c config) validate() error {
+	for i, ns := range append([]string{c.Namespace}, c.SubscriberNamespaces...) {
+		if i > 0 && ns == "*" { continue } // 구독자 쪽만 전체 허용
+		if errs := validation.IsDNS1123Label(ns); len(errs) > 0 { return fmt.Errorf("namespace %q: %s", ns, strings.Join(errs, "; ")) }
+	}
+	for _, sel := range []string{c.SubscriberSelector, c.LoaderSelector} {
+		if _, err := metav1.ParseToLabelSelector(sel); err != nil { return fmt.Errorf("selector %q: %w", sel, err) }
+	}
+	for name, p := range map[string]int{"loaderPort": c.LoaderPort, "firstTierPort": c.FirstTierPort, "subscriberPort": c.SubscriberPort} {
+		if p <= 0 || p > 65535 { return fmt.Errorf("%s %d out of range", name, p) }
+	}
+	if c.LeaseName == "" { return fmt.Errorf("empty lease name") }
+	if c.IPFamily != "" && !validFamily(v1.IPFamily(c.IPFamily)) { return fmt.Errorf("ipFamily %q (want %s|%s)", c.IPFamily, v1.IPv4Protocol, v1.IPv6Protocol) }
+	if !validPolicy(c.OverflowPolicy) { return fmt.Errorf("overflowPolicy %q (want %s|%s)", c.OverflowPolicy, kube.OverflowReject, kube.OverflowTruncate) }
+	if c.TerminatingGrace.Duration < 0 { return fmt.Errorf("negative terminatingGrace %s", c.TerminatingGrace.Duration) }
+	return nil
+}
+
+// subscriberNamespaces: topology.Kubernetes.Namespaces 모양 ("*" → NamespaceAll)
+func (c config) subscriberNamespaces() []string {
+	if len(c.SubscriberNamespaces) == 0 { return []string{c.Namespace} }
+	out := make([]string, len(c.SubscriberNamespaces))
+	for i, ns := range c.SubscriberNamespaces {
+		if ns == "*" { ns = metav1.NamespaceAll }
+		out[i] = ns
+	}
+	return out
+}
+
+// listFlag: "a,b,c". Set은 덮어쓴다 (loadConfig가 플래그를 두 번 적용한다)
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	*l = nil
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" { *l = append(*l, s) }
+	}
+	return nil
+}
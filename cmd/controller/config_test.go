@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/yourorg/psbench/pkg/kube"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "controller.yaml")
+	file := `namespace: bench-a
+subscriberNamespaces: [team-a, team-b]
+subscriberSelector: app=subscriber,bench=a
+loaderPort: 19465
+firstTierPort: 32100
+overflowPolicy: truncate
+`
+	if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := loadConfig(flag.NewFlagSet("test", flag.ContinueOnError), nil)
+	if err != nil || !reflect.DeepEqual(c, defaultConfig()) {
+		t.Errorf("no flags: %+v, %v; want defaults", c, err)
+	}
+
+	// 파일이 기본값을, 명시한 플래그가 파일을 덮는다
+	c, err = loadConfig(flag.NewFlagSet("test", flag.ContinueOnError),
+		[]string{"-first-tier-port=32200", "-config", path, "-subscriber-namespaces=*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := defaultConfig()
+	want.Namespace, want.SubscriberSelector, want.LoaderPort = "bench-a", "app=subscriber,bench=a", 19465
+	want.FirstTierPort, want.SubscriberNamespaces = 32200, []string{"*"}
+	want.OverflowPolicy = kube.OverflowTruncate
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("config = %+v\nwant     %+v", c, want)
+	}
+	if got := c.subscriberNamespaces(); len(got) != 1 || got[0] != "" {
+		t.Errorf("subscriberNamespaces() = %q, want all", got)
+	}
+
+	for _, args := range [][]string{
+		{"-namespace=Bad_NS"},
+		{"-subscriber-selector=app in ("},
+		{"-first-tier-port=70000"},
+		{"-ip-family=ipv6"},
+		{"-overflow-policy=drop"},
+		{"-config", path, "-loader-port=0"},
+	} {
+		if _, err := loadConfig(flag.NewFlagSet("test", flag.ContinueOnError), args); err == nil {
+			t.Errorf("%q accepted", args)
+		}
+	}
+	if err := os.WriteFile(path, []byte("namespaces: [x]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", path}); err == nil {
+		t.Errorf("unknown config field accepted")
+	}
+}
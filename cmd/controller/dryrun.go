@@ -0,0 +1,131 @@
+package main
+
+// -dry-run: desired 테이블을 계산해 출력만 한다. status 갱신, Event, loader push, 맵 쓰기 없음.
+// 경고(해석 불가 토픽 항목, Ready=False/Truncated 토픽과 구독)는 출력의 warnings에 담고 exit 2.
+// -pins 경로에 프로그래밍된 맵이 있으면(노드에서 실행) 활성 세대와의 diff를 함께 싣는다.
+// loader는 전체 테이블을 모든 노드에 쓰므로 어느 노드의 핀이든 비교 대상으로 충분하다.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+
+	"github.com/yourorg/psbench/pkg/api"
+	"github.com/yourorg/psbench/pkg/kube"
+	"github.com/yourorg/psbench/pkg/maps"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+const defaultPinRoot = "/sys/fs/bpf/psbench"
+
+type dryRunOut struct {
+	Version  string      `json:"version"`
+	Tables   maps.Tables `json:"tables"`
+	Filter   api.Filter  `json:"filter"` // loader에 함께 보낼 포트 필터
+	Warnings []string    `json:"warnings,omitempty"`
+	Diff     *dryRunDiff `json:"diff,omitempty"`
+}
+
+type dryRunDiff struct {
+	Pins      string   `json:"pins"`
+	ActiveGen uint32   `json:"active_gen"`
+	Changes   []string `json:"changes"` // maps.Diff(programmed → desired)
+}
+
+// warnRecorder: Warning Event 대신 경고 목록에 쌓는다 (record.EventRecorder). Normal은 버린다.
+type warnRecorder struct{ warnings *[]string }
+
+func (w warnRecorder) Event(obj runtime.Object, typ, reason, msg string) {
+	if typ != v1.EventTypeWarning { return }
+	name := "?"
+	if m, err := meta.Accessor(obj); err == nil { name = m.GetName() }
+	*w.warnings = append(*w.warnings, fmt.Sprintf("pod %s: %s: %s", name, reason, msg))
+}
+
+func (w warnRecorder) Eventf(obj runtime.Object, typ, reason, format string, args ...interface{}) {
+	w.Event(obj, typ, reason, fmt.Sprintf(format, args...))
+}
+
+func (w warnRecorder) AnnotatedEventf(obj runtime.Object, _ map[string]string, typ, reason, format string, args ...interface{}) {
+	w.Eventf(obj, typ, reason, format, args...)
+}
+
+// dryRun: 경고가 있으면 warn=true
+func dryRun(ctx context.Context, r *reconciler, pins, format string, w io.Writer) (warn bool, err error) {
+	var warnings []string
+	r.rec = warnRecorder{&warnings}
+	d, err := r.compute(ctx)
+	if err != nil { return false, err }
+	if err := d.tables.Validate(); err != nil { return false, fmt.Errorf("desired tables invalid: %w", err) }
+
+	for _, t := range d.topics {
+		c := meta.FindStatusCondition(t.Status.Conditions, kube.CondReady)
+		if c != nil && (c.Status != metav1.ConditionTrue || c.Reason == "Truncated") {
+			warnings = append(warnings, fmt.Sprintf("topic %s: %s: %s", t.Name, c.Reason, c.Message))
+		}
+	}
+	for _, s := range d.subs {
+		c := meta.FindStatusCondition(s.Status.Conditions, kube.CondReady)
+		if c != nil && c.Status != metav1.ConditionTrue {
+			warnings = append(warnings, fmt.Sprintf("subscription %s: %s: %s", s.Name, c.Reason, c.Message))
+		}
+	}
+	out := dryRunOut{Version: d.version, Tables: d.tables, Filter: d.filter, Warnings: warnings}
+
+	if pins != "" {
+		diff, err := diffPinned(pins, d.tables)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			log.Printf("dry-run: no programmed maps at %s, diff skipped", pins)
+		case err != nil:
+			return false, err
+		default:
+			out.Diff = diff
+		}
+	}
+
+	var b []byte
+	switch format {
+	case "json":
+		b, err = json.MarshalIndent(out, "", "  ")
+		b = append(b, '\n')
+	case "yaml":
+		b, err = yaml.Marshal(out)
+	default:
+		return false, fmt.Errorf("unknown output format %q (want json|yaml)", format)
+	}
+	if err != nil { return false, err }
+	if _, err := w.Write(b); err != nil { return false, err }
+	return len(warnings) > 0, nil
+}
+
+func diffPinned(pins string, want maps.Tables) (*dryRunDiff, error) {
+	if _, err := os.Stat(pins); err != nil { return nil, err }
+	dp, err := maps.OpenPinned(pins)
+	if err != nil { return nil, err }
+	defer dp.Close()
+	d, err := diffStore(dp, want)
+	if err != nil { return nil, err }
+	d.Pins = pins
+	return d, nil
+}
+
+// diffStore: 활성 세대(programmed) → want
+func diffStore(s maps.Store, want maps.Tables) (*dryRunDiff, error) {
+	gen, err := s.ActiveGen()
+	if err != nil { return nil, err }
+	have, err := s.ReadGeneration(gen)
+	if err != nil { return nil, fmt.Errorf("read gen %d: %w", gen, err) }
+	changes := maps.Diff(have, want)
+	if changes == nil { changes = []string{} }
+	return &dryRunDiff{ActiveGen: gen, Changes: changes}, nil
+}
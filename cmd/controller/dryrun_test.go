@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yourorg/psbench/pkg/kube"
+	"github.com/yourorg/psbench/pkg/maps"
+	"github.com/yourorg/psbench/pkg/topology"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/yaml"
+)
+
+func dryRunFixture() *reconciler {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "n0"},
+		Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: "192.168.0.10"}}},
+	}
+	good := subPod("s1", "n0", "10.1.0.1", map[string]string{topicsAnnotation: "1"})
+	bad := subPod("s2", "n0", "10.1.0.2", map[string]string{topicsAnnotation: "1,x"})
+	for _, p := range []*v1.Pod{&good, &bad} {
+		p.Namespace, p.Labels = defaultNamespace, map[string]string{"app": "subscriber"}
+	}
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		kube.TopicGVR:        "PubSubTopicList",
+		kube.SubscriptionGVR: "PubSubSubscriptionList",
+	})
+	src := &topology.Kubernetes{Client: fake.NewSimpleClientset(node, &good, &bad), Dyn: dyn, Namespaces: []string{defaultNamespace}, SubscriberSelector: "app=subscriber"}
+	return &reconciler{src: src, policy: kube.OverflowReject}
+}
+
+// 해석 불가 항목은 경고로, 나머지는 테이블로. 핀이 없으면 diff 없이 출력한다.
+func TestDryRun(t *testing.T) {
+	var buf bytes.Buffer
+	warn, err := dryRun(context.Background(), dryRunFixture(), filepath.Join(t.TempDir(), "none"), "json", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !warn {
+		t.Errorf("warn = false, want true for invalid topic entry")
+	}
+	var out dryRunOut
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatalf("%v\n%s", err, buf.String())
+	}
+	if out.Diff != nil {
+		t.Errorf("diff = %+v without pinned maps", out.Diff)
+	}
+	if len(out.Warnings) != 1 || !strings.Contains(out.Warnings[0], "s2") {
+		t.Errorf("warnings = %q, want one for pod s2", out.Warnings)
+	}
+	subs := out.Tables.Nodes[0][1]
+	if len(subs) != 2 || out.Version == "" {
+		t.Errorf("node 0 topic 1 = %+v (version %q), want s1 and s2", subs, out.Version)
+	}
+
+	buf.Reset()
+	if _, err := dryRun(context.Background(), dryRunFixture(), "", "yaml", &buf); err != nil {
+		t.Fatal(err)
+	}
+	var y dryRunOut
+	if err := yaml.Unmarshal(buf.Bytes(), &y); err != nil || y.Version != out.Version {
+		t.Errorf("yaml version %q (err %v), want %q", y.Version, err, out.Version)
+	}
+
+	if _, err := dryRun(context.Background(), dryRunFixture(), "", "xml", &buf); err == nil {
+		t.Errorf("unknown format accepted")
+	}
+}
+
+func TestDiffStore(t *testing.T) {
+	dp := maps.NewFake()
+	have := maps.Tables{Topics: map[uint32][]maps.NodeDest{1: {{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")}}}}
+	if err := dp.WriteGeneration(1, have); err != nil {
+		t.Fatal(err)
+	}
+	if err := dp.SetActiveGen(1); err != nil {
+		t.Fatal(err)
+	}
+	want := maps.Tables{Topics: map[uint32][]maps.NodeDest{1: {{NodeID: 1, Dest: netip.MustParseAddrPort("192.168.0.11:32000")}}}}
+	d, err := diffStore(dp, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{"topic 1: - node 0 192.168.0.10:32000", "topic 1: + node 1 192.168.0.11:32000"}
+	if d.ActiveGen != 1 || fmt.Sprint(d.Changes) != fmt.Sprint(exp) {
+		t.Errorf("diff = %+v, want gen 1 %v", d, exp)
+	}
+}
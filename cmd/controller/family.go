@@ -0,0 +1,66 @@
+package main
+
+// 주소 family (IPv4/IPv6, dual-stack).
+// 데이터패스는 패킷의 IP 헤더를 바꿀 뿐 family를 바꾸지 못하므로 한 토픽의 목적지는 모두 같은 family다.
+// - 토픽 family: PubSubTopic spec.ipFamily > -ip-family > 클러스터 기본(이름순 첫 노드의 첫 InternalIP, 없으면 IPv4)
+// - 노드 주소: 그 family의 첫 InternalIP, 구독자 주소: 그 family의 첫 PodIPs 항목
+// - 그 family 주소가 없는 노드/구독자는 그 토픽에서 빠진다 (로그와 토픽 status 메시지에 남는다)
+// publisher는 토픽 family로 보내야 한다 (다른 family 패킷은 데이터패스가 family_mismatch로 센다).
+
+import (
+	"net/netip"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// addrs: family → 첫 주소
+type addrs map[v1.IPFamily]netip.Addr
+
+func ipFamily(ip string) v1.IPFamily {
+	a, err := netip.ParseAddr(ip)
+	if err != nil { return "" }
+	return addrFamily(a)
+}
+
+func addrFamily(a netip.Addr) v1.IPFamily {
+	if a.Is4() { return v1.IPv4Protocol }
+	return v1.IPv6Protocol
+}
+
+func validFamily(f v1.IPFamily) bool { return f == v1.IPv4Protocol || f == v1.IPv6Protocol }
+
+// add: 파싱할 수 없거나 zone이 붙은 주소는 버린다
+func (a addrs) add(ip string) {
+	v, err := netip.ParseAddr(ip)
+	if err != nil || v.Zone() != "" { return }
+	if f := addrFamily(v); !a[f].IsValid() { a[f] = v }
+}
+
+func nodeAddrs(n *v1.Node) addrs {
+	out := addrs{}
+	for _, a := range n.Status.Addresses {
+		if a.Type == v1.NodeInternalIP { out.add(a.Address) }
+	}
+	return out
+}
+
+// podAddrs: PodIPs (dual-stack), 없으면 PodIP
+func podAddrs(p *v1.Pod) addrs {
+	out := addrs{}
+	for _, ip := range p.Status.PodIPs {
+		out.add(ip.IP)
+	}
+	out.add(p.Status.PodIP)
+	return out
+}
+
+// clusterFamily: 이름순으로 정렬된 nodes의 첫 노드가 먼저 가진 InternalIP의 family
+func clusterFamily(nodes []v1.Node) v1.IPFamily {
+	if len(nodes) > 0 {
+		for _, a := range nodes[0].Status.Addresses {
+			if a.Type != v1.NodeInternalIP { continue }
+			if f := ipFamily(a.Address); f != "" { return f }
+		}
+	}
+	return v1.IPv4Protocol
+}
@@ -0,0 +1,105 @@
+package main
+
+// /healthz: reconcile 결과 요약.
+//   ok       : 마지막 reconcile이 모든 노드에 반영됨
+//   degraded : 일부 노드 apply/flip 실패, 또는 reconcile 실패가 failThreshold번 미만 연속 (재시도 중)
+//   failed   : reconcile이 failThreshold번 이상 연속 실패 (HTTP 503)
+//   standby  : 리더가 아님 (reconcile 안 함)
+// 실패한 노드는 이전 세대를 그대로 쓰므로 degraded는 "일부 노드가 낡은 테이블"을 뜻한다.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	healthOK       = "ok"
+	healthDegraded = "degraded"
+	healthFailed   = "failed"
+	healthStandby  = "standby"
+
+	failThreshold = 3
+)
+
+// stageError: reconcile이 멈춘 단계 (list_nodes, list_pods, list_topics, ...)
+type stageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *stageError) Error() string { return fmt.Sprintf("%s: %v", e.Stage, e.Err) }
+func (e *stageError) Unwrap() error { return e.Err }
+
+type healthError struct {
+	Stage string    `json:"stage"`
+	Error string    `json:"error"`
+	At    time.Time `json:"at"`
+}
+
+type healthStatus struct {
+	State       string       `json:"state"`
+	Failures    int          `json:"consecutive_failures"`
+	LastSuccess time.Time    `json:"last_success,omitempty"`
+	LastError   *healthError `json:"last_error,omitempty"`
+	Push        *pushReport  `json:"push,omitempty"` // 마지막으로 끝까지 간 reconcile
+}
+
+type health struct {
+	mu sync.Mutex
+	st healthStatus
+}
+
+func newHealth() *health {
+	return &health{st: healthStatus{State: healthStandby}}
+}
+
+// standby: 리더십을 잃음. 이전 결과는 다음 리더의 것이 아니므로 비운다.
+func (h *health) standby() {
+	h.mu.Lock()
+	h.st = healthStatus{State: healthStandby}
+	h.mu.Unlock()
+}
+
+// record: reconcile 한 번의 결과 반영. err가 nil이면 rep가 유효하다.
+func (h *health) record(rep pushReport, err error, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.st.Failures++
+		he := &healthError{Stage: "reconcile", Error: err.Error(), At: now}
+		var se *stageError
+		if errors.As(err, &se) {
+			he.Stage, he.Error = se.Stage, se.Err.Error()
+		}
+		h.st.LastError = he
+		h.st.State = healthDegraded
+		if h.st.Failures >= failThreshold {
+			h.st.State = healthFailed
+		}
+		return
+	}
+	h.st.Failures, h.st.LastSuccess, h.st.Push = 0, now, &rep
+	h.st.State = healthOK
+	if len(rep.Failed) > 0 {
+		h.st.State = healthDegraded
+	}
+}
+
+func (h *health) status() healthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.st
+}
+
+func (h *health) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	st := h.status()
+	code := http.StatusOK
+	if st.State == healthFailed { code = http.StatusServiceUnavailable }
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(st)
+}
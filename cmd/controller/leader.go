@@ -0,0 +1,126 @@
+package main
+
+// 리더 선출 (coordination.k8s.io Lease). 리더만 reconcile/push 한다.
+// 펜싱:
+//   - term = 리더가 된 시점의 Lease spec.leaseTransitions. 홀더가 바뀔 때마다 증가하므로
+//     새 리더의 term은 항상 이전 리더보다 크다.
+//   - apply/flip 요청에 term을 실어 보내고, loader는 지금까지 본 최대 term보다 작은 요청을 거부한다.
+//     리더십을 잃은 줄 모르는(GC 멈춤, 네트워크 분리) 이전 리더의 flip이 새 리더 뒤에 도착해도 반영되지 않는다.
+//   - 프로세스 안에서는 리더십을 잃는 즉시 ctx가 취소되어 진행 중인 push가 flip 전에 멈춘다.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+type leaderState struct {
+	mu       sync.Mutex
+	identity string
+	leader   bool
+	holder   string
+	term     uint64
+	since    time.Time
+}
+
+func (s *leaderState) set(fn func(*leaderState)) {
+	s.mu.Lock()
+	fn(s)
+	s.mu.Unlock()
+}
+
+func (s *leaderState) writeMetrics(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := 0
+	if s.leader { v = 1 }
+	fmt.Fprintln(w, "# HELP psbench_controller_leader 1 if this replica holds the controller lease.")
+	fmt.Fprintln(w, "# TYPE psbench_controller_leader gauge")
+	fmt.Fprintf(w, "psbench_controller_leader{identity=%q} %d\n", s.identity, v)
+	fmt.Fprintln(w, "# HELP psbench_controller_leader_term Fencing term sent to loaders (lease transitions when leadership was acquired).")
+	fmt.Fprintln(w, "# TYPE psbench_controller_leader_term gauge")
+	fmt.Fprintf(w, "psbench_controller_leader_term %d\n", s.term)
+	fmt.Fprintln(w, "# HELP psbench_controller_leader_info Current lease holder as seen by this replica.")
+	fmt.Fprintln(w, "# TYPE psbench_controller_leader_info gauge")
+	fmt.Fprintf(w, "psbench_controller_leader_info{holder=%q} 1\n", s.holder)
+	if s.leader {
+		fmt.Fprintln(w, "# TYPE psbench_controller_leader_since_seconds gauge")
+		fmt.Fprintf(w, "psbench_controller_leader_since_seconds %d\n", s.since.Unix())
+	}
+}
+
+func leaderIdentity() string {
+	if id := os.Getenv("POD_NAME"); id != "" { return id }
+	id, _ := os.Hostname()
+	return id
+}
+
+// leaseTerm: 리더가 된 직후 Lease에서 펜싱 term을 읽는다.
+func leaseTerm(ctx context.Context, client kubernetes.Interface, lease metav1.ObjectMeta, identity string) (uint64, error) {
+	l, err := client.CoordinationV1().Leases(lease.Namespace).Get(ctx, lease.Name, metav1.GetOptions{})
+	if err != nil { return 0, err }
+	if l.Spec.HolderIdentity == nil || *l.Spec.HolderIdentity != identity {
+		return 0, fmt.Errorf("lease held by %v, not %s", l.Spec.HolderIdentity, identity)
+	}
+	var t uint64
+	if l.Spec.LeaseTransitions != nil { t = uint64(*l.Spec.LeaseTransitions) }
+	return t, nil
+}
+
+// runLeader: 리더십을 얻을 때마다 lead(ctx, term)를 호출하고, 잃으면 다시 후보가 된다.
+// lead의 ctx는 리더십을 잃는 순간 취소된다.
+// 같은 클러스터의 독립 배포는 lease(이름/네임스페이스)가 달라 서로 펜싱하지 않는다.
+func runLeader(ctx context.Context, client kubernetes.Interface, lease metav1.ObjectMeta, st *leaderState, lead func(ctx context.Context, term uint64)) {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  lease,
+		Client:     client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: st.identity},
+	}
+	for ctx.Err() == nil {
+		le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   15 * time.Second,
+			RenewDeadline:   10 * time.Second,
+			RetryPeriod:     2 * time.Second,
+			ReleaseOnCancel: true,
+			Name:            lease.Name,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					// term 없이 push하면 펜싱이 안 되므로 읽을 때까지 기다린다 (lease는 elector가 계속 갱신)
+					var term uint64
+					for {
+						var err error
+						if term, err = leaseTerm(ctx, client, lease, st.identity); err == nil { break }
+						log.Printf("leader: read term: %v", err)
+						select {
+						case <-ctx.Done():
+							return
+						case <-time.After(2 * time.Second):
+						}
+					}
+					st.set(func(s *leaderState) { s.leader, s.term, s.since = true, term, time.Now() })
+					log.Printf("leader: %s acquired lease, term %d", st.identity, term)
+					lead(ctx, term)
+				},
+				OnStoppedLeading: func() {
+					st.set(func(s *leaderState) { s.leader = false })
+					log.Printf("leader: %s lost lease", st.identity)
+				},
+				OnNewLeader: func(id string) {
+					st.set(func(s *leaderState) { s.holder = id })
+				},
+			},
+		})
+		if err != nil { log.Fatalf("leader election: %v", err) }
+		le.Run(ctx)
+	}
+}
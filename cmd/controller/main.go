@@ -1,238 +1,521 @@
 package main
 
-// 컨트롤러: K8s API에서 subscriber Pods를 스캔하여
-// topic→node_set, node→local_sub 맵을 비활성 세대에 preload 후 flip.
+// 컨트롤러: 토폴로지 원천(기본 K8s API)에서 subscriber Pods를 스캔하여 topic→node_set, node→local_sub
+// desired 테이블을 한 번 계산하고, 모든 노드의 loader 로컬 API(pkg/api)로 push한다.
+// 노드마다: 비활성 세대에 preload(apply) → ack 수집 → ack한 노드만 flip.
 //
 // 규칙(합리적 가정):
-// - 구독자 Pod 라벨: app=subscriber, ps/topic=<u32>
-// - 구독자 포트: env PS_UDP_PORT (기본 31001)
+// - 구독자 Pod 라벨: app=subscriber (Running, Ready, 종료 중이 아닌 Pod만: membership.go), ps/topic=<u32 | PubSubTopic 이름>[_...]
+//   여러 토픽/토픽별 포트는 어노테이션 ps/topics="1:31001,2:31002" (해석 규칙은 topics.go)
+// - 토픽/구독 CRD: PubSubTopic, PubSubSubscription (pkg/kube/crd.go), status는 controller가 기록
+// - 구독자 포트: env PS_UDP_PORT > UDP containerPort > -subscriber-port (기본 31001)
 // - 노드 ID: 노드명 사전순 인덱싱(0..M-1)
-// - 1차 노드 dport: 32000
-// - BPFFS 핀 루트: /sys/fs/bpf/psbench
+// - IPv4/IPv6: 토픽마다 한 family (PubSubTopic spec.ipFamily, -ip-family, family.go)
+// - 1차 노드 dport: -first-tier-port (기본 32000)
+// - loader: app=psbench-loader Pod(hostNetwork), API 포트 9465
+// - 네임스페이스/셀렉터/포트/핀 경로: 플래그 또는 -config 파일 (config.go)
+// - 활성 세대: 각 노드 m_cfg.active_gen (쓰기는 loader가, 규약은 pkg/maps/config.go)
+// - 클러스터 밖 실행: -kubeconfig, 쓰기 없는 확인: -dry-run (dryrun.go)
+// - K8s 없는 랩/netns: -source file -topology FILE 또는 -source registry -register ADDR (pkg/topology).
+//   리더 선출 없이 단일 인스턴스로 돌고(term 0), status는 로그로만 남는다.
+//   등록 엔드포인트는 기본 127.0.0.1:9467, 다른 주소에 열려면 loaderTokenFile의 토큰을 요구한다.
+// - HA: Lease 리더 선출, 리더만 push하며 loader 요청에 펜싱 term을 싣는다 (leader.go)
+// - 오류: 조회/푸시 실패는 백오프 후 재시도, 상태는 PS_METRICS_ADDR/healthz (health.go)
+// - 용량 한도 초과: -overflow-policy=reject|truncate (config.go, capacity.go), 사용량은 PS_METRICS_ADDR(:9466)/metrics
 
 import (
 	"context"
-	"encoding/binary"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
-	"path/filepath"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/signal"
 	"sort"
 	"strconv"
+	"syscall"
 	"time"
 
-	"github.com/cilium/ebpf"
+	"github.com/yourorg/psbench/pkg/api"
+	"github.com/yourorg/psbench/pkg/kube"
+	"github.com/yourorg/psbench/pkg/maps"
+	"github.com/yourorg/psbench/pkg/topology"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
-	pinRoot         = "/sys/fs/bpf/psbench"
-	ns              = "psbench"
-	firstTierPort   = 32000 // hop=1 수신 노드 포트
-)
-
-type nodeDest struct {
-	NodeID uint32
-	Daddr  uint32
-	Dport  uint16
-	Pad    uint16
-}
+	defaultNamespace      = "psbench"
+	defaultFirstTierPort  = 32000 // hop=1 수신 노드 포트
+	defaultSubscriberPort = 31001
+	filePollInterval      = time.Second // -source file
 
-type subDest struct {
-	Ifindex uint32
-	Daddr   uint32
-	Dport   uint16
-	Pad     uint16
-}
-
-func mustOpen(name string) *ebpf.Map {
-	m, err := ebpf.LoadPinnedMap(filepath.Join(pinRoot, name), nil)
-	if err != nil { log.Fatalf("open map %s: %v", name, err) }
-	return m
-}
+	resyncInterval = 5 * time.Second
+	retryMin       = time.Second
+	retryMax       = 30 * time.Second
+)
 
-func getNodes(client *kubernetes.Clientset) ([]v1.Node, map[string]uint32, map[string]string) {
-	list, err := client.CoreV1().Nodes().List(context.Background(), metav1.ListOptions{})
-	if err != nil { log.Fatalf("list nodes: %v", err) }
-	nodes := list.Items
+// indexNodes: 노드명 → node_id(사전순 인덱스), 노드명 → family별 InternalIP. nodes를 이름순으로 정렬한다.
+func indexNodes(nodes []v1.Node) (map[string]uint32, map[string]addrs) {
 	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
 	idxMap := map[string]uint32{}
-	ipMap := map[string]string{}
-	for i, n := range nodes {
-		idxMap[n.Name] = uint32(i)
-		// pick InternalIP
-		var ip string
-		for _, a := range n.Status.Addresses {
-			if a.Type == v1.NodeInternalIP { ip = a.Address; break }
-		}
-		ipMap[n.Name] = ip
+	ipMap := map[string]addrs{}
+	for i := range nodes {
+		idxMap[nodes[i].Name] = uint32(i)
+		ipMap[nodes[i].Name] = nodeAddrs(&nodes[i])
 	}
-	return nodes, idxMap, ipMap
-}
-
-func toNBO(ip string) uint32 {
-	var b [4]byte
-	fmt.Sscanf(ip, "%d.%d.%d.%d", &b[0], &b[1], &b[2], &b[3])
-	return binary.BigEndian.Uint32(b[:])
+	return idxMap, ipMap
 }
 
-func getPodPort(p v1.Pod) int {
+// getPodPort: env PS_UDP_PORT > 처음 선언된 UDP containerPort > def
+func getPodPort(p v1.Pod, def int) int {
 	for _, c := range p.Spec.Containers {
 		for _, e := range c.Env {
-			if e.Name == "PS_UDP_PORT" {
+			if e.Name == kube.PortEnv {
 				if v, err := strconv.Atoi(e.Value); err == nil { return v }
 			}
 		}
 	}
-	return 31001
+	for _, c := range p.Spec.Containers {
+		for _, cp := range c.Ports {
+			if cp.Protocol == v1.ProtocolUDP && cp.ContainerPort > 0 { return int(cp.ContainerPort) }
+		}
+	}
+	return def
 }
 
-func main() {
-	cfg, err := rest.InClusterConfig()
-	if err != nil { log.Fatalf("kube: %v", err) }
-	client, err := kubernetes.NewForConfig(cfg)
-	if err != nil { log.Fatalf("kube client: %v", err) }
-
-	_, nodeID, nodeIP := getNodes(client)
-	topics := mustOpen("topic_to_node_set_gen0")   // we'll decide inactive dynamically
-	topics1 := mustOpen("topic_to_node_set_gen1")
-	tcnt0 := mustOpen("topic_fanout_cnt_gen0")
-	tcnt1 := mustOpen("topic_fanout_cnt_gen1")
-	nsubs0 := mustOpen("node_to_local_sub_gen0")
-	nsubs1 := mustOpen("node_to_local_sub_gen1")
-	ncnt0 := mustOpen("node_local_cnt_gen0")
-	ncnt1 := mustOpen("node_local_cnt_gen1")
-	active := mustOpen("m_active_gen")
-
-	for {
-		// 1) 현재 활성 세대 읽기
-		var k uint32 = 0
-		var ag uint32
-		if err := active.Lookup(&k, &ag); err != nil { log.Fatalf("active_gen: %v", err) }
-		inactive := uint32(1 - ag)
-
-		// 2) K8s에서 subscriber 수집
-		pods, err := client.CoreV1().Pods(ns).List(context.Background(), metav1.ListOptions{
-			LabelSelector: "app=subscriber",
-		})
-		if err != nil { log.Fatalf("list pods: %v", err) }
-
-		// topic → node set
-		type nodeKey struct{ node string }
-		type topicKey struct{ topic uint32 }
-		topicNodes := map[uint32]map[string]struct{}{}
-		// node → local subs
-		nodeSubs := map[string][]v1.Pod{}
-
-		for _, p := range pods.Items {
-			if p.Status.PodIP == "" || p.Spec.NodeName == "" { continue }
-			// topic id
-			var tID uint32 = 1
-			if v, ok := p.Labels["ps/topic"]; ok {
-				if x, err := strconv.Atoi(v); err == nil { tID = uint32(x) }
+// buildTables: 토픽 멤버 목록 → 모든 노드에 공통으로 적용할 desired 테이블.
+// 원소 순서를 고정해 같은 토폴로지는 같은 version이 나오도록 한다.
+// PubSubTopic이 있는 토픽은 tierMode/maxFanout/overflowPolicy를 반영하고 status(노드/구독자 수, 용량, 조건)를 채운다.
+// 한도 초과 처리는 capacity.go, 토픽별 주소 family는 family.go 참고. 결과 테이블은 항상 maps.Tables.Validate를 통과한다.
+func buildTables(members []member, idx topicIndex, nodeID map[string]uint32, nodeIP map[string]addrs, defPolicy string, firstTierPort uint16) (maps.Tables, capReport) {
+	// topic → node set(이름 → node ID), topic → 멤버 (direct 모드용 + status)
+	topicNodes := map[uint32]map[string]uint32{}
+	topicMembers := map[uint32][]member{}
+	noAddr := map[uint32]int{} // 토픽 family 주소가 없어 빠진 멤버
+	beyond, unknown := 0, 0
+	for _, m := range members {
+		// nodeID에 없는 노드(아직 목록에 안 잡힌 노드 등)를 0으로 읽으면 노드 0의 구독자가 되므로 뺀다
+		id, ok := nodeID[m.pod.Spec.NodeName]
+		if !ok {
+			unknown++
+			continue
+		}
+		if id >= maps.MaxNodes {
+			beyond++
+			continue
+		}
+		m.node = id
+		fam := idx.family(m.topic)
+		direct := idx.byID[m.topic] != nil && idx.byID[m.topic].Spec.TierMode == kube.TierDirect
+		m.addr = podAddrs(m.pod)[fam]
+		if !m.addr.IsValid() || (!direct && !nodeIP[m.pod.Spec.NodeName][fam].IsValid()) {
+			noAddr[m.topic]++
+			continue
+		}
+		if _, ok := topicNodes[m.topic]; !ok { topicNodes[m.topic] = map[string]uint32{} }
+		topicNodes[m.topic][m.pod.Spec.NodeName] = id
+		topicMembers[m.topic] = append(topicMembers[m.topic], m)
+	}
+	if beyond > 0 {
+		log.Printf("%d subscribers on nodes beyond MAX_NODES=%d ignored", beyond, maps.MaxNodes)
+	}
+	if unknown > 0 {
+		log.Printf("%d subscribers on nodes without a node ID ignored", unknown)
+	}
+	for tID, n := range noAddr {
+		msg := fmt.Sprintf("%d subscribers without an %s address skipped", n, idx.family(tID))
+		log.Printf("topic %d: %s", tID, msg)
+		// 남은 멤버가 없으면 아래 루프가 토픽을 보지 않으므로 여기서 status를 둔다
+		if ct := idx.byID[tID]; ct != nil && topicNodes[tID] == nil {
+			setCond(&ct.Status.Conditions, ct.Generation, metav1.ConditionFalse, "NoAddressInFamily", msg)
+		}
+	}
+	tIDs := make([]uint32, 0, len(topicNodes))
+	for tID := range topicNodes {
+		tIDs = append(tIDs, tID)
+	}
+	sort.Slice(tIDs, func(i, j int) bool { return tIDs[i] < tIDs[j] })
+
+	t := maps.Tables{Topics: map[uint32][]maps.NodeDest{}, Nodes: map[uint32]map[uint32][]maps.SubDest{}}
+	rep := newCapReport()
+	for _, tID := range tIDs {
+		set := topicNodes[tID]
+		ct := idx.byID[tID]
+		limit := maps.MaxFanout
+		if ct != nil && ct.Spec.MaxFanout > 0 && ct.Spec.MaxFanout < limit { limit = ct.Spec.MaxFanout }
+		direct := ct != nil && ct.Spec.TierMode == kube.TierDirect
+		policy := defPolicy
+		if ct != nil && ct.Spec.OverflowPolicy != "" { policy = ct.Spec.OverflowPolicy }
+		tc := &topicCap{Policy: policy, State: capProgrammed, FanoutLimit: limit}
+		rep.Topics[tID] = tc
+		if ct != nil {
+			ct.Status.Nodes, ct.Status.Subscribers = len(set), len(topicMembers[tID])
+			ct.Status.Destinations, ct.Status.FanoutLimit, ct.Status.MaxLocalSubscribers = 0, limit, 0
+			ct.Status.ObservedGeneration = ct.Generation
+		}
+		reject := func(reason, msg string) {
+			tc.State = capRejected
+			if ct != nil {
+				setCond(&ct.Status.Conditions, ct.Generation, metav1.ConditionFalse, reason, msg+"; topic not programmed")
 			}
-			if _, ok := topicNodes[tID]; !ok { topicNodes[tID] = map[string]struct{}{} }
-			topicNodes[tID][p.Spec.NodeName] = struct{}{}
-			nodeSubs[p.Spec.NodeName] = append(nodeSubs[p.Spec.NodeName], p)
+			log.Printf("topic %d: %s, rejected", tID, msg)
 		}
 
-		// 3) 비활성 세대에 preload
-		var tmap, tcnt, nmap, ncnt *ebpf.Map
-		if inactive == 0 {
-			tmap, tcnt, nmap, ncnt = topics, tcnt0, nsubs0, ncnt0
-		} else {
-			tmap, tcnt, nmap, ncnt = topics1, tcnt1, nsubs1, ncnt1
-		}
-
-		// clear: 간단화 위해 전체 삭제(실험용)
-		_ = tmap.Close(); _ = tcnt.Close(); _ = nmap.Close(); _ = ncnt.Close()
-		// 재-open (clear는 bpftool 사용이 이상적이나, 여기선 재시작/재배포로 관리 권장)
-		topics = mustOpen("topic_to_node_set_gen0")
-		topics1 = mustOpen("topic_to_node_set_gen1")
-		tcnt0 = mustOpen("topic_fanout_cnt_gen0")
-		tcnt1 = mustOpen("topic_fanout_cnt_gen1")
-		nsubs0 = mustOpen("node_to_local_sub_gen0")
-		nsubs1 = mustOpen("node_to_local_sub_gen1")
-		ncnt0 = mustOpen("node_local_cnt_gen0")
-		ncnt1 = mustOpen("node_local_cnt_gen1")
-		if inactive == 0 {
-			tmap, tcnt, nmap, ncnt = topics, tcnt0, nsubs0, ncnt0
-		} else {
-			tmap, tcnt, nmap, ncnt = topics1, tcnt1, nsubs1, ncnt1
-		}
-
-		// topic → node inner
-		for tID, set := range topicNodes {
-			inner, err := ebpf.NewMap(&ebpf.MapSpec{
-				Type:       ebpf.Array,
-				KeySize:    4,
-				ValueSize:  12,
-				MaxEntries: 256, // MAX_FANOUT
-				Pinning:    ebpf.PinByName,
-				Name:       fmt.Sprintf("topic_%d_nodes", tID),
-			})
-			if err != nil { log.Fatalf("inner nodes: %v", err) }
-			i := uint32(0)
-			for n := range set {
-				nd := nodeDest{
-					NodeID: nodeID[n],
-					Daddr:  toNBO(nodeIP[n]),
-					Dport:  uint16(firstTierPort),
-				}
-				if err := inner.Update(&i, &nd, ebpf.UpdateAny); err != nil {
-					log.Fatalf("inner update: %v", err)
-				}
-				i++
+		// 1차: topic → 목적지 (hierarchical: 노드, direct: Pod)
+		var dests []maps.NodeDest
+		if direct {
+			for _, m := range topicMembers[tID] {
+				dests = append(dests, maps.NodeDest{NodeID: m.node, Dest: netip.AddrPortFrom(m.addr, uint16(m.port)), Direct: true})
 			}
-			if err := tmap.Update(&tID, inner.FD(), ebpf.UpdateAny); err != nil {
-				log.Fatalf("outer topic map update: %v", err)
+		} else {
+			for n, id := range set {
+				dests = append(dests, maps.NodeDest{NodeID: id, Dest: netip.AddrPortFrom(nodeIP[n][idx.family(tID)], firstTierPort)})
 			}
-			if err := tcnt.Update(&tID, &i, ebpf.UpdateAny); err != nil {
-				log.Fatalf("topic cnt: %v", err)
+		}
+		sort.Slice(dests, func(i, j int) bool {
+			if dests[i].NodeID != dests[j].NodeID { return dests[i].NodeID < dests[j].NodeID }
+			return dests[i].Dest.Compare(dests[j].Dest) < 0
+		})
+		tc.Fanout = len(dests)
+		if len(dests) > limit {
+			msg := fmt.Sprintf("%d destinations exceed fan-out limit %d", len(dests), limit)
+			if policy != kube.OverflowTruncate {
+				reject("FanoutExceeded", msg)
+				continue
 			}
+			tc.State, tc.DroppedDests = capTruncated, len(dests)-limit
+			dests = dests[:limit]
 		}
 
-		// node → local subs
-		for n, pods := range nodeSubs {
-			nid := nodeID[n]
-			inner, err := ebpf.NewMap(&ebpf.MapSpec{
-				Type:       ebpf.Array,
-				KeySize:    4,
-				ValueSize:  12,
-				MaxEntries: 512, // MAX_LOCAL_SUB
-				Pinning:    ebpf.PinByName,
-				Name:       fmt.Sprintf("node_%d_subs", nid),
-			})
-			if err != nil { log.Fatalf("inner subs: %v", err) }
-			for i := uint32(0); i < uint32(len(pods)); i++ {
-				p := pods[i]
-				port := getPodPort(p)
-				sd := subDest{
+		// 2차: (node, topic) → 로컬 구독자. 잘려 나간 노드의 집합은 만들지 않는다.
+		// direct 토픽은 1단으로 이미 Pod에 도달하므로 없음.
+		locals := map[uint32][]maps.SubDest{}
+		if !direct {
+			kept := map[uint32]bool{}
+			for _, d := range dests {
+				kept[d.NodeID] = true
+			}
+			for _, m := range topicMembers[tID] {
+				if !kept[m.node] { continue }
+				locals[m.node] = append(locals[m.node], maps.SubDest{
 					Ifindex: 0, // cfg.local_route_ifindex 사용
-					Daddr:   toNBO(p.Status.PodIP),
-					Dport:   uint16(port),
-				}
-				if err := inner.Update(&i, &sd, ebpf.UpdateAny); err != nil {
-					log.Fatalf("inner sub update: %v", err)
+					Dest:    netip.AddrPortFrom(m.addr, uint16(m.port)),
+				})
+			}
+		}
+		overflow := ""
+		for nID, subs := range locals {
+			sort.Slice(subs, func(i, j int) bool { return subs[i].Dest.Compare(subs[j].Dest) < 0 })
+			subs = dedupSubs(subs)
+			if len(subs) > tc.MaxLocal { tc.MaxLocal = len(subs) }
+			if len(subs) > maps.MaxLocalSub {
+				overflow = fmt.Sprintf("node %d has %d local subscribers, limit %d", nID, len(subs), maps.MaxLocalSub)
+				if policy == kube.OverflowTruncate {
+					tc.State, tc.DroppedSubs = capTruncated, tc.DroppedSubs+len(subs)-maps.MaxLocalSub
+					subs = subs[:maps.MaxLocalSub]
 				}
 			}
-			cnt := uint32(len(pods))
-			if err := nmap.Update(&nid, inner.FD(), ebpf.UpdateAny); err != nil {
-				log.Fatalf("outer node map update: %v", err)
+			locals[nID] = subs
+		}
+		if overflow != "" && policy != kube.OverflowTruncate {
+			reject("LocalSubscribersExceeded", overflow)
+			continue
+		}
+		if len(rep.Locals)+len(locals) > maps.MaxLocalSets {
+			reject("LocalSetsExhausted", fmt.Sprintf("%d more local sets exceed MAX_LOCAL_SETS=%d", len(locals), maps.MaxLocalSets))
+			continue
+		}
+
+		t.Topics[tID] = dests
+		for nID, subs := range locals {
+			if t.Nodes[nID] == nil { t.Nodes[nID] = map[uint32][]maps.SubDest{} }
+			t.Nodes[nID][tID] = subs
+			rep.Locals[maps.LocalKey{NodeID: nID, TopicID: tID}] = len(subs)
+		}
+		if ct != nil {
+			ct.Status.Destinations, ct.Status.MaxLocalSubscribers = len(dests), tc.MaxLocal
+			if tc.State == capTruncated {
+				setCond(&ct.Status.Conditions, ct.Generation, metav1.ConditionTrue, "Truncated",
+					fmt.Sprintf("over capacity, dropped %d destinations and %d local subscribers", tc.DroppedDests, tc.DroppedSubs))
+			} else {
+				msg := fmt.Sprintf("%d subscribers on %d nodes", ct.Status.Subscribers, ct.Status.Nodes)
+				if n := noAddr[tID]; n > 0 { msg += fmt.Sprintf(", %d without an %s address skipped", n, idx.family(tID)) }
+				setCond(&ct.Status.Conditions, ct.Generation, metav1.ConditionTrue, "Programmed", msg)
 			}
-			if err := ncnt.Update(&nid, &cnt, ebpf.UpdateAny); err != nil {
-				log.Fatalf("node cnt: %v", err)
+		}
+		if tc.State == capTruncated {
+			log.Printf("topic %d: truncated, dropped %d destinations and %d local subscribers", tID, tc.DroppedDests, tc.DroppedSubs)
+		}
+	}
+	return t, rep
+}
+
+// dedupSubs: 같은 토픽 집합 안에서 중복된 Pod/포트는 한 번만 (정렬된 입력)
+func dedupSubs(subs []maps.SubDest) []maps.SubDest {
+	out := subs[:0]
+	for i, s := range subs {
+		if i > 0 && s == subs[i-1] { continue }
+		out = append(out, s)
+	}
+	return out
+}
+
+// portFilter: loader에 실어 보낼 데이터패스 포트 필터 (api.Filter). tier-2 범위는 이 테이블의 구독자 포트
+// (로컬 집합, direct 목적지)를 모두 덮는 가장 좁은 범위라서 어떤 토픽 포트도 필터 밖으로 나가지 않는다.
+// 구독자가 없으면 tier-2 포트도 없다.
+func portFilter(t maps.Tables, firstTierPort uint16) api.Filter {
+	f := api.Filter{Tier1Port: firstTierPort}
+	add := func(p uint16) {
+		if f.Tier2PortMax == 0 {
+			f.Tier2PortMin, f.Tier2PortMax = p, p
+			return
+		}
+		f.Tier2PortMin, f.Tier2PortMax = min(f.Tier2PortMin, p), max(f.Tier2PortMax, p)
+	}
+	for _, dests := range t.Topics {
+		for _, nd := range dests {
+			if nd.Direct { add(nd.Dest.Port()) }
+		}
+	}
+	for _, byTopic := range t.Nodes {
+		for _, subs := range byTopic {
+			for _, sd := range subs {
+				add(sd.Dest.Port())
 			}
 		}
+	}
+	return f
+}
+
+// restConfig: -kubeconfig > in-cluster > 기본 kubeconfig 규칙($KUBECONFIG, ~/.kube/config)
+func restConfig(kubeconfig string) (*rest.Config, error) {
+	if kubeconfig != "" { return clientcmd.BuildConfigFromFlags("", kubeconfig) }
+	if cfg, err := rest.InClusterConfig(); err == nil { return cfg, nil }
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{}).ClientConfig()
+}
+
+func main() {
+	kubeconfig := flag.String("kubeconfig", "", "kubeconfig path (default: in-cluster, then $KUBECONFIG / ~/.kube/config)")
+	dry := flag.Bool("dry-run", false, "print desired tables and exit; writes nothing (exit 2 if there are warnings)")
+	format := flag.String("o", "json", "dry-run output format: json|yaml")
+	source := flag.String("source", "kubernetes", "topology source: kubernetes|file|registry")
+	topoFile := flag.String("topology", "", "file: topology YAML to watch; registry: initial contents (optional)")
+	registerAddr := flag.String("register", "127.0.0.1:9467", "registry: listen address of the HTTP registration endpoint (non-loopback needs -loader-token-file)")
+	conf, err := loadConfig(flag.CommandLine, os.Args[1:])
+	if err != nil { log.Fatalf("config: %v", err) }
+
+	policy := conf.OverflowPolicy
+
+	// client는 kubernetes 원천일 때만 (Event, Lease)
+	var client kubernetes.Interface
+	var src topology.Source
+	switch *source {
+	case "kubernetes":
+		cfg, err := restConfig(*kubeconfig)
+		if err != nil { log.Fatalf("kube: %v", err) }
+		cs, err := kubernetes.NewForConfig(cfg)
+		if err != nil { log.Fatalf("kube client: %v", err) }
+		dyn, err := dynamic.NewForConfig(cfg)
+		if err != nil { log.Fatalf("dynamic client: %v", err) }
+		client = cs
+		src = &topology.Kubernetes{Client: cs, Dyn: dyn,
+			Namespaces: conf.subscriberNamespaces(), SubscriberSelector: conf.SubscriberSelector,
+			LoaderNamespace: conf.Namespace, LoaderSelector: conf.LoaderSelector, LoaderPort: conf.LoaderPort}
+	case "file":
+		if *topoFile == "" { log.Fatalf("-source file needs -topology FILE") }
+		src = topology.NewFile(*topoFile, filePollInterval)
+	case "registry":
+		var initial *topology.Spec
+		if *topoFile != "" {
+			spec, err := topology.ReadSpec(*topoFile)
+			if err != nil { log.Fatalf("topology: %v", err) }
+			initial = spec
+		}
+		reg, err := topology.NewRegistry(initial)
+		if err != nil { log.Fatalf("topology: %v", err) }
+		src = reg
+	default:
+		log.Fatalf("-source %q: want kubernetes|file|registry", *source)
+	}
+
+	if *dry {
+		r := &reconciler{src: src, policy: policy, firstTierPort: uint16(conf.FirstTierPort), subscriberPort: conf.SubscriberPort,
+			ipFamily: v1.IPFamily(conf.IPFamily), members: membership{grace: conf.TerminatingGrace.Duration}}
+		warn, err := dryRun(context.Background(), r, conf.PinRoot, *format, os.Stdout)
+		if err != nil { log.Fatalf("dry-run: %v", err) }
+		if warn { os.Exit(2) }
+		return
+	}
+
+	var rec record.EventRecorder = logRecorder{}
+	if client != nil {
+		bc := record.NewBroadcaster()
+		bc.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+		rec = bc.NewRecorder(scheme.Scheme, v1.EventSource{Component: "psbench-controller"})
+	}
+	metricsAddr := os.Getenv("PS_METRICS_ADDR")
+	if metricsAddr == "" { metricsAddr = ":9466" }
+	capm := &capMetrics{}
+	ls := &leaderState{identity: leaderIdentity()}
+	h := newHealth()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		capm.ServeHTTP(w, req)
+		ls.writeMetrics(w)
+	})
+	mux.Handle("/healthz", h)
+	go func() { log.Printf("metrics server: %v", http.ListenAndServe(metricsAddr, mux)) }()
+
+	var token string
+	if conf.LoaderTokenFile != "" {
+		token, err = api.ReadToken(conf.LoaderTokenFile)
+		if err != nil { log.Fatalf("loader token: %v", err) }
+	}
+	// 등록 내용은 곧 데이터패스 테이블이고 loader URL로 토큰이 나가므로 loader API와 같은 토큰을 요구한다
+	if reg, ok := src.(*topology.Registry); ok {
+		if token == "" && !api.LoopbackOnly([]string{*registerAddr}) { log.Fatalf("-register %s needs -loader-token-file (or bind to loopback only)", *registerAddr) }
+		go func() { log.Printf("registration server: %v", http.ListenAndServe(*registerAddr, reg.Handler(token))) }()
+	}
+	r := &reconciler{src: src, rec: rec, policy: policy, capm: capm, loaderToken: token,
+		firstTierPort: uint16(conf.FirstTierPort), subscriberPort: conf.SubscriberPort,
+		ipFamily: v1.IPFamily(conf.IPFamily), members: membership{grace: conf.TerminatingGrace.Duration}}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	if f, ok := src.(*topology.File); ok { go f.Run(ctx) }
+	if client == nil {
+		// Lease가 없으므로 단일 인스턴스 전제: term 0으로 push (K8s 리더가 쓰던 loader는 409로 거부한다)
+		log.Printf("topology source %s: no leader election, single instance", src.Name())
+		ls.set(func(s *leaderState) { s.leader, s.holder, s.since = true, s.identity, time.Now() })
+		r.loop(ctx, 0, h)
+		return
+	}
+	// 리더만 reconcile. 종료 시 lease를 놓아 다른 replica가 바로 이어받는다(ReleaseOnCancel).
+	lease := metav1.ObjectMeta{Name: conf.LeaseName, Namespace: conf.Namespace}
+	runLeader(ctx, client, lease, ls, func(ctx context.Context, term uint64) {
+		r.loop(ctx, term, h)
+		h.standby()
+	})
+}
+
+// logRecorder: K8s 밖 원천에서는 Event 대신 로그 (record.EventRecorder)
+type logRecorder struct{}
+
+func (logRecorder) Event(obj runtime.Object, typ, reason, msg string) {
+	name := "?"
+	if m, err := meta.Accessor(obj); err == nil { name = m.GetName() }
+	log.Printf("%s %s: %s: %s", typ, name, reason, msg)
+}
+
+func (l logRecorder) Eventf(obj runtime.Object, typ, reason, format string, args ...interface{}) {
+	l.Event(obj, typ, reason, fmt.Sprintf(format, args...))
+}
 
-		// 4) flip
-		if err := active.Update(&k, &inactive, ebpf.UpdateAny); err != nil {
-			log.Fatalf("flip: %v", err)
+func (l logRecorder) AnnotatedEventf(obj runtime.Object, _ map[string]string, typ, reason, format string, args ...interface{}) {
+	l.Eventf(obj, typ, reason, format, args...)
+}
+
+// loop: 리더십(ctx)이 유지되는 동안 주기적으로 reconcile. 원천이 변경을 알리면(topology.Notifier) 바로 다시 돈다.
+// API 서버/loader 오류로 죽지 않는다: 실패하면 백오프 후 처음부터 다시 계산한다.
+func (r *reconciler) loop(ctx context.Context, term uint64, h *health) {
+	var changed <-chan struct{}
+	if n, ok := r.src.(topology.Notifier); ok { changed = n.Changed() }
+	backoff := retryMin
+	for ctx.Err() == nil {
+		rep, err := r.once(ctx, term)
+		if ctx.Err() != nil { return } // 리더십 상실로 중단된 결과는 기록하지 않음
+		h.record(rep, err, time.Now())
+		wait := resyncInterval
+		if err != nil {
+			wait = backoff
+			log.Printf("reconcile failed: %v (retry in %s)", err, wait)
+			backoff *= 2
+			if backoff > retryMax { backoff = retryMax }
+		} else {
+			backoff = retryMin
 		}
-		log.Printf("flipped active_gen=%d", inactive)
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		case <-changed:
+		}
+	}
+}
 
-		time.Sleep(5 * time.Second)
+type reconciler struct {
+	src    topology.Source
+	rec    record.EventRecorder
+	policy string
+	capm   *capMetrics
+	// 0이면 기본값 (defaultFirstTierPort, defaultSubscriberPort)
+	firstTierPort  uint16
+	subscriberPort int
+	ipFamily       v1.IPFamily // 비면 clusterFamily (family.go)
+	members        membership  // readiness/종료 상태 필터 (membership.go)
+	loaderToken    string      // loader API Bearer 토큰 (pkg/api/auth.go)
+}
+
+// desired: 한 번 계산한 desired state와 status 갱신에 필요한 부산물
+type desired struct {
+	tables  maps.Tables
+	filter  api.Filter
+	version string
+	rep     capReport
+	nodeID  map[string]uint32
+	topics  []kube.PubSubTopic
+	subs    []kube.PubSubSubscription
+	loaders map[string]string
+	before  statusSnap
+}
+
+// compute: 원천을 읽기만 해서 desired를 계산한다 (쓰기는 r.rec 이벤트뿐).
+func (r *reconciler) compute(ctx context.Context) (*desired, error) {
+	snap, err := r.src.Snapshot(ctx)
+	if err != nil {
+		var te *topology.Error
+		if errors.As(err, &te) { return nil, &stageError{te.Stage, te.Err} }
+		return nil, &stageError{"topology", err}
 	}
+	nodeID, nodeIP := indexNodes(snap.Nodes)
+	d := &desired{nodeID: nodeID, topics: snap.Topics, subs: snap.Subscriptions, loaders: snap.Loaders,
+		before: snapStatuses(snap.Topics, snap.Subscriptions)}
+	idx := indexTopics(d.topics)
+	idx.defaultPort = r.subscriberPort
+	idx.defaultFamily = r.ipFamily
+	if idx.defaultFamily == "" { idx.defaultFamily = clusterFamily(snap.Nodes) }
+	firstTier := r.firstTierPort
+	if firstTier == 0 { firstTier = defaultFirstTierPort }
+	members := resolveMembers(r.members.filter(snap.Pods, r.rec), idx, d.subs, r.rec)
+	d.tables, d.rep = buildTables(members, idx, nodeID, nodeIP, r.policy, firstTier)
+	d.filter = portFilter(d.tables, firstTier)
+	d.version = d.tables.Version()
+	return d, nil
+}
+
+// once: 한 번의 reconcile. 원천 조회 실패는 *stageError, 노드별 push 실패는 pushReport에 담긴다.
+func (r *reconciler) once(ctx context.Context, term uint64) (pushReport, error) {
+	// 1) 원천에서 subscriber 수집 → desired 계산 (한 번)
+	d, err := r.compute(ctx)
+	if err != nil { return pushReport{}, err }
+	r.capm.set(d.rep, d.nodeID)
+	if sw, ok := r.src.(topology.StatusWriter); ok { writeStatuses(ctx, sw, d.before, d.topics, d.subs) }
+	if err := d.tables.Validate(); err != nil {
+		// buildTables가 한도를 지키므로 여기 오면 버그: 이전 세대를 유지
+		return pushReport{}, &stageError{"build_tables", fmt.Errorf("version %s: %w", d.version, err)}
+	}
+
+	// 2) apply → ack → flip (loader 주소는 원천이 준다)
+	return pushAll(ctx, d.loaders, r.loaderToken, d.nodeID, d.tables, &d.filter, d.version, term), nil
 }
@@ -0,0 +1,84 @@
+package main
+
+// 구독자 멤버십: readiness와 종료 상태를 따른다. 죽은 엔드포인트로 복제하면 그대로 tier-2 비용이 된다.
+// 멤버가 되려면 PodIP/NodeName이 있고, Running, 실패한 컨테이너가 없고, Ready=True.
+// 종료 중(DeletionTimestamp) Pod는 삭제 요청 후 -terminating-grace 동안만 멤버로 남아 drain한다 (기본 0: 바로 제외).
+// kubelet은 종료를 시작하면 곧바로 Ready=False로 바꾸므로 종료/유예를 readiness보다 먼저 본다.
+// 유예는 이미 멤버였던 Pod에만 적용한다 (Ready가 된 적 없이 삭제되는 Pod는 합류시키지 않는다).
+// 유예가 끝나는 시점은 다음 resync가 반영한다.
+//
+// 전환은 Pod Event로 남긴다 (처음 보는 Pod는 비멤버에서 시작):
+//   SubscriberJoined (Normal)    비멤버 → 멤버
+//   SubscriberDraining (Normal)  멤버 → 종료 중 유예
+//   SubscriberRemoved (Warning)  멤버/유예 → 비멤버, 메시지에 사유 (NotReady, Terminating, ContainerFailed, ...)
+
+import (
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	memberActive   = "Active"
+	memberDraining = "Draining"
+)
+
+// membership: 직전 reconcile의 Pod별 상태. 0값으로 쓸 수 있다 (유예 0, time.Now).
+type membership struct {
+	grace time.Duration
+	now   func() time.Time
+	state map[string]string // namespace/name → memberActive | memberDraining | 제외 사유
+}
+
+// podState: memberActive, memberDraining 또는 제외 사유
+func podState(p *v1.Pod, now time.Time, grace time.Duration) string {
+	if p.Status.PodIP == "" || p.Spec.NodeName == "" { return "NoAddress" }
+	if p.Status.Phase != v1.PodRunning { return "NotRunning" }
+	for _, cs := range p.Status.ContainerStatuses {
+		if w := cs.State.Waiting; w != nil && w.Reason == "CrashLoopBackOff" { return "ContainerFailed" }
+		if t := cs.State.Terminated; t != nil && t.ExitCode != 0 { return "ContainerFailed" }
+	}
+	if p.DeletionTimestamp != nil {
+		// DeletionTimestamp = 삭제 요청 시각 + 종료 유예(DeletionGracePeriodSeconds)
+		requested := p.DeletionTimestamp.Time
+		if s := p.DeletionGracePeriodSeconds; s != nil { requested = requested.Add(-time.Duration(*s) * time.Second) }
+		if now.Before(requested.Add(grace)) { return memberDraining }
+		return "Terminating"
+	}
+	ready := false
+	for _, c := range p.Status.Conditions {
+		if c.Type == v1.PodReady { ready = c.Status == v1.ConditionTrue }
+	}
+	if !ready { return "NotReady" }
+	return memberActive
+}
+
+// filter: 멤버인 Pod만 돌려주고 전환을 rec에 기록한다. 사라진 Pod는 잊는다.
+func (m *membership) filter(pods []v1.Pod, rec record.EventRecorder) []v1.Pod {
+	now := time.Now()
+	if m.now != nil { now = m.now() }
+	next := make(map[string]string, len(pods))
+	var out []v1.Pod
+	for i := range pods {
+		p := &pods[i]
+		key := nsName(p.Namespace, p.Name)
+		st := podState(p, now, m.grace)
+		prev, seen := m.state[key]
+		wasMember := seen && (prev == memberActive || prev == memberDraining)
+		if st == memberDraining && !wasMember { st = "Terminating" }
+		next[key] = st
+		member := st == memberActive || st == memberDraining
+		if member { out = append(out, *p) }
+		switch {
+		case member && !wasMember:
+			rec.Eventf(p, v1.EventTypeNormal, "SubscriberJoined", "added to topic fan-out")
+		case st == memberDraining && prev == memberActive:
+			rec.Eventf(p, v1.EventTypeNormal, "SubscriberDraining", "terminating, kept in fan-out for %s", m.grace)
+		case !member && wasMember:
+			rec.Eventf(p, v1.EventTypeWarning, "SubscriberRemoved", "removed from topic fan-out: %s", st)
+		}
+	}
+	m.state = next
+	return out
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestPodState(t *testing.T) {
+	now := time.Unix(10000, 0)
+	thirty := int64(30)
+	deleting := func(ago time.Duration) func(*v1.Pod) {
+		return func(p *v1.Pod) {
+			// 30초 유예로 ago 전에 삭제 요청
+			ts := metav1.NewTime(now.Add(-ago + 30*time.Second))
+			p.DeletionTimestamp, p.DeletionGracePeriodSeconds = &ts, &thirty
+		}
+	}
+	for _, tc := range []struct {
+		name  string
+		edit  func(*v1.Pod)
+		grace time.Duration
+		want  string
+	}{
+		{"ready", func(*v1.Pod) {}, 0, memberActive},
+		{"no ip", func(p *v1.Pod) { p.Status.PodIP = "" }, 0, "NoAddress"},
+		{"pending", func(p *v1.Pod) { p.Status.Phase = v1.PodPending }, 0, "NotRunning"},
+		{"not ready", func(p *v1.Pod) { p.Status.Conditions[0].Status = v1.ConditionFalse }, 0, "NotReady"},
+		{"no ready condition", func(p *v1.Pod) { p.Status.Conditions = nil }, 0, "NotReady"},
+		{"crash loop", func(p *v1.Pod) {
+			p.Status.ContainerStatuses = []v1.ContainerStatus{{State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}}}
+		}, 0, "ContainerFailed"},
+		{"exited non-zero", func(p *v1.Pod) {
+			p.Status.ContainerStatuses = []v1.ContainerStatus{{State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 137}}}}
+		}, 0, "ContainerFailed"},
+		{"terminating, no grace", deleting(time.Second), 0, "Terminating"},
+		{"terminating within grace", deleting(time.Second), 5 * time.Second, memberDraining},
+		{"terminating past grace", deleting(6 * time.Second), 5 * time.Second, "Terminating"},
+		// kubelet이 종료 시작과 함께 Ready=False로 바꾼 상태
+		{"terminating and not ready within grace", func(p *v1.Pod) {
+			deleting(time.Second)(p)
+			p.Status.Conditions[0].Status = v1.ConditionFalse
+		}, 5 * time.Second, memberDraining},
+		{"terminating and not ready past grace", func(p *v1.Pod) {
+			deleting(6 * time.Second)(p)
+			p.Status.Conditions[0].Status = v1.ConditionFalse
+		}, 5 * time.Second, "Terminating"},
+	} {
+		p := subPod("s", "n0", "10.1.0.1", nil)
+		tc.edit(&p)
+		if got := podState(&p, now, tc.grace); got != tc.want {
+			t.Errorf("%s: %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+// 전환마다 Event 하나. 상태가 그대로면 Event 없음.
+func TestMembershipTransitions(t *testing.T) {
+	now := time.Unix(10000, 0)
+	m := membership{grace: 5 * time.Second, now: func() time.Time { return now }}
+	rec := record.NewFakeRecorder(16)
+	step := func(want int, pods ...v1.Pod) []string {
+		t.Helper()
+		if got := m.filter(pods, rec); len(got) != want {
+			t.Errorf("%d members, want %d", len(got), want)
+		}
+		var events []string
+		for len(rec.Events) > 0 {
+			events = append(events, <-rec.Events)
+		}
+		return events
+	}
+
+	a, b := subPod("a", "n0", "10.1.0.1", nil), subPod("b", "n0", "", nil)
+	if ev := step(1, a, b); len(ev) != 1 || !strings.Contains(ev[0], "Normal SubscriberJoined") {
+		t.Errorf("first pass: %q, want a joined (b has no address yet)", ev)
+	}
+	if ev := step(1, a, b); ev != nil {
+		t.Errorf("unchanged pass: %q", ev)
+	}
+
+	b.Status.PodIP = "10.1.0.2"
+	ts := metav1.NewTime(now)
+	a.DeletionTimestamp = &ts
+	a.Status.Conditions[0].Status = v1.ConditionFalse // kubelet이 종료와 함께 NotReady로 바꾼다
+	ev := step(2, a, b)
+	if len(ev) != 2 || !strings.Contains(ev[0], "SubscriberDraining") || !strings.Contains(ev[1], "SubscriberJoined") {
+		t.Errorf("a terminating, b ready: %q", ev)
+	}
+
+	now = now.Add(6 * time.Second)
+	b.Status.Conditions[0].Status = v1.ConditionFalse
+	ev = step(0, a, b)
+	if len(ev) != 2 || !strings.Contains(ev[0], "Warning SubscriberRemoved removed from topic fan-out: Terminating") ||
+		!strings.Contains(ev[1], "Warning SubscriberRemoved removed from topic fan-out: NotReady") {
+		t.Errorf("grace over, b not ready: %q", ev)
+	}
+
+	// 사라진 Pod는 잊는다: 같은 이름으로 다시 나타나면 새로 합류
+	step(0)
+	if ev := step(1, subPod("a", "n0", "10.1.0.9", nil)); len(ev) != 1 || !strings.Contains(ev[0], "SubscriberJoined") {
+		t.Errorf("recreated pod: %q", ev)
+	}
+}
+
+// Ready가 된 적 없이 삭제되는 Pod는 유예 중이라도 합류하지 않는다.
+func TestMembershipDrainOnlyMembers(t *testing.T) {
+	now := time.Unix(10000, 0)
+	m := membership{grace: 5 * time.Second, now: func() time.Time { return now }}
+	rec := record.NewFakeRecorder(16)
+	p := subPod("a", "n0", "10.1.0.1", nil)
+	p.Status.Conditions[0].Status = v1.ConditionFalse
+	if got := m.filter([]v1.Pod{p}, rec); len(got) != 0 {
+		t.Fatalf("not ready pod is a member")
+	}
+	ts := metav1.NewTime(now)
+	p.DeletionTimestamp = &ts
+	if got := m.filter([]v1.Pod{p}, rec); len(got) != 0 {
+		t.Errorf("never-ready terminating pod joined for drain")
+	}
+	if len(rec.Events) != 0 {
+		t.Errorf("events: %q", <-rec.Events)
+	}
+}
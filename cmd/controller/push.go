@@ -0,0 +1,134 @@
+package main
+
+// loader push: 모든 노드에 같은 desired를 apply하고, ack한 노드만 flip.
+// apply가 실패한 노드의 비활성 세대는 일부만 쓰였을 수 있지만 플립하지 않으므로 데이터패스는
+// 이전 세대를 계속 쓴다. 실패한 노드는 다음 주기에 다시 시도된다(이미 같은 version이 활성인 노드는 건너뜀).
+// 4xx(잘못된 테이블, staged 아님, 낡은 term)는 재시도하지 않는다(api.Retry).
+// 포트 필터(portFilter)는 테이블과 같이 실어 보내 플립 때 함께 바뀐다.
+// term은 리더 펜싱 토큰(leader.go). ctx가 취소되면(리더십 상실) flip 단계로 가지 않는다.
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yourorg/psbench/pkg/api"
+	"github.com/yourorg/psbench/pkg/maps"
+)
+
+const (
+	pushAttempts = 3
+	pushBackoff  = 200 * time.Millisecond
+)
+
+type pushResult struct {
+	node    string
+	skipped bool
+	err     error
+}
+
+// nodeFailure: 이번 push에서 새 version을 받지 못한 노드. Phase: no_loader | apply | flip
+type nodeFailure struct {
+	Node  string `json:"node"`
+	Phase string `json:"phase"`
+	Error string `json:"error"`
+}
+
+type pushReport struct {
+	Version string        `json:"version"`
+	Flipped int           `json:"flipped"`
+	Current int           `json:"current"` // 이미 같은 version이 활성
+	Failed  []nodeFailure `json:"failed,omitempty"`
+}
+
+func pushAll(ctx context.Context, loaders map[string]string, token string, nodeID map[string]uint32, t maps.Tables, f *api.Filter, version string, term uint64) pushReport {
+	rep := pushReport{Version: version}
+	clients := map[string]*api.Client{}
+	for n := range nodeID {
+		base, ok := loaders[n]
+		if !ok {
+			rep.Failed = append(rep.Failed, nodeFailure{Node: n, Phase: "no_loader", Error: "no running loader pod"})
+			continue
+		}
+		clients[n] = api.NewClient(base)
+		clients[n].Token = token
+	}
+
+	// phase 1: apply (비활성 세대 preload)
+	applied := fanout(clients, func(n string, c *api.Client) pushResult {
+		if st, err := c.Status(ctx); err == nil && st.ActiveVersion == version && st.NodeID == nodeID[n] {
+			return pushResult{node: n, skipped: true}
+		}
+		err := api.Retry(ctx, pushAttempts, pushBackoff, func() error {
+			_, err := c.Apply(ctx, api.ApplyRequest{Version: version, NodeID: nodeID[n], Term: term, Tables: t, Filter: f})
+			return err
+		})
+		return pushResult{node: n, err: err}
+	})
+
+	// phase 2: ack한 노드만 flip
+	acked := map[string]*api.Client{}
+	for _, r := range applied {
+		switch {
+		case r.skipped:
+			rep.Current++
+		case r.err != nil:
+			log.Printf("node %s: apply %s failed: %v", r.node, version, r.err)
+			rep.Failed = append(rep.Failed, nodeFailure{Node: r.node, Phase: "apply", Error: r.err.Error()})
+		default:
+			acked[r.node] = clients[r.node]
+		}
+	}
+	if ctx.Err() != nil {
+		log.Printf("version %s: leadership lost after apply, %d staged nodes not flipped", version, len(acked))
+		for n := range acked {
+			rep.Failed = append(rep.Failed, nodeFailure{Node: n, Phase: "flip", Error: "leadership lost"})
+		}
+		acked = nil
+	}
+	flipped := fanout(acked, func(n string, c *api.Client) pushResult {
+		err := api.Retry(ctx, pushAttempts, pushBackoff, func() error {
+			if err := ctx.Err(); err != nil { return api.Permanent(err) }
+			_, err := c.Flip(ctx, version, term)
+			return err
+		})
+		return pushResult{node: n, err: err}
+	})
+	for _, r := range flipped {
+		if r.err != nil {
+			log.Printf("node %s: flip %s failed: %v", r.node, version, r.err)
+			rep.Failed = append(rep.Failed, nodeFailure{Node: r.node, Phase: "flip", Error: r.err.Error()})
+			continue
+		}
+		rep.Flipped++
+	}
+	if len(acked) > 0 {
+		log.Printf("version %s: flipped %d/%d nodes (%d already current)", version, rep.Flipped, len(nodeID), rep.Current)
+	}
+	sort.Slice(rep.Failed, func(i, j int) bool { return rep.Failed[i].Node < rep.Failed[j].Node })
+	return rep
+}
+
+// fanout: 노드별 fn을 병렬 실행, 노드명 순으로 결과 반환.
+func fanout(clients map[string]*api.Client, fn func(string, *api.Client) pushResult) []pushResult {
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		out []pushResult
+	)
+	for n, c := range clients {
+		wg.Add(1)
+		go func(n string, c *api.Client) {
+			defer wg.Done()
+			r := fn(n, c)
+			mu.Lock()
+			out = append(out, r)
+			mu.Unlock()
+		}(n, c)
+	}
+	wg.Wait()
+	sort.Slice(out, func(i, j int) bool { return out[i].node < out[j].node })
+	return out
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yourorg/psbench/pkg/api"
+	"github.com/yourorg/psbench/pkg/maps"
+)
+
+// fakeLoader: pkg/api 서버 흉내. applyCode가 200이 아니면 apply를 그 코드로 거부한다.
+// dp가 있으면 loader처럼 비활성 세대에 쓰고 flip에서 m_cfg(active_gen, local_node_id, 포트 필터)를 바꾼다.
+type fakeLoader struct {
+	applyCode      int
+	onApply        func()
+	applies, flips atomic.Int32
+	dp             *maps.Fake
+
+	mu             sync.Mutex
+	active, staged string
+	stagedNode     uint32
+	stagedFilter   *api.Filter
+}
+
+func (f *fakeLoader) start(t *testing.T) string {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/status", func(w http.ResponseWriter, _ *http.Request) {
+		st := api.Status{}
+		if f.dp != nil {
+			c, _ := f.dp.Config()
+			f.mu.Lock()
+			st = api.Status{NodeID: c.LocalNodeID, ActiveGen: c.ActiveGen, ActiveVersion: f.active}
+			f.mu.Unlock()
+		}
+		json.NewEncoder(w).Encode(st)
+	})
+	mux.HandleFunc("/v1/tables", func(w http.ResponseWriter, r *http.Request) {
+		f.applies.Add(1)
+		if f.onApply != nil {
+			f.onApply()
+		}
+		if f.applyCode != http.StatusOK {
+			w.WriteHeader(f.applyCode)
+			json.NewEncoder(w).Encode(api.Error{Error: "injected", Op: "local"})
+			return
+		}
+		var req api.ApplyRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if f.dp != nil {
+			active, _ := f.dp.ActiveGen()
+			if err := f.dp.WriteGeneration(1-active, req.Tables); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(api.Error{Error: err.Error()})
+				return
+			}
+		}
+		f.mu.Lock()
+		f.staged, f.stagedNode, f.stagedFilter = req.Version, req.NodeID, req.Filter
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(api.Ack{Version: req.Version})
+	})
+	mux.HandleFunc("/v1/flip", func(w http.ResponseWriter, _ *http.Request) {
+		f.flips.Add(1)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.dp != nil {
+			f.dp.UpdateConfig(func(c *maps.Config) {
+				c.ActiveGen, c.LocalNodeID = 1-c.ActiveGen, f.stagedNode
+				if sf := f.stagedFilter; sf != nil {
+					c.Tier1Port, c.Tier2PortMin, c.Tier2PortMax = sf.Tier1Port, sf.Tier2PortMin, sf.Tier2PortMax
+				}
+			})
+		}
+		f.active, f.staged = f.staged, ""
+		json.NewEncoder(w).Encode(api.Ack{Version: f.active})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestPushAllAbandonsFailedNodes(t *testing.T) {
+	good := &fakeLoader{applyCode: http.StatusOK}
+	flaky := &fakeLoader{applyCode: http.StatusServiceUnavailable}
+	invalid := &fakeLoader{applyCode: http.StatusUnprocessableEntity}
+	loaders := map[string]string{"a": good.start(t), "b": flaky.start(t), "c": invalid.start(t)}
+	nodeID := map[string]uint32{"a": 0, "b": 1, "c": 2, "d": 3}
+
+	rep := pushAll(context.Background(), loaders, "", nodeID, maps.Tables{}, nil, "v1", 1)
+
+	if rep.Flipped != 1 || good.flips.Load() != 1 {
+		t.Errorf("flipped %d (good flips %d), want 1", rep.Flipped, good.flips.Load())
+	}
+	if flaky.flips.Load() != 0 || invalid.flips.Load() != 0 {
+		t.Errorf("flipped a node whose apply failed")
+	}
+	if got := flaky.applies.Load(); got != pushAttempts {
+		t.Errorf("503 apply attempted %d times, want %d", got, pushAttempts)
+	}
+	if got := invalid.applies.Load(); got != 1 {
+		t.Errorf("422 apply attempted %d times, want 1 (not retryable)", got)
+	}
+	want := []nodeFailure{{Node: "b", Phase: "apply"}, {Node: "c", Phase: "apply"}, {Node: "d", Phase: "no_loader"}}
+	if len(rep.Failed) != len(want) {
+		t.Fatalf("failed = %+v, want %+v", rep.Failed, want)
+	}
+	for i, w := range want {
+		if rep.Failed[i].Node != w.Node || rep.Failed[i].Phase != w.Phase {
+			t.Errorf("failed[%d] = %+v, want %s/%s", i, rep.Failed[i], w.Node, w.Phase)
+		}
+	}
+}
+
+// apply 도중 리더십을 잃으면(ctx 취소) 어떤 노드도 flip하지 않는다.
+func TestPushAllNoFlipAfterLeadershipLost(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l := &fakeLoader{applyCode: http.StatusOK, onApply: cancel}
+	rep := pushAll(ctx, map[string]string{"a": l.start(t)}, "", map[string]uint32{"a": 0}, maps.Tables{}, nil, "v1", 1)
+	if l.flips.Load() != 0 || rep.Flipped != 0 {
+		t.Errorf("flipped %d nodes after leadership was lost", l.flips.Load())
+	}
+	// 취소 시점에 따라 apply 요청 자체가 끊기거나(apply) flip 직전에 멈춘다(flip)
+	if len(rep.Failed) != 1 || rep.Failed[0].Node != "a" {
+		t.Errorf("failed = %+v, want node a", rep.Failed)
+	}
+}
+
+func TestHealthStates(t *testing.T) {
+	h := newHealth()
+	now := time.Now()
+	steps := []struct {
+		rep  pushReport
+		err  error
+		want string
+	}{
+		{pushReport{Flipped: 2}, nil, healthOK},
+		{pushReport{Flipped: 1, Failed: []nodeFailure{{Node: "b", Phase: "apply"}}}, nil, healthDegraded},
+		{pushReport{}, &stageError{"list_pods", errors.New("apiserver down")}, healthDegraded},
+		{pushReport{}, fmt.Errorf("reconcile: %w", &stageError{"list_pods", errors.New("apiserver down")}), healthDegraded},
+		{pushReport{}, &stageError{"list_pods", errors.New("apiserver down")}, healthFailed},
+		{pushReport{Current: 2}, nil, healthOK},
+	}
+	for i, s := range steps {
+		h.record(s.rep, s.err, now)
+		st := h.status()
+		if st.State != s.want {
+			t.Fatalf("step %d: state %s, want %s", i, st.State, s.want)
+		}
+		if s.err != nil && (st.LastError == nil || st.LastError.Stage != "list_pods") {
+			t.Errorf("step %d: last error %+v, want stage list_pods", i, st.LastError)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	h.record(pushReport{}, errors.New("x"), now)
+	h.record(pushReport{}, errors.New("x"), now)
+	h.record(pushReport{}, errors.New("x"), now)
+	h.ServeHTTP(rr, nil)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("failed health served %d, want 503", rr.Code)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+// reconcile 한 번을 끝까지: fake clientset(노드/Pod/CR) 또는 토폴로지 파일 → desired → fake loader(maps.Fake)에 apply/flip.
+// 노드마다 활성 세대를 되읽어 기대 테이블과 비교한다.
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/yourorg/psbench/pkg/kube"
+	"github.com/yourorg/psbench/pkg/maps"
+	"github.com/yourorg/psbench/pkg/topology"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/json"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+// withLoaders: loader 주소만 httptest 서버로 바꾼다 (status 쓰기는 그대로)
+type withLoaders struct {
+	*topology.Kubernetes
+	urls map[string]string
+}
+
+func (w withLoaders) Snapshot(ctx context.Context) (*topology.Snapshot, error) {
+	snap, err := w.Kubernetes.Snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	snap.Loaders = w.urls
+	return snap, nil
+}
+
+func testNode(i int) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("n%d", i)},
+		Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: fmt.Sprintf("192.168.0.1%d", i)}}},
+	}
+}
+
+// labeledPod: app=subscriber Pod. ann이 nil이면 토픽은 PubSubSubscription으로만 정해진다.
+func labeledPod(name, node, ip string, labels, ann map[string]string) *v1.Pod {
+	p := subPod(name, node, ip, ann)
+	p.Namespace = defaultNamespace
+	p.Labels = map[string]string{"app": "subscriber"}
+	for k, v := range labels {
+		p.Labels[k] = v
+	}
+	return &p
+}
+
+func notReady(p *v1.Pod) *v1.Pod {
+	p.Status.Conditions[0].Status = v1.ConditionFalse
+	return p
+}
+
+func terminating(p *v1.Pod) *v1.Pod {
+	now := metav1.Now()
+	p.DeletionTimestamp = &now
+	return p
+}
+
+func toUnstructured(t *testing.T, kind string, obj any) *unstructured.Unstructured {
+	var m map[string]interface{}
+	b, _ := json.Marshal(obj)
+	if err := json.Unmarshal(b, &m); err != nil { // kube.updateStatus와 같은 변환 (int64 숫자)
+		t.Fatal(err)
+	}
+	u := &unstructured.Unstructured{Object: m}
+	u.SetAPIVersion(kube.Group + "/" + kube.Version)
+	u.SetKind(kind)
+	u.SetNamespace(defaultNamespace)
+	return u
+}
+
+func dests(nodes ...uint32) []maps.NodeDest {
+	var out []maps.NodeDest
+	for _, n := range nodes {
+		out = append(out, maps.NodeDest{NodeID: n, Dest: netip.AddrPortFrom(netip.AddrFrom4([4]byte{192, 168, 0, 10 + byte(n)}), defaultFirstTierPort)})
+	}
+	return out
+}
+
+func TestReconcile(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		nodes    int
+		pods     []*v1.Pod
+		topics   []kube.PubSubTopic
+		subs     []kube.PubSubSubscription
+		noLoader map[string]bool
+		want     maps.Tables       // loader가 있는 모든 노드의 활성 세대
+		failed   []string          // node/phase
+		reasons  map[string]string // CR 이름 → Ready reason
+	}{
+		{
+			name:  "annotations",
+			nodes: 2,
+			pods: []*v1.Pod{
+				labeledPod("s1", "n0", "10.1.0.1", nil, map[string]string{topicsAnnotation: "1"}),
+				labeledPod("s2", "n1", "10.1.1.1", nil, map[string]string{topicsAnnotation: "1,2:31002"}),
+				labeledPod("legacy", "n1", "10.1.1.2", nil, nil), // 토픽 지정 없음 → topic 1
+			},
+			want: maps.Tables{
+				Topics: map[uint32][]maps.NodeDest{1: dests(0, 1), 2: dests(1)},
+				Nodes: map[uint32]map[uint32][]maps.SubDest{
+					0: {1: {{Dest: netip.MustParseAddrPort("10.1.0.1:31001")}}},
+					1: {
+						1: {{Dest: netip.MustParseAddrPort("10.1.1.1:31001")}, {Dest: netip.MustParseAddrPort("10.1.1.2:31001")}},
+						2: {{Dest: netip.MustParseAddrPort("10.1.1.1:31002")}},
+					},
+				},
+			},
+		},
+		{
+			name:  "subscription selects pods",
+			nodes: 2,
+			pods: []*v1.Pod{
+				labeledPod("o1", "n0", "10.1.0.1", map[string]string{"role": "orders"}, nil),
+				labeledPod("o2", "n1", "10.1.1.1", map[string]string{"role": "orders"}, nil),
+			},
+			topics: []kube.PubSubTopic{{ObjectMeta: metav1.ObjectMeta{Name: "orders"}, Spec: kube.TopicSpec{ID: 7, Port: 31007}}},
+			subs: []kube.PubSubSubscription{
+				{ObjectMeta: metav1.ObjectMeta{Name: "orders-all"}, Spec: kube.SubscriptionSpec{
+					Topic: "orders", Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"role": "orders"}}}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "dangling"}, Spec: kube.SubscriptionSpec{
+					Topic: "nope", Selector: &metav1.LabelSelector{}}},
+			},
+			want: maps.Tables{
+				Topics: map[uint32][]maps.NodeDest{7: dests(0, 1)},
+				Nodes: map[uint32]map[uint32][]maps.SubDest{
+					0: {7: {{Dest: netip.MustParseAddrPort("10.1.0.1:31007")}}},
+					1: {7: {{Dest: netip.MustParseAddrPort("10.1.1.1:31007")}}},
+				},
+			},
+			reasons: map[string]string{"orders": "Programmed", "orders-all": "Resolved", "dangling": "TopicNotFound"},
+		},
+		{
+			name:  "fan-out over limit is rejected",
+			nodes: 3,
+			pods: []*v1.Pod{
+				labeledPod("a", "n0", "10.1.0.1", nil, map[string]string{topicsAnnotation: "5,1"}),
+				labeledPod("b", "n1", "10.1.1.1", nil, map[string]string{topicsAnnotation: "5"}),
+				labeledPod("c", "n2", "10.1.2.1", nil, map[string]string{topicsAnnotation: "5"}),
+			},
+			topics: []kube.PubSubTopic{{ObjectMeta: metav1.ObjectMeta{Name: "t"}, Spec: kube.TopicSpec{ID: 5, MaxFanout: 2}}},
+			want: maps.Tables{
+				Topics: map[uint32][]maps.NodeDest{1: dests(0)},
+				Nodes:  map[uint32]map[uint32][]maps.SubDest{0: {1: {{Dest: netip.MustParseAddrPort("10.1.0.1:31001")}}}},
+			},
+			reasons: map[string]string{"t": "FanoutExceeded"},
+		},
+		{
+			name:  "only ready, non-terminating pods",
+			nodes: 2,
+			pods: []*v1.Pod{
+				labeledPod("up", "n0", "10.1.0.1", nil, map[string]string{topicsAnnotation: "4"}),
+				notReady(labeledPod("warming", "n1", "10.1.1.1", nil, map[string]string{topicsAnnotation: "4"})),
+				terminating(labeledPod("leaving", "n1", "10.1.1.2", nil, map[string]string{topicsAnnotation: "4"})),
+			},
+			want: maps.Tables{
+				Topics: map[uint32][]maps.NodeDest{4: dests(0)},
+				Nodes:  map[uint32]map[uint32][]maps.SubDest{0: {4: {{Dest: netip.MustParseAddrPort("10.1.0.1:31001")}}}},
+			},
+		},
+		{
+			name:  "node without loader",
+			nodes: 2,
+			pods: []*v1.Pod{
+				labeledPod("s1", "n0", "10.1.0.1", nil, map[string]string{topicsAnnotation: "3"}),
+				labeledPod("s2", "n1", "10.1.1.1", nil, map[string]string{topicsAnnotation: "3"}),
+			},
+			noLoader: map[string]bool{"n1": true},
+			want: maps.Tables{
+				Topics: map[uint32][]maps.NodeDest{3: dests(0, 1)},
+				Nodes: map[uint32]map[uint32][]maps.SubDest{
+					0: {3: {{Dest: netip.MustParseAddrPort("10.1.0.1:31001")}}},
+					1: {3: {{Dest: netip.MustParseAddrPort("10.1.1.1:31001")}}},
+				},
+			},
+			failed: []string{"n1/no_loader"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var objs []runtime.Object
+			for i := 0; i < tc.nodes; i++ {
+				objs = append(objs, testNode(i))
+			}
+			for _, p := range tc.pods {
+				objs = append(objs, p)
+			}
+			var crs []runtime.Object
+			for i := range tc.topics {
+				crs = append(crs, toUnstructured(t, "PubSubTopic", &tc.topics[i]))
+			}
+			for i := range tc.subs {
+				crs = append(crs, toUnstructured(t, "PubSubSubscription", &tc.subs[i]))
+			}
+			dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+				kube.TopicGVR:        "PubSubTopicList",
+				kube.SubscriptionGVR: "PubSubSubscriptionList",
+			}, crs...)
+
+			loaders := map[string]*fakeLoader{}
+			urls := map[string]string{}
+			for i := 0; i < tc.nodes; i++ {
+				n := fmt.Sprintf("n%d", i)
+				if tc.noLoader[n] {
+					continue
+				}
+				loaders[n] = &fakeLoader{applyCode: 200, dp: maps.NewFake()}
+				urls[n] = loaders[n].start(t)
+			}
+			src := &topology.Kubernetes{Client: fake.NewSimpleClientset(objs...), Dyn: dyn, Namespaces: []string{defaultNamespace}, SubscriberSelector: "app=subscriber"}
+			r := &reconciler{
+				src:    withLoaders{src, urls},
+				rec:    record.NewFakeRecorder(100),
+				policy: kube.OverflowReject,
+				capm:   &capMetrics{},
+			}
+
+			ctx := context.Background()
+			rep, err := r.once(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var failed []string
+			for _, f := range rep.Failed {
+				failed = append(failed, f.Node+"/"+f.Phase)
+			}
+			if fmt.Sprint(failed) != fmt.Sprint(tc.failed) || rep.Flipped != len(loaders) {
+				t.Errorf("report %+v, want %d flipped and failed %v", rep, len(loaders), tc.failed)
+			}
+			for n, l := range loaders {
+				c, _ := l.dp.Config()
+				if want := uint32(n[1] - '0'); c.LocalNodeID != want {
+					t.Errorf("%s: local_node_id %d, want %d", n, c.LocalNodeID, want)
+				}
+				got, err := l.dp.ReadGeneration(c.ActiveGen)
+				if err != nil {
+					t.Fatalf("%s: %v", n, err)
+				}
+				if d := maps.Diff(got, tc.want); d != nil {
+					t.Errorf("%s: active gen differs from want:\n%v", n, d)
+				}
+			}
+
+			conds := map[string]string{}
+			topics, _ := kube.ListTopics(ctx, dyn, defaultNamespace)
+			for _, x := range topics {
+				if c := meta.FindStatusCondition(x.Status.Conditions, kube.CondReady); c != nil {
+					conds[x.Name] = c.Reason
+				}
+			}
+			subs, _ := kube.ListSubscriptions(ctx, dyn, defaultNamespace)
+			for _, x := range subs {
+				if c := meta.FindStatusCondition(x.Status.Conditions, kube.CondReady); c != nil {
+					conds[x.Name] = c.Reason
+				}
+			}
+			for name, reason := range tc.reasons {
+				if conds[name] != reason {
+					t.Errorf("%s: Ready reason %q, want %q", name, conds[name], reason)
+				}
+			}
+
+			// 같은 클러스터 상태로 다시 돌리면 모든 노드가 이미 최신: apply 없음
+			applies := map[string]int32{}
+			for n, l := range loaders {
+				applies[n] = l.applies.Load()
+			}
+			rep, err = r.once(ctx, 1)
+			if err != nil || rep.Current != len(loaders) || rep.Flipped != 0 {
+				t.Errorf("second reconcile: %+v (err %v), want all %d current", rep, err, len(loaders))
+			}
+			var again []string
+			for n, l := range loaders {
+				if l.applies.Load() != applies[n] {
+					again = append(again, n)
+				}
+			}
+			sort.Strings(again)
+			if again != nil {
+				t.Errorf("re-applied unchanged version to %v", again)
+			}
+		})
+	}
+}
+
+// 같은 reconcile이 토폴로지 파일로도 돈다: 파일을 바꾸면 다음 reconcile이 새 세대로 플립한다.
+func TestReconcileFileSource(t *testing.T) {
+	a := &fakeLoader{applyCode: 200, dp: maps.NewFake()}
+	b := &fakeLoader{applyCode: 200, dp: maps.NewFake()}
+	urlA, urlB := a.start(t), b.start(t)
+	path := filepath.Join(t.TempDir(), "topology.yaml")
+	write := func(subs string) {
+		t.Helper()
+		spec := fmt.Sprintf(`nodes:
+  - {name: vm1, ip: 192.168.0.11, loader: %q}
+  - {name: vm0, ip: 192.168.0.10, loader: %q}
+topics:
+  - {name: orders, id: 7, port: 31007}
+subscriptions:
+  - {name: orders-all, topic: orders, selector: {matchLabels: {role: orders}}}
+subscribers:
+%s`, urlB, urlA, subs)
+		if err := os.WriteFile(path, []byte(spec), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`  - {name: s1, node: vm0, ip: 10.1.0.1, topics: ["1"]}
+  - {name: s2, node: vm1, ip: 10.1.1.1, port: 31002, labels: {role: orders}}
+`)
+	r := &reconciler{src: topology.NewFile(path, time.Hour), rec: record.NewFakeRecorder(10), policy: kube.OverflowReject, capm: &capMetrics{}}
+
+	// tier2: 플립과 함께 바뀌어야 하는 tier-2 포트 범위 (구독자 포트를 모두 덮는 최소 범위)
+	check := func(want maps.Tables, tier2 [2]uint16) {
+		t.Helper()
+		rep, err := r.once(context.Background(), 0)
+		if err != nil || rep.Flipped != 2 || rep.Failed != nil {
+			t.Fatalf("report %+v (err %v), want both flipped", rep, err)
+		}
+		for i, l := range []*fakeLoader{a, b} {
+			c, _ := l.dp.Config()
+			got, err := l.dp.ReadGeneration(c.ActiveGen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.LocalNodeID != uint32(i) {
+				t.Errorf("vm%d: local_node_id %d", i, c.LocalNodeID)
+			}
+			if c.Tier1Port != defaultFirstTierPort || [2]uint16{c.Tier2PortMin, c.Tier2PortMax} != tier2 {
+				t.Errorf("vm%d: filter tier1=%d tier2=%d-%d, want %d, %v", i, c.Tier1Port, c.Tier2PortMin, c.Tier2PortMax, defaultFirstTierPort, tier2)
+			}
+			if d := maps.Diff(got, want); d != nil {
+				t.Errorf("vm%d: active gen differs from want:\n%v", i, d)
+			}
+		}
+	}
+	check(maps.Tables{
+		Topics: map[uint32][]maps.NodeDest{1: dests(0), 7: dests(1)},
+		Nodes: map[uint32]map[uint32][]maps.SubDest{
+			0: {1: {{Dest: netip.MustParseAddrPort("10.1.0.1:31001")}}},
+			1: {7: {{Dest: netip.MustParseAddrPort("10.1.1.1:31007")}}},
+		},
+	}, [2]uint16{31001, 31007})
+
+	write(`  - {name: s2, node: vm1, ip: 10.1.1.1, port: 31002, topics: ["1"]}
+`)
+	// 같은 초 안의 쓰기도 감지되도록 mtime을 옮긴다
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	// File은 두 번 연속 같은 mtime/크기를 본 뒤에 다시 읽는다: Run의 폴링 한 번을 대신한다
+	if snap, _ := r.src.Snapshot(context.Background()); len(snap.Pods) != 2 {
+		t.Fatalf("file reloaded on first sight: %d pods", len(snap.Pods))
+	}
+	check(maps.Tables{
+		Topics: map[uint32][]maps.NodeDest{1: dests(1)},
+		Nodes:  map[uint32]map[uint32][]maps.SubDest{1: {1: {{Dest: netip.MustParseAddrPort("10.1.1.1:31002")}}}},
+	}, [2]uint16{31002, 31002})
+}
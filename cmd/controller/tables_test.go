@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/yourorg/psbench/pkg/kube"
+	"github.com/yourorg/psbench/pkg/maps"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/record"
+)
+
+func subPod(name, node, ip string, ann map[string]string) v1.Pod {
+	return v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: ann},
+		Spec:       v1.PodSpec{NodeName: node},
+		Status: v1.PodStatus{PodIP: ip, Phase: v1.PodRunning,
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}},
+	}
+}
+
+// 같은 노드에 topic 1, topic 2 구독자가 섞여 있어도 로컬 집합은 토픽별로 분리돼야 한다.
+func TestBuildTablesLocalSetsPerTopic(t *testing.T) {
+	pods := []v1.Pod{
+		subPod("s1", "n0", "10.1.0.1", map[string]string{topicsAnnotation: "1"}),
+		subPod("s2", "n0", "10.1.0.2", map[string]string{topicsAnnotation: "2"}),
+		subPod("s12", "n0", "10.1.0.3", map[string]string{topicsAnnotation: "1:31001,2:31002"}),
+		subPod("s2b", "n1", "10.1.1.1", map[string]string{topicsAnnotation: "2"}),
+	}
+	idx := indexTopics(nil)
+	members := resolveMembers(pods, idx, nil, record.NewFakeRecorder(16))
+	nodeID := map[string]uint32{"n0": 0, "n1": 1}
+	nodeIP := map[string]addrs{"n0": {v1.IPv4Protocol: netip.MustParseAddr("192.168.0.10")}, "n1": {v1.IPv4Protocol: netip.MustParseAddr("192.168.0.11")}}
+	tb, _ := buildTables(members, idx, nodeID, nodeIP, kube.OverflowReject, defaultFirstTierPort)
+
+	want := map[uint32]map[uint32][]maps.SubDest{
+		0: {
+			1: {{Dest: netip.MustParseAddrPort("10.1.0.1:31001")}, {Dest: netip.MustParseAddrPort("10.1.0.3:31001")}},
+			2: {{Dest: netip.MustParseAddrPort("10.1.0.2:31001")}, {Dest: netip.MustParseAddrPort("10.1.0.3:31002")}},
+		},
+		1: {
+			2: {{Dest: netip.MustParseAddrPort("10.1.1.1:31001")}},
+		},
+	}
+	if len(tb.Nodes) != len(want) {
+		t.Fatalf("nodes = %v, want %v", tb.Nodes, want)
+	}
+	for nID, byTopic := range want {
+		if len(tb.Nodes[nID]) != len(byTopic) {
+			t.Fatalf("node %d: topics = %v, want %v", nID, tb.Nodes[nID], byTopic)
+		}
+		for tID, subs := range byTopic {
+			got := tb.Nodes[nID][tID]
+			if len(got) != len(subs) {
+				t.Fatalf("node %d topic %d: subs = %v, want %v", nID, tID, got, subs)
+			}
+			for i := range subs {
+				if got[i] != subs[i] {
+					t.Errorf("node %d topic %d [%d] = %+v, want %+v", nID, tID, i, got[i], subs[i])
+				}
+			}
+		}
+	}
+
+	// topic 1은 topic-2 전용 구독자가 있는 n1로 가면 안 된다
+	for _, nd := range tb.Topics[1] {
+		if nd.NodeID == 1 {
+			t.Errorf("topic 1 fans out to node 1, which has no topic-1 subscribers")
+		}
+	}
+}
+
+// nodeID에 없는 노드의 구독자는 node 0으로 읽혀 섞이면 안 된다 (hierarchical, direct 모두).
+func TestBuildTablesUnknownNode(t *testing.T) {
+	pods := []v1.Pod{
+		subPod("a", "n1", "10.1.1.1", map[string]string{topicsAnnotation: "1,d"}),
+		subPod("x", "ghost", "10.1.9.1", map[string]string{topicsAnnotation: "1,d"}),
+	}
+	idx := indexTopics([]kube.PubSubTopic{
+		{ObjectMeta: metav1.ObjectMeta{Name: "d"}, Spec: kube.TopicSpec{ID: 7, TierMode: kube.TierDirect}},
+	})
+	nodeID := map[string]uint32{"n0": 0, "n1": 1}
+	nodeIP := map[string]addrs{"n0": {v1.IPv4Protocol: netip.MustParseAddr("192.168.0.10")}, "n1": {v1.IPv4Protocol: netip.MustParseAddr("192.168.0.11")}}
+	tb, _ := buildTables(resolveMembers(pods, idx, nil, record.NewFakeRecorder(16)), idx, nodeID, nodeIP, kube.OverflowReject, defaultFirstTierPort)
+	if err := tb.Validate(); err != nil {
+		t.Fatalf("tables fail validation: %v", err)
+	}
+
+	want := maps.Tables{
+		Topics: map[uint32][]maps.NodeDest{
+			1: {{NodeID: 1, Dest: netip.MustParseAddrPort("192.168.0.11:32000")}},
+			7: {{NodeID: 1, Dest: netip.MustParseAddrPort("10.1.1.1:31001"), Direct: true}},
+		},
+		Nodes: map[uint32]map[uint32][]maps.SubDest{
+			1: {1: {{Dest: netip.MustParseAddrPort("10.1.1.1:31001")}}},
+		},
+	}
+	if d := maps.Diff(want, tb); d != nil {
+		t.Errorf("tables differ from want:\n%s", strings.Join(d, "\n"))
+	}
+	if s := idx.byID[7].Status.Subscribers; s != 1 {
+		t.Errorf("topic 7 subscribers = %d, want 1", s)
+	}
+}
+
+// overflowFixture: maxFanout=2 토픽 "t" (id 5) 구독자가 노드 3개에 하나씩,
+// 그리고 n0에 MAX_LOCAL_SUB+1 명의 topic 6 구독자
+func overflowFixture(policy string) ([]kube.PubSubTopic, []v1.Pod, map[string]uint32, map[string]addrs) {
+	topics := []kube.PubSubTopic{
+		{ObjectMeta: metav1.ObjectMeta{Name: "t"}, Spec: kube.TopicSpec{ID: 5, MaxFanout: 2, OverflowPolicy: policy}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "big"}, Spec: kube.TopicSpec{ID: 6, OverflowPolicy: policy}},
+	}
+	nodeID := map[string]uint32{"n0": 0, "n1": 1, "n2": 2}
+	nodeIP := map[string]addrs{"n0": {v1.IPv4Protocol: netip.MustParseAddr("192.168.0.10")}, "n1": {v1.IPv4Protocol: netip.MustParseAddr("192.168.0.11")}, "n2": {v1.IPv4Protocol: netip.MustParseAddr("192.168.0.12")}}
+	var pods []v1.Pod
+	for n, id := range nodeID {
+		pods = append(pods, subPod("t-"+n, n, fmt.Sprintf("10.1.%d.1", id), map[string]string{topicsAnnotation: "t"}))
+	}
+	for i := 0; i <= maps.MaxLocalSub; i++ {
+		pods = append(pods, subPod(fmt.Sprintf("big-%d", i), "n0", fmt.Sprintf("10.2.%d.%d", i/250, i%250+1), map[string]string{topicsAnnotation: "big"}))
+	}
+	return topics, pods, nodeID, nodeIP
+}
+
+func TestBuildTablesOverflowReject(t *testing.T) {
+	topics, pods, nodeID, nodeIP := overflowFixture("")
+	idx := indexTopics(topics)
+	tb, rep := buildTables(resolveMembers(pods, idx, nil, record.NewFakeRecorder(16)), idx, nodeID, nodeIP, kube.OverflowReject, defaultFirstTierPort)
+	if err := tb.Validate(); err != nil {
+		t.Fatalf("tables fail validation: %v", err)
+	}
+	for _, tc := range []struct {
+		topic  uint32
+		reason string
+	}{
+		{5, "FanoutExceeded"},
+		{6, "LocalSubscribersExceeded"},
+	} {
+		if _, ok := tb.Topics[tc.topic]; ok {
+			t.Errorf("topic %d programmed despite overflow", tc.topic)
+		}
+		if rep.Topics[tc.topic].State != capRejected {
+			t.Errorf("topic %d: state %s, want %s", tc.topic, rep.Topics[tc.topic].State, capRejected)
+		}
+		c := meta.FindStatusCondition(idx.byID[tc.topic].Status.Conditions, kube.CondReady)
+		if c == nil || c.Status != metav1.ConditionFalse || c.Reason != tc.reason {
+			t.Errorf("topic %d: condition %+v, want Ready=False/%s", tc.topic, c, tc.reason)
+		}
+	}
+	for nID, byTopic := range tb.Nodes {
+		if len(byTopic) != 0 {
+			t.Errorf("node %d: local sets %v for rejected topics", nID, byTopic)
+		}
+	}
+}
+
+func TestBuildTablesOverflowTruncate(t *testing.T) {
+	topics, pods, nodeID, nodeIP := overflowFixture(kube.OverflowTruncate)
+	idx := indexTopics(topics)
+	tb, rep := buildTables(resolveMembers(pods, idx, nil, record.NewFakeRecorder(16)), idx, nodeID, nodeIP, kube.OverflowReject, defaultFirstTierPort)
+	if err := tb.Validate(); err != nil {
+		t.Fatalf("tables fail validation: %v", err)
+	}
+
+	// 1차: 노드 ID 순으로 앞의 2개만, 잘린 노드(n2)에는 로컬 집합도 없음
+	if got := tb.Topics[5]; len(got) != 2 || got[0].NodeID != 0 || got[1].NodeID != 1 {
+		t.Errorf("topic 5 dests = %+v, want nodes 0 and 1", got)
+	}
+	if _, ok := tb.Nodes[2][5]; ok {
+		t.Errorf("truncated node 2 still has a topic 5 local set")
+	}
+	if tc := rep.Topics[5]; tc.State != capTruncated || tc.DroppedDests != 1 || tc.Fanout != 3 {
+		t.Errorf("topic 5 report = %+v", tc)
+	}
+
+	// 2차: n0의 topic 6 집합은 MAX_LOCAL_SUB로 잘림
+	if got := len(tb.Nodes[0][6]); got != maps.MaxLocalSub {
+		t.Errorf("node 0 topic 6: %d subs, want %d", got, maps.MaxLocalSub)
+	}
+	if tc := rep.Topics[6]; tc.State != capTruncated || tc.DroppedSubs != 1 || tc.MaxLocal != maps.MaxLocalSub+1 {
+		t.Errorf("topic 6 report = %+v", tc)
+	}
+	st := idx.byID[6].Status
+	c := meta.FindStatusCondition(st.Conditions, kube.CondReady)
+	if c == nil || c.Status != metav1.ConditionTrue || c.Reason != "Truncated" {
+		t.Errorf("topic 6 condition %+v, want Ready=True/Truncated", c)
+	}
+	if st.MaxLocalSubscribers != maps.MaxLocalSub+1 || st.Destinations != 1 {
+		t.Errorf("topic 6 status = %+v", st)
+	}
+}
+
+// 토픽 이름과 Subscription은 네임스페이스 안에서만 풀린다. 포트는 env > UDP containerPort > 기본값.
+func TestResolveMembersNamespaces(t *testing.T) {
+	topic := func(ns string, id uint32) kube.PubSubTopic {
+		return kube.PubSubTopic{ObjectMeta: metav1.ObjectMeta{Name: "orders", Namespace: ns}, Spec: kube.TopicSpec{ID: id}}
+	}
+	idx := indexTopics([]kube.PubSubTopic{topic("a", 7), topic("b", 8)})
+	idx.defaultPort = 31500
+	subs := []kube.PubSubSubscription{{
+		ObjectMeta: metav1.ObjectMeta{Name: "all", Namespace: "a"},
+		Spec:       kube.SubscriptionSpec{Topic: "orders", Selector: &metav1.LabelSelector{}},
+	}}
+
+	pa := subPod("s", "n0", "10.1.0.1", nil)
+	pa.Namespace = "a"
+	pa.Spec.Containers = []v1.Container{{Ports: []v1.ContainerPort{
+		{ContainerPort: 9000, Protocol: v1.ProtocolTCP},
+		{ContainerPort: 31007, Protocol: v1.ProtocolUDP},
+	}}}
+	pb := subPod("s", "n0", "10.1.0.2", map[string]string{topicsAnnotation: "orders"})
+	pb.Namespace = "b"
+	pc := subPod("env", "n0", "10.1.0.3", map[string]string{topicsAnnotation: "orders"})
+	pc.Namespace = "b"
+	pc.Spec.Containers = []v1.Container{{
+		Env:   []v1.EnvVar{{Name: kube.PortEnv, Value: "31009"}},
+		Ports: []v1.ContainerPort{{ContainerPort: 31008, Protocol: v1.ProtocolUDP}},
+	}}
+
+	var got []string
+	for _, m := range resolveMembers([]v1.Pod{pa, pb, pc}, idx, subs, record.NewFakeRecorder(16)) {
+		got = append(got, fmt.Sprintf("%s/%s topic %d port %d", m.pod.Namespace, m.pod.Name, m.topic, m.port))
+	}
+	want := []string{"a/s topic 7 port 31007", "b/s topic 8 port 31500", "b/env topic 8 port 31009"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("members = %q, want %q", got, want)
+	}
+	if subs[0].Status.MatchedPods != 1 {
+		t.Errorf("subscription in namespace a matched %d pods, want 1", subs[0].Status.MatchedPods)
+	}
+}
+
+// dual-stack: 토픽마다 한 family. 그 family 주소가 없는 노드/구독자는 그 토픽에서만 빠진다.
+func TestBuildTablesDualStack(t *testing.T) {
+	dual := func(name, node, v4, v6 string, ann string) v1.Pod {
+		p := subPod(name, node, v4, map[string]string{topicsAnnotation: ann})
+		p.Status.PodIPs = []v1.PodIP{{IP: v4}}
+		if v6 != "" {
+			p.Status.PodIPs = append(p.Status.PodIPs, v1.PodIP{IP: v6})
+		}
+		return p
+	}
+	pods := []v1.Pod{
+		dual("a", "n0", "10.1.0.1", "fd00:10:1::1", "1,v6"),
+		dual("b", "n1", "10.1.1.1", "fd00:10:1:1::1", "1,v6"), // n1은 IPv4 전용 노드
+		dual("c", "n0", "10.1.0.2", "", "v6"),                 // IPv4 전용 Pod
+	}
+	idx := indexTopics([]kube.PubSubTopic{
+		{ObjectMeta: metav1.ObjectMeta{Name: "v6"}, Spec: kube.TopicSpec{ID: 6, IPFamily: "IPv6"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "bad"}, Spec: kube.TopicSpec{ID: 9, IPFamily: "IPv5"}},
+	})
+	nodes := []v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "n1"}, Status: v1.NodeStatus{Addresses: []v1.NodeAddress{
+			{Type: v1.NodeInternalIP, Address: "192.168.0.11"}}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "n0"}, Status: v1.NodeStatus{Addresses: []v1.NodeAddress{
+			{Type: v1.NodeExternalIP, Address: "203.0.113.10"},
+			{Type: v1.NodeInternalIP, Address: "fd00::10"},
+			{Type: v1.NodeInternalIP, Address: "192.168.0.10"}}}},
+	}
+	nodeID, nodeIP := indexNodes(nodes)
+	if f := clusterFamily(nodes); f != v1.IPv6Protocol {
+		t.Errorf("clusterFamily = %s, want IPv6 (first InternalIP of n0)", f)
+	}
+	idx.defaultFamily = v1.IPv4Protocol
+	tb, _ := buildTables(resolveMembers(pods, idx, nil, record.NewFakeRecorder(16)), idx, nodeID, nodeIP, kube.OverflowReject, defaultFirstTierPort)
+	if err := tb.Validate(); err != nil {
+		t.Fatalf("tables fail validation: %v", err)
+	}
+
+	want := maps.Tables{
+		Topics: map[uint32][]maps.NodeDest{
+			1: {{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")}, {NodeID: 1, Dest: netip.MustParseAddrPort("192.168.0.11:32000")}},
+			6: {{NodeID: 0, Dest: netip.MustParseAddrPort("[fd00::10]:32000")}},
+		},
+		Nodes: map[uint32]map[uint32][]maps.SubDest{
+			0: {1: {{Dest: netip.MustParseAddrPort("10.1.0.1:31001")}}, 6: {{Dest: netip.MustParseAddrPort("[fd00:10:1::1]:31001")}}},
+			1: {1: {{Dest: netip.MustParseAddrPort("10.1.1.1:31001")}}},
+		},
+	}
+	if d := maps.Diff(want, tb); d != nil {
+		t.Errorf("tables differ from want:\n%s", strings.Join(d, "\n"))
+	}
+	c := meta.FindStatusCondition(idx.byID[6].Status.Conditions, kube.CondReady)
+	if c == nil || c.Reason != "Programmed" || !strings.Contains(c.Message, "2 without an IPv6 address") {
+		t.Errorf("topic 6 condition %+v, want Programmed noting 2 skipped subscribers", c)
+	}
+	if _, ok := idx.byID[9]; ok {
+		t.Errorf("topic with ipFamily IPv5 indexed")
+	}
+}
+
+// 포트 필터는 direct 목적지와 로컬 구독자의 포트를 모두 덮고, 1차 목적지 포트는 tier-1로만 간다.
+func TestPortFilter(t *testing.T) {
+	tb := maps.Tables{
+		Topics: map[uint32][]maps.NodeDest{
+			1: {{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")}},
+			2: {{NodeID: 1, Dest: netip.MustParseAddrPort("10.1.1.1:31500"), Direct: true}},
+		},
+		Nodes: map[uint32]map[uint32][]maps.SubDest{
+			0: {1: {{Dest: netip.MustParseAddrPort("10.1.0.1:31007")}, {Dest: netip.MustParseAddrPort("10.1.0.2:31001")}}},
+		},
+	}
+	f := portFilter(tb, 32000)
+	if f.Tier1Port != 32000 || f.Tier2PortMin != 31001 || f.Tier2PortMax != 31500 {
+		t.Errorf("filter = %+v, want tier1 32000, tier2 31001-31500", f)
+	}
+	if f := portFilter(maps.Tables{Topics: map[uint32][]maps.NodeDest{1: tb.Topics[1]}}, 32100); f.Tier1Port != 32100 || f.Tier2PortMax != 0 {
+		t.Errorf("no subscribers: filter = %+v, want tier1 32100 and no tier-2 ports", f)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+// 토픽 멤버십 해석: Pod 어노테이션/라벨 + PubSubSubscription → (pod, topic, port) 목록.
+// - 어노테이션 ps/topics: "1:31001,2:31002,orders" (토픽별 포트는 선택)
+// - 라벨 ps/topic: "1" 또는 여러 개 "1_2_orders" (라벨 값에는 콤마를 쓸 수 없어 '_'로 구분)
+//   어노테이션이 있으면 라벨은 무시한다
+// - 각 토픽은 숫자 topic ID 또는 Pod와 같은 네임스페이스의 PubSubTopic 이름. 해석 불가 항목은 Pod에 Warning 이벤트 후 제외
+//   (topic ID는 데이터패스 전역이므로 네임스페이스가 달라도 ID가 겹치면 DuplicateID)
+// - PubSubSubscription은 같은 네임스페이스의 토픽과 Pod만 잇는다
+// - 아무것도 없고 구독에도 안 걸린 subscriber Pod는 기존 규칙대로 topic 1
+// - 포트 우선순위: Subscription.port > 어노테이션 포트 > Topic.port > env PS_UDP_PORT > UDP containerPort > -subscriber-port
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/yourorg/psbench/pkg/kube"
+	"github.com/yourorg/psbench/pkg/maps"
+	"github.com/yourorg/psbench/pkg/topology"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	topicLabel       = kube.TopicLabel
+	topicsAnnotation = kube.TopicsAnnotation
+)
+
+type member struct {
+	pod   *v1.Pod
+	topic uint32
+	port  int
+	addr  netip.Addr // 토픽 family의 Pod 주소 (buildTables가 채운다)
+	node  uint32     // Pod 노드의 node ID (buildTables가 채운다)
+}
+
+type topicIndex struct {
+	byName        map[string]*kube.PubSubTopic // namespace/name
+	byID          map[uint32]*kube.PubSubTopic
+	defaultPort   int         // 0이면 defaultSubscriberPort
+	defaultFamily v1.IPFamily // 비면 IPv4
+}
+
+func nsName(ns, name string) string { return ns + "/" + name }
+
+func indexTopics(ts []kube.PubSubTopic) topicIndex {
+	idx := topicIndex{byName: map[string]*kube.PubSubTopic{}, byID: map[uint32]*kube.PubSubTopic{}}
+	for i := range ts {
+		t := &ts[i]
+		if t.Spec.ID >= maps.MaxTopics {
+			setCond(&t.Status.Conditions, t.Generation, metav1.ConditionFalse, "InvalidID",
+				fmt.Sprintf("id %d out of range (max %d)", t.Spec.ID, maps.MaxTopics-1))
+			continue
+		}
+		if o, dup := idx.byID[t.Spec.ID]; dup {
+			setCond(&t.Status.Conditions, t.Generation, metav1.ConditionFalse, "DuplicateID",
+				fmt.Sprintf("id %d already used by %s", t.Spec.ID, nsName(o.Namespace, o.Name)))
+			continue
+		}
+		switch t.Spec.TierMode {
+		case "", kube.TierHierarchical, kube.TierDirect:
+		default:
+			setCond(&t.Status.Conditions, t.Generation, metav1.ConditionFalse, "InvalidTierMode",
+				fmt.Sprintf("tierMode %q (want %s|%s)", t.Spec.TierMode, kube.TierHierarchical, kube.TierDirect))
+			continue
+		}
+		if f := t.Spec.IPFamily; f != "" && !validFamily(v1.IPFamily(f)) {
+			setCond(&t.Status.Conditions, t.Generation, metav1.ConditionFalse, "InvalidIPFamily",
+				fmt.Sprintf("ipFamily %q (want %s|%s)", f, v1.IPv4Protocol, v1.IPv6Protocol))
+			continue
+		}
+		if p := t.Spec.OverflowPolicy; p != "" && !validPolicy(p) {
+			setCond(&t.Status.Conditions, t.Generation, metav1.ConditionFalse, "InvalidOverflowPolicy",
+				fmt.Sprintf("overflowPolicy %q (want %s|%s)", p, kube.OverflowReject, kube.OverflowTruncate))
+			continue
+		}
+		// 구독자가 없으면 buildTables가 건드리지 않으므로 여기서 기본 상태를 둔다
+		t.Status.Nodes, t.Status.Subscribers = 0, 0
+		t.Status.Destinations, t.Status.FanoutLimit, t.Status.MaxLocalSubscribers = 0, 0, 0
+		t.Status.ObservedGeneration = t.Generation
+		setCond(&t.Status.Conditions, t.Generation, metav1.ConditionTrue, "NoSubscribers", "no subscribers")
+		idx.byName[nsName(t.Namespace, t.Name)] = t
+		idx.byID[t.Spec.ID] = t
+	}
+	return idx
+}
+
+// parseTopicLabel: 숫자 ID 또는 ns의 PubSubTopic 이름
+func (idx topicIndex) parseTopicLabel(ns, v string) (uint32, error) {
+	if x, err := strconv.ParseUint(v, 10, 32); err == nil {
+		if x >= maps.MaxTopics { return 0, fmt.Errorf("topic %d out of range (max %d)", x, maps.MaxTopics-1) }
+		return uint32(x), nil
+	}
+	if t, ok := idx.byName[nsName(ns, v)]; ok { return t.Spec.ID, nil }
+	return 0, fmt.Errorf("%q is neither a topic id nor a PubSubTopic name", v)
+}
+
+type topicPort struct {
+	topic uint32
+	port  int // 0 = 기본 규칙
+}
+
+// podTopics: Pod가 직접 선언한 토픽 목록. 선언이 없으면 ok=false.
+// 해석 불가 항목은 errs로 돌려주고 나머지는 그대로 쓴다.
+func (idx topicIndex) podTopics(p *v1.Pod) (out []topicPort, errs []error, ok bool) {
+	var entries []string
+	if v, has := p.Annotations[topicsAnnotation]; has {
+		entries = strings.Split(v, ",")
+	} else if v, has := p.Labels[topicLabel]; has {
+		entries = strings.FieldsFunc(v, func(r rune) bool { return r == '_' || r == ',' })
+	} else {
+		return nil, nil, false
+	}
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" { continue }
+		name, portStr, hasPort := strings.Cut(e, ":")
+		tID, err := idx.parseTopicLabel(p.Namespace, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		tp := topicPort{topic: tID}
+		if hasPort {
+			x, err := strconv.ParseUint(portStr, 10, 16)
+			if err != nil || x == 0 {
+				errs = append(errs, fmt.Errorf("%q: invalid port", e))
+				continue
+			}
+			tp.port = int(x)
+		}
+		out = append(out, tp)
+	}
+	return out, errs, true
+}
+
+func (idx topicIndex) port(p *v1.Pod, topic uint32, subPort int) int {
+	if subPort > 0 { return subPort }
+	if t, ok := idx.byID[topic]; ok && t.Spec.Port > 0 { return t.Spec.Port }
+	def := idx.defaultPort
+	if def == 0 { def = defaultSubscriberPort }
+	return getPodPort(*p, def)
+}
+
+// family: 토픽 주소 family. spec.ipFamily > defaultFamily > IPv4
+func (idx topicIndex) family(topic uint32) v1.IPFamily {
+	if t, ok := idx.byID[topic]; ok && t.Spec.IPFamily != "" { return v1.IPFamily(t.Spec.IPFamily) }
+	if idx.defaultFamily != "" { return idx.defaultFamily }
+	return v1.IPv4Protocol
+}
+
+// resolveMembers: 유효한(PodIP, NodeName 있는) Pod만 대상으로 멤버 목록을 만든다.
+// 구독 상태(MatchedPods, 조건)는 subs에 직접 기록된다.
+func resolveMembers(pods []v1.Pod, idx topicIndex, subs []kube.PubSubSubscription, rec record.EventRecorder) []member {
+	var out []member
+	seen := map[string]bool{} // namespace/pod/topic
+	add := func(p *v1.Pod, topic uint32, port int) {
+		k := fmt.Sprintf("%s/%d", nsName(p.Namespace, p.Name), topic)
+		if seen[k] { return }
+		seen[k] = true
+		out = append(out, member{pod: p, topic: topic, port: port})
+	}
+
+	var live []*v1.Pod
+	for i := range pods {
+		p := &pods[i]
+		if p.Status.PodIP == "" || p.Spec.NodeName == "" { continue }
+		live = append(live, p)
+	}
+
+	subscribed := map[string]bool{}
+	for i := range subs {
+		s := &subs[i]
+		s.Status.MatchedPods = 0
+		s.Status.ObservedGeneration = s.Generation
+		t, ok := idx.byName[nsName(s.Namespace, s.Spec.Topic)]
+		if !ok {
+			setCond(&s.Status.Conditions, s.Generation, metav1.ConditionFalse, "TopicNotFound",
+				fmt.Sprintf("PubSubTopic %q not found or invalid", s.Spec.Topic))
+			continue
+		}
+		sel, err := metav1.LabelSelectorAsSelector(s.Spec.Selector)
+		if err != nil || s.Spec.Selector == nil {
+			setCond(&s.Status.Conditions, s.Generation, metav1.ConditionFalse, "InvalidSelector", fmt.Sprint(err))
+			continue
+		}
+		for _, p := range live {
+			if p.Namespace != s.Namespace || !sel.Matches(labels.Set(p.Labels)) { continue }
+			add(p, t.Spec.ID, idx.port(p, t.Spec.ID, s.Spec.Port))
+			subscribed[nsName(p.Namespace, p.Name)] = true
+			s.Status.MatchedPods++
+		}
+		setCond(&s.Status.Conditions, s.Generation, metav1.ConditionTrue, "Resolved",
+			fmt.Sprintf("%d pods subscribed to topic %d", s.Status.MatchedPods, t.Spec.ID))
+	}
+
+	for _, p := range live {
+		tps, errs, ok := idx.podTopics(p)
+		if !ok {
+			if !subscribed[nsName(p.Namespace, p.Name)] { add(p, 1, idx.port(p, 1, 0)) }
+			continue
+		}
+		for _, err := range errs {
+			rec.Eventf(p, v1.EventTypeWarning, "InvalidTopicLabel", "topic entry ignored: %v", err)
+		}
+		for _, tp := range tps {
+			add(p, tp.topic, idx.port(p, tp.topic, tp.port))
+		}
+	}
+	return out
+}
+
+func setCond(conds *[]metav1.Condition, gen int64, status metav1.ConditionStatus, reason, msg string) {
+	meta.SetStatusCondition(conds, metav1.Condition{
+		Type:               kube.CondReady,
+		Status:             status,
+		ObservedGeneration: gen,
+		Reason:             reason,
+		Message:            msg,
+	})
+}
+
+// statusSnap: 갱신 전 status (변경 감지용)
+type statusSnap map[string]string
+
+func snapStatuses(topics []kube.PubSubTopic, subs []kube.PubSubSubscription) statusSnap {
+	snap := statusSnap{}
+	for _, t := range topics {
+		b, _ := json.Marshal(t.Status)
+		snap["topic/"+nsName(t.Namespace, t.Name)] = string(b)
+	}
+	for _, s := range subs {
+		b, _ := json.Marshal(s.Status)
+		snap["sub/"+nsName(s.Namespace, s.Name)] = string(b)
+	}
+	return snap
+}
+
+// writeStatuses: 변경된 status만 원천에 기록. 실패는 다음 주기에 재시도되므로 로그만 남긴다.
+func writeStatuses(ctx context.Context, sw topology.StatusWriter, before statusSnap, topics []kube.PubSubTopic, subs []kube.PubSubSubscription) {
+	after := snapStatuses(topics, subs)
+	for i := range topics {
+		t := &topics[i]
+		if k := "topic/" + nsName(t.Namespace, t.Name); after[k] == before[k] { continue }
+		if err := sw.UpdateTopicStatus(ctx, t); err != nil {
+			log.Printf("topic %s: status update: %v", t.Name, err)
+		}
+	}
+	for i := range subs {
+		s := &subs[i]
+		if k := "sub/" + nsName(s.Namespace, s.Name); after[k] == before[k] { continue }
+		if err := sw.UpdateSubscriptionStatus(ctx, s); err != nil {
+			log.Printf("subscription %s: status update: %v", s.Name, err)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+// 로컬 API (pkg/api): controller가 desired 테이블을 밀어 넣고 세대를 플립한다.
+// m_cfg/테이블 쓰기는 이 프로세스만 하므로 controller는 bpffs에 접근하지 않는다.
+//
+// 노출: hostNetwork라 0.0.0.0에 열면 노드에 닿는 모든 Pod가 데이터패스를 다시 쓸 수 있다.
+//   PS_API_ADDR       콤마 구분 listen 주소. 기본: 127.0.0.1:9465 (+ PS_NODE_IP가 있으면 그 주소:9465)
+//   PS_API_TOKEN_FILE 공유 토큰 파일 (pkg/api/auth.go). 루프백이 아닌 주소에서 받으려면 필수
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourorg/psbench/pkg/api"
+	"github.com/yourorg/psbench/pkg/maps"
+)
+
+const (
+	defaultAPIPort = "9465" // topology.DefaultLoaderPort
+	applyAttempts  = 3
+	applyBackoff   = 100 * time.Millisecond
+)
+
+type apiServer struct {
+	dp   maps.Store
+	node string
+	att  *attacher
+
+	mu            sync.Mutex
+	activeVersion string
+	staged        *stagedGen
+	lastErr       *api.Error
+	term          uint64 // 지금까지 본 최대 controller term (펜싱)
+}
+
+type stagedGen struct {
+	gen     uint32
+	version string
+	nodeID  uint32
+	term    uint64
+	filter  *api.Filter // nil이면 현재 m_cfg 필터 유지
+}
+
+// fence: 낡은 리더의 요청이면 409. 더 큰 term을 보면 그 term으로 올린다.
+// 새 리더가 나타나면 이전 리더가 staged한 세대는 플립 대상에서 제외된다.
+// term은 메모리에만 있어 loader 재시작 직후에는 0부터 다시 배운다(staged도 없으므로 flip은 apply 이후에만 가능).
+// 호출자가 s.mu를 잡고 있어야 한다.
+func (s *apiServer) fence(w http.ResponseWriter, term uint64) bool {
+	if term < s.term {
+		writeJSON(w, http.StatusConflict, api.Error{Error: fmt.Sprintf("stale term %d (current %d)", term, s.term)})
+		return false
+	}
+	if term > s.term {
+		log.Printf("api: controller term %d -> %d", s.term, term)
+		s.term = term
+		if s.staged != nil && s.staged.term < term { s.staged = nil }
+	}
+	return true
+}
+
+func newAPIServer(dp maps.Store, node string, att *attacher) *apiServer {
+	return &apiServer{dp: dp, node: node, att: att}
+}
+
+func (s *apiServer) routes(mux *http.ServeMux) {
+	mux.HandleFunc("/v1/tables", s.handleApply)
+	mux.HandleFunc("/v1/flip", s.handleFlip)
+	mux.HandleFunc("/v1/count", s.handleCount)
+	mux.HandleFunc("/v1/status", s.handleStatus)
+}
+
+// handler: 모든 경로에 토큰 검사 (status도 term을 드러내므로 포함)
+func (s *apiServer) handler(token string) http.Handler {
+	mux := http.NewServeMux()
+	s.routes(mux)
+	return api.RequireToken(token, mux)
+}
+
+// apiAddrs: PS_API_ADDR(콤마 구분)이 있으면 그대로, 없으면 루프백 + 노드 IP
+func apiAddrs(env, nodeIP string) []string {
+	if env == "" {
+		addrs := []string{net.JoinHostPort("127.0.0.1", defaultAPIPort)}
+		if nodeIP != "" { addrs = append(addrs, net.JoinHostPort(nodeIP, defaultAPIPort)) }
+		return addrs
+	}
+	var addrs []string
+	for _, a := range strings.Split(env, ",") {
+		if a = strings.TrimSpace(a); a != "" { addrs = append(addrs, a) }
+	}
+	return addrs
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeErr(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, api.Error{Error: err.Error()})
+}
+
+// handleApply: 비활성 세대에 preload. 플립 전까지 데이터패스에는 영향 없음.
+// 일시적 맵 오류는 세대 전체를 다시 써서 재시도한다. 끝내 실패하면 그 세대는 일부만 쓰인 채
+// 버려지고(staged 없음 → flip은 409) 다음 apply가 처음부터 다시 쓴다.
+func (s *apiServer) handleApply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req api.ApplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if f := req.Filter; f != nil && f.Tier2PortMax < f.Tier2PortMin {
+		writeErr(w, http.StatusUnprocessableEntity, fmt.Errorf("filter: empty tier-2 range %d-%d", f.Tier2PortMin, f.Tier2PortMax))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.fence(w, req.Term) { return }
+	active, err := s.dp.ActiveGen()
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	inactive := 1 - active
+	s.staged = nil
+	err = api.Retry(r.Context(), applyAttempts, applyBackoff, func() error {
+		err := s.dp.WriteGeneration(inactive, req.Tables)
+		if err != nil && !maps.Transient(err) {
+			return api.Permanent(err)
+		}
+		return err
+	})
+	if err != nil {
+		e := &api.Error{Error: err.Error(), Transient: maps.Transient(err)}
+		var we *maps.WriteError
+		if errors.As(err, &we) {
+			e.Op = we.Op
+		}
+		code := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, maps.ErrInvalid):
+			code = http.StatusUnprocessableEntity
+		case e.Transient:
+			code = http.StatusServiceUnavailable
+		}
+		s.lastErr = e
+		log.Printf("api: apply %s: gen %d abandoned: %v", req.Version, inactive, err)
+		writeJSON(w, code, e)
+		return
+	}
+	s.lastErr = nil
+	s.staged = &stagedGen{gen: inactive, version: req.Version, nodeID: req.NodeID, term: req.Term, filter: req.Filter}
+	log.Printf("api: staged version=%s gen=%d topics=%d nodes=%d", req.Version, inactive, len(req.Tables.Topics), len(req.Tables.Nodes))
+	writeJSON(w, http.StatusOK, api.Ack{Node: s.node, Gen: inactive, Version: req.Version})
+}
+
+// handleFlip: staged 버전이 요청과 같고 같은 term에서 staged된 경우에만 플립.
+// node_id, active_gen, 포트 필터는 한 번의 m_cfg 쓰기로 바꾼다 (새 세대의 토픽 포트와 필터가 함께 바뀜).
+func (s *apiServer) handleFlip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req api.FlipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.fence(w, req.Term) { return }
+	if req.Version == s.activeVersion && s.staged == nil {
+		// 재시도된 플립: 이미 반영됨
+		gen, _ := s.dp.ActiveGen()
+		writeJSON(w, http.StatusOK, api.Ack{Node: s.node, Gen: gen, Version: req.Version})
+		return
+	}
+	if s.staged == nil || s.staged.version != req.Version || s.staged.term != req.Term {
+		writeJSON(w, http.StatusConflict, api.Error{Error: "version " + req.Version + " not staged"})
+		return
+	}
+	st := s.staged
+	c, err := s.dp.UpdateConfig(func(c *maps.Config) {
+		c.LocalNodeID = st.nodeID
+		c.ActiveGen = st.gen
+		if f := st.filter; f != nil {
+			c.Tier1Port, c.Tier2PortMin, c.Tier2PortMax = f.Tier1Port, f.Tier2PortMin, f.Tier2PortMax
+		}
+	})
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.activeVersion, s.staged = st.version, nil
+	log.Printf("api: flipped active_gen=%d version=%s node_id=%d tier1=%d tier2=%d-%d", st.gen, st.version, st.nodeID, c.Tier1Port, c.Tier2PortMin, c.Tier2PortMax)
+	writeJSON(w, http.StatusOK, api.Ack{Node: s.node, Gen: st.gen, Version: st.version})
+}
+
+// handleCount: 활성 세대의 카운트 하나만 쓴다. 활성 내용이 더는 activeVersion이 아니므로
+// 버전을 "manual-count"로 바꿔 controller의 다음 push가 덮어쓰게 한다.
+func (s *apiServer) handleCount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req api.CountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.fence(w, req.Term) { return }
+	active, err := s.dp.ActiveGen()
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	if req.Node == nil {
+		err = s.dp.SetTopicCount(active, req.Topic, req.Count)
+	} else {
+		err = s.dp.SetLocalCount(active, maps.LocalKey{NodeID: *req.Node, TopicID: req.Topic}, req.Count)
+	}
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, maps.ErrInvalid) { code = http.StatusUnprocessableEntity }
+		writeErr(w, code, err)
+		return
+	}
+	s.activeVersion = "manual-count"
+	log.Printf("api: gen %d: %v", active, countDesc(req))
+	writeJSON(w, http.StatusOK, api.Ack{Node: s.node, Gen: active, Version: s.activeVersion})
+}
+
+func countDesc(req api.CountRequest) string {
+	if req.Node == nil { return fmt.Sprintf("topic %d count=%d", req.Topic, req.Count) }
+	return fmt.Sprintf("node %d topic %d count=%d", *req.Node, req.Topic, req.Count)
+}
+
+func (s *apiServer) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	c, err := s.dp.Config()
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.mu.Lock()
+	st := api.Status{
+		Node:          s.node,
+		NodeID:        c.LocalNodeID,
+		ActiveGen:     c.ActiveGen,
+		ActiveVersion: s.activeVersion,
+		Term:          s.term,
+	}
+	if s.staged != nil {
+		st.StagedVersion = s.staged.version
+	}
+	st.LastError = s.lastErr
+	s.mu.Unlock()
+	if s.att != nil {
+		for _, at := range s.att.status() {
+			st.Links = append(st.Links, api.Link{Dev: at.Dev, Dir: at.Dir, Mech: at.Mech, Live: at.Live, Err: at.Err})
+		}
+	}
+	writeJSON(w, http.StatusOK, st)
+}
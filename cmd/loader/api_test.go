@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/yourorg/psbench/pkg/api"
+	"github.com/yourorg/psbench/pkg/maps"
+)
+
+func post(s *apiServer, path string, body any) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	s.routes(mux)
+	b, _ := json.Marshal(body)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(b)))
+	return rr
+}
+
+// 낡은 리더의 apply/flip은 맵을 건드리기 전에 거부된다 (dp가 nil이어도 통과해야 함).
+func TestFenceRejectsStaleTerm(t *testing.T) {
+	s := newAPIServer(nil, "n0", nil)
+	s.term = 5
+	if rr := post(s, "/v1/tables", api.ApplyRequest{Version: "v", Term: 4}); rr.Code != http.StatusConflict {
+		t.Errorf("stale apply: %d, want 409", rr.Code)
+	}
+	if rr := post(s, "/v1/flip", api.FlipRequest{Version: "v", Term: 4}); rr.Code != http.StatusConflict {
+		t.Errorf("stale flip: %d, want 409", rr.Code)
+	}
+	if rr := post(s, "/v1/count", api.CountRequest{Topic: 1, Term: 4}); rr.Code != http.StatusConflict {
+		t.Errorf("stale count: %d, want 409", rr.Code)
+	}
+	if s.term != 5 {
+		t.Errorf("term moved to %d", s.term)
+	}
+}
+
+// 새 리더(term 6)는 이전 리더(term 5)가 staged한 세대를 플립할 수 없다.
+func TestFenceDropsStagedFromOldTerm(t *testing.T) {
+	s := newAPIServer(nil, "n0", nil)
+	s.term = 5
+	s.staged = &stagedGen{gen: 1, version: "v", term: 5}
+	if rr := post(s, "/v1/flip", api.FlipRequest{Version: "v", Term: 6}); rr.Code != http.StatusConflict {
+		t.Errorf("flip of old-term staged gen: %d, want 409", rr.Code)
+	}
+	if s.term != 6 || s.staged != nil {
+		t.Errorf("term=%d staged=%+v, want term 6 and staged cleared", s.term, s.staged)
+	}
+}
+
+// apply는 비활성 세대에만 쓰고, flip이 node_id와 active_gen을 함께 바꾼다.
+func TestApplyThenFlip(t *testing.T) {
+	dp := maps.NewFake()
+	s := newAPIServer(dp, "n0", nil)
+	tb := maps.Tables{
+		Topics: map[uint32][]maps.NodeDest{1: {{NodeID: 2, Dest: netip.MustParseAddrPort("192.168.0.12:32000")}}},
+		Nodes:  map[uint32]map[uint32][]maps.SubDest{2: {1: {{Dest: netip.MustParseAddrPort("10.1.2.1:31001")}}}},
+	}
+	filter := &api.Filter{Tier1Port: 32100, Tier2PortMin: 31001, Tier2PortMax: 31001}
+	if rr := post(s, "/v1/tables", api.ApplyRequest{Version: "v1", NodeID: 2, Term: 1, Tables: tb, Filter: filter}); rr.Code != http.StatusOK {
+		t.Fatalf("apply: %d %s", rr.Code, rr.Body)
+	}
+	if c, _ := dp.Config(); c.ActiveGen != 0 || c.LocalNodeID != 0 {
+		t.Errorf("cfg changed before flip: %+v", c)
+	}
+	if got, _ := dp.ReadGeneration(0); len(got.Topics) != 0 {
+		t.Errorf("active gen 0 written by apply: %+v", got)
+	}
+	if rr := post(s, "/v1/flip", api.FlipRequest{Version: "v1", Term: 1}); rr.Code != http.StatusOK {
+		t.Fatalf("flip: %d %s", rr.Code, rr.Body)
+	}
+	if c, _ := dp.Config(); c.ActiveGen != 1 || c.LocalNodeID != 2 || c.Tier1Port != 32100 || c.Tier2PortMin != 31001 || c.Tier2PortMax != 31001 {
+		t.Errorf("cfg after flip = %+v, want active_gen 1 node 2 and the request's filter", c)
+	}
+	got, err := dp.ReadGeneration(1)
+	if err != nil || maps.Diff(got, tb) != nil {
+		t.Errorf("gen 1 = %+v (err %v), diff %v", got, err, maps.Diff(got, tb))
+	}
+
+	// 필터 없는 apply(psbenchctl)는 현재 필터를 유지하고, 빈 tier-2 범위는 거부한다
+	post(s, "/v1/tables", api.ApplyRequest{Version: "v2", NodeID: 2, Term: 1, Tables: tb})
+	if rr := post(s, "/v1/flip", api.FlipRequest{Version: "v2", Term: 1}); rr.Code != http.StatusOK {
+		t.Fatalf("flip v2: %d %s", rr.Code, rr.Body)
+	}
+	if c, _ := dp.Config(); c.Tier1Port != 32100 || c.Tier2PortMax != 31001 {
+		t.Errorf("filter after an apply without one = %+v, want it kept", c)
+	}
+	bad := &api.Filter{Tier1Port: 32000, Tier2PortMin: 31999, Tier2PortMax: 31000}
+	if rr := post(s, "/v1/tables", api.ApplyRequest{Version: "v3", Term: 1, Tables: tb, Filter: bad}); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("inverted tier-2 range: %d, want 422", rr.Code)
+	}
+}
+
+// count는 활성 세대의 카운트 하나만 바꾼다. 집합과 비활성 세대는 그대로이고, 0이나 집합보다 큰 값도 쓸 수 있다.
+func TestCountWritesActiveCountOnly(t *testing.T) {
+	dp := maps.NewFake()
+	s := newAPIServer(dp, "n0", nil)
+	tb := maps.Tables{
+		Topics: map[uint32][]maps.NodeDest{1: {
+			{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")},
+			{NodeID: 1, Dest: netip.MustParseAddrPort("192.168.0.11:32000")},
+		}},
+		Nodes: map[uint32]map[uint32][]maps.SubDest{0: {1: {{Dest: netip.MustParseAddrPort("10.1.0.1:31001")}}}},
+	}
+	post(s, "/v1/tables", api.ApplyRequest{Version: "v1", Tables: tb})
+	if rr := post(s, "/v1/flip", api.FlipRequest{Version: "v1"}); rr.Code != http.StatusOK {
+		t.Fatalf("flip: %d %s", rr.Code, rr.Body)
+	}
+	node := uint32(0)
+	for _, req := range []api.CountRequest{{Topic: 1, Count: 1}, {Topic: 1, Node: &node, Count: 5}} {
+		if rr := post(s, "/v1/count", req); rr.Code != http.StatusOK {
+			t.Fatalf("count %+v: %d %s", req, rr.Code, rr.Body)
+		}
+	}
+	c, _ := dp.Counts(1)
+	if c.Topics[1] != 1 || c.Local[maps.LocalKey{NodeID: 0, TopicID: 1}] != 5 {
+		t.Errorf("gen 1 counts = %+v, want topic 1 = 1, (0,1) = 5", c)
+	}
+	got, err := dp.ReadGeneration(1)
+	if err != nil || len(got.Topics[1]) != 1 || len(got.Nodes[0][1]) != 1 {
+		t.Errorf("gen 1 = %+v (err %v), want the first node and the one programmed subscriber", got, err)
+	}
+	if c, _ := dp.Counts(0); len(c.Topics)+len(c.Local) != 0 {
+		t.Errorf("inactive gen 0 touched: %+v", c)
+	}
+	if s.activeVersion == "v1" {
+		t.Error("active version still v1 after a count change; the controller would not repush")
+	}
+	if rr := post(s, "/v1/count", api.CountRequest{Topic: 1, Count: maps.MaxFanout + 1}); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("count above MAX_FANOUT: %d, want 422", rr.Code)
+	}
+}
+
+// 세대 쓰기가 끝내 실패하면 503 + op, 그 버전은 플립할 수 없다.
+func TestApplyTransientFailure(t *testing.T) {
+	dp := maps.NewFake()
+	dp.Fail = func(op, name string, _ any) error {
+		if name == "topic_fanout_cnt_gen1" {
+			return syscall.EAGAIN
+		}
+		return nil
+	}
+	s := newAPIServer(dp, "n0", nil)
+	tb := maps.Tables{Topics: map[uint32][]maps.NodeDest{1: {{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")}}}}
+	rr := post(s, "/v1/tables", api.ApplyRequest{Version: "v1", Tables: tb})
+	var e api.Error
+	json.NewDecoder(rr.Body).Decode(&e)
+	if rr.Code != http.StatusServiceUnavailable || e.Op != "topic" || !e.Transient {
+		t.Errorf("apply = %d %+v, want 503 transient op topic", rr.Code, e)
+	}
+	if rr := post(s, "/v1/flip", api.FlipRequest{Version: "v1"}); rr.Code != http.StatusConflict {
+		t.Errorf("flip after failed apply: %d, want 409", rr.Code)
+	}
+}
+
+// 토큰 없는 호출은 어떤 경로도 통과하지 못하고 맵도 바뀌지 않는다. 토큰이 맞으면 pkg/api 클라이언트로 쓴다.
+func TestAPIRequiresToken(t *testing.T) {
+	dp := maps.NewFake()
+	srv := httptest.NewServer(newAPIServer(dp, "n0", nil).handler("s3cret"))
+	defer srv.Close()
+	ctx := context.Background()
+
+	for _, tok := range []string{"", "wrong"} {
+		c := api.NewClient(srv.URL)
+		c.Token = tok
+		_, err := c.Apply(ctx, api.ApplyRequest{Version: "v1", Term: 99})
+		var he *api.HTTPError
+		if !errors.As(err, &he) || he.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: apply %v, want 401", tok, err)
+		}
+		if _, err := c.Flip(ctx, "v1", 99); !errors.As(err, &he) || he.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: flip %v, want 401", tok, err)
+		}
+		if _, err := c.Status(ctx); !errors.As(err, &he) || he.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: status %v, want 401 (term must not leak)", tok, err)
+		}
+	}
+	if c, _ := dp.Config(); c.ActiveGen != 0 {
+		t.Fatalf("unauthenticated request changed cfg: %+v", c)
+	}
+
+	c := api.NewClient(srv.URL)
+	c.Token = "s3cret"
+	if _, err := c.Apply(ctx, api.ApplyRequest{Version: "v1", Term: 1}); err != nil {
+		t.Fatalf("apply with token: %v", err)
+	}
+	if _, err := c.Flip(ctx, "v1", 1); err != nil {
+		t.Fatalf("flip with token: %v", err)
+	}
+	if st, err := c.Status(ctx); err != nil || st.ActiveGen != 1 || st.Term != 1 {
+		t.Errorf("status %+v, %v", st, err)
+	}
+}
+
+func TestAPIAddrs(t *testing.T) {
+	for _, tc := range []struct {
+		env, nodeIP string
+		want        []string
+		loopback    bool
+	}{
+		{"", "", []string{"127.0.0.1:9465"}, true},
+		{"", "10.0.0.5", []string{"127.0.0.1:9465", "10.0.0.5:9465"}, false},
+		{"", "fd00::5", []string{"127.0.0.1:9465", "[fd00::5]:9465"}, false},
+		{"[::1]:19465, localhost:19466", "10.0.0.5", []string{"[::1]:19465", "localhost:19466"}, true},
+		{":9465", "", []string{":9465"}, false},
+		{"0.0.0.0:9465", "", []string{"0.0.0.0:9465"}, false},
+	} {
+		got := apiAddrs(tc.env, tc.nodeIP)
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%q %q: %v, want %v", tc.env, tc.nodeIP, got, tc.want)
+		}
+		if lo := api.LoopbackOnly(got); lo != tc.loopback {
+			t.Errorf("%v: LoopbackOnly %v", got, lo)
+		}
+	}
+}
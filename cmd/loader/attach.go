@@ -0,0 +1,203 @@
+package main
+
+// 다중 인터페이스 attach: PS_ATTACH_DEV="eth0:ingress,lxc*:ingress,cilium_host:egress"
+// - 방향 생략 시 ingress, 이름은 glob 패턴 허용(per-pod veth 대응)
+// - 장치별로 개별 attach/추적, 한 장치 실패가 나머지를 막지 않는다
+// - 주기적으로 재스캔하여 새로 생긴 veth는 attach, 사라진 장치는 정리
+// - 메커니즘(tcx/netlink)은 tc.go 참고
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cilium/ebpf"
+)
+
+const (
+	dirIngress = "ingress"
+	dirEgress  = "egress"
+)
+
+type attachSpec struct {
+	Pattern string
+	Dir     string
+}
+
+func parseAttachSpecs(s string) ([]attachSpec, error) {
+	var out []attachSpec
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" { continue }
+		name, dir, ok := strings.Cut(f, ":")
+		if !ok { dir = dirIngress }
+		if dir != dirIngress && dir != dirEgress {
+			return nil, fmt.Errorf("%q: direction must be %s or %s", f, dirIngress, dirEgress)
+		}
+		if _, err := filepath.Match(name, ""); err != nil {
+			return nil, fmt.Errorf("%q: %w", f, err)
+		}
+		out = append(out, attachSpec{Pattern: name, Dir: dir})
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no devices in %q", s)
+	}
+	return out, nil
+}
+
+type attachment struct {
+	Dev     string    `json:"dev"`
+	Ifindex int       `json:"ifindex"`
+	Dir     string    `json:"dir"`
+	Mech    string    `json:"mech,omitempty"`
+	Live    bool      `json:"live"`
+	Since   time.Time `json:"since,omitempty"`
+	Err     string    `json:"error,omitempty"`
+	l       io.Closer
+}
+
+type attacher struct {
+	prog  *ebpf.Program
+	specs []attachSpec
+	tc    *tcAttacher
+
+	mu    sync.Mutex
+	links map[string]*attachment // "dev/dir"
+}
+
+func newAttacher(prog *ebpf.Program, specs []attachSpec, tc *tcAttacher) *attacher {
+	return &attacher{prog: prog, specs: specs, tc: tc, links: map[string]*attachment{}}
+}
+
+// sync: spec을 현재 인터페이스 목록에 대응시켜 attach/detach. 변화가 있으면 true.
+func (a *attacher) sync() bool {
+	ifs, err := net.Interfaces()
+	if err != nil {
+		log.Printf("attach: list interfaces: %v", err)
+		return false
+	}
+	want := map[string]attachment{}
+	for _, s := range a.specs {
+		matched := false
+		for _, ifi := range ifs {
+			if ok, _ := filepath.Match(s.Pattern, ifi.Name); ok {
+				want[ifi.Name+"/"+s.Dir] = attachment{Dev: ifi.Name, Ifindex: ifi.Index, Dir: s.Dir}
+				matched = true
+			}
+		}
+		// 리터럴 이름이 없으면 실패로 남겨 상태에 보이게 한다(glob은 0개 매칭 허용)
+		if !matched && !strings.ContainsAny(s.Pattern, "*?[") {
+			want[s.Pattern+"/"+s.Dir] = attachment{Dev: s.Pattern, Dir: s.Dir, Err: "no such interface"}
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	changed := false
+	for k, cur := range a.links {
+		w, ok := want[k]
+		if ok && w.Ifindex == cur.Ifindex && cur.Live { continue }
+		if cur.l != nil {
+			_ = cur.l.Close()
+		}
+		if !ok {
+			if cur.Live { log.Printf("attach: %s gone, detached", k) }
+			delete(a.links, k)
+			changed = true
+		}
+	}
+	for k, w := range want {
+		if cur, ok := a.links[k]; ok && cur.Live && cur.Ifindex == w.Ifindex { continue }
+		prevErr := ""
+		if cur, ok := a.links[k]; ok { prevErr = cur.Err }
+		at := w
+		if at.Err == "" {
+			l, mech, err := a.tc.attach(a.prog, at.Ifindex, at.Dir)
+			at.Mech = mech
+			if err != nil {
+				at.Err = err.Error()
+			} else {
+				at.l, at.Live, at.Since = l, true, time.Now()
+			}
+		}
+		a.links[k] = &at
+		if at.Live {
+			log.Printf("attach: %s (ifindex %d) live via %s", k, at.Ifindex, at.Mech)
+			changed = true
+		} else if at.Err != prevErr {
+			log.Printf("attach: %s failed: %s", k, at.Err)
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (a *attacher) status() []attachment {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]attachment, 0, len(a.links))
+	for _, at := range a.links { out = append(out, *at) }
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Dev != out[j].Dev { return out[i].Dev < out[j].Dev }
+		return out[i].Dir < out[j].Dir
+	})
+	return out
+}
+
+func (a *attacher) live() int {
+	n := 0
+	for _, at := range a.status() {
+		if at.Live { n++ }
+	}
+	return n
+}
+
+// report: 현재 link 상태를 한 줄씩 로그로.
+func (a *attacher) report() {
+	for _, at := range a.status() {
+		if at.Live {
+			log.Printf("link %s/%s ifindex=%d live (%s)", at.Dev, at.Dir, at.Ifindex, at.Mech)
+		} else {
+			log.Printf("link %s/%s down: %s", at.Dev, at.Dir, at.Err)
+		}
+	}
+}
+
+// run: ctx 종료까지 주기적 재스캔.
+func (a *attacher) run(ctx context.Context, every time.Duration) {
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			if a.sync() { a.report() }
+		}
+	}
+}
+
+func (a *attacher) closeAll() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for k, at := range a.links {
+		if at.l == nil { continue }
+		if err := at.l.Close(); err != nil { log.Printf("tc detach(%s): %v", k, err) }
+		at.l, at.Live = nil, false
+	}
+}
+
+// ServeHTTP: /status — link 상태 JSON
+func (a *attacher) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(a.status())
+}
@@ -0,0 +1,51 @@
+package main
+
+// m_ring 샘플 이벤트(topic, hop, fanout, drop_reason, ktime)를 읽어 JSONL로 기록.
+// 샘플링 비율은 PS_SAMPLE_RATE(1/N, 0=끔)로 m_cfg에 설정된다.
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+
+	"github.com/cilium/ebpf/ringbuf"
+	"github.com/yourorg/psbench/pkg/maps"
+)
+
+type eventRec struct {
+	Kind       string `json:"kind"`
+	KtimeNs    uint64 `json:"ktime_ns"`
+	Node       string `json:"node"`
+	Topic      uint32 `json:"topic"`
+	Hop        uint16 `json:"hop"`
+	Fanout     uint16 `json:"fanout"`
+	DropReason string `json:"drop_reason"`
+}
+
+// runEvents: rd가 Close될 때까지 이벤트를 out으로 흘린다.
+func runEvents(rd *ringbuf.Reader, node string, out io.Writer) {
+	enc := json.NewEncoder(out)
+	for {
+		rec, err := rd.Read()
+		if err != nil {
+			if errors.Is(err, ringbuf.ErrClosed) { return }
+			log.Printf("ringbuf read: %v", err)
+			continue
+		}
+		e, err := maps.DecodeEvent(rec.RawSample)
+		if err != nil {
+			log.Printf("ringbuf decode: %v", err)
+			continue
+		}
+		_ = enc.Encode(eventRec{
+			Kind:       "event",
+			KtimeNs:    e.KtimeNs,
+			Node:       node,
+			Topic:      e.TopicID,
+			Hop:        e.Hop,
+			Fanout:     e.Fanout,
+			DropReason: e.Reason(),
+		})
+	}
+}
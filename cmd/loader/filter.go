@@ -0,0 +1,84 @@
+package main
+
+// psbench 트래픽 필터 (m_cfg의 tier1_port, tier2_port_min/max, hdr_magic/mask).
+// 어태치한 장치의 다른 UDP(DNS, VXLAN ...)를 토픽 메시지로 읽지 않도록 dport로 거른다.
+//   PS_TIER1_PORT  = "32000"        1차(노드) 수신 포트, controller -first-tier-port와 같게. 0이면 없음
+//   PS_TIER2_PORTS = "31000-31999"  구독자 포트 (단일 포트 또는 범위). 토픽별 포트를 모두 덮어야 한다. 0이면 없음
+//   PS_HDR_MAGIC   = "VAL[/MASK]"   topic_hdr.flags 검사 (MASK 생략 시 0xffff). 비우면 검사 안 함
+// 포트가 둘 다 0이면 필터를 끈다(모든 UDP). 걸러진 패킷은 IP/UDP가 아닌 프레임과 같이 그대로 통과하고 skipped로 센다.
+// 포트 env는 시작 시 값이다: controller는 apply에 자기 설정(first-tier 포트, 테이블의 구독자 포트)으로 계산한
+// 필터를 실어 보내고 플립 때 그 값으로 바뀐다 (api.Filter). controller 없이 psbenchctl로 쓸 때는 env 값이 그대로 간다.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yourorg/psbench/pkg/maps"
+)
+
+const (
+	defaultTier1Port  = "32000"
+	defaultTier2Ports = "31000-31999"
+)
+
+type trafficFilter struct {
+	tier1              uint16
+	tier2Min, tier2Max uint16
+	magic, mask        uint16
+}
+
+func parsePort(s string) (uint16, error) {
+	v, err := strconv.ParseUint(strings.TrimSpace(s), 10, 16)
+	if err != nil { return 0, fmt.Errorf("invalid port %q", s) }
+	return uint16(v), nil
+}
+
+func parseUint16(s string) (uint16, error) {
+	v, err := strconv.ParseUint(strings.TrimSpace(s), 0, 16)
+	if err != nil { return 0, fmt.Errorf("invalid value %q", s) }
+	return uint16(v), nil
+}
+
+// parseFilter: PS_TIER1_PORT, PS_TIER2_PORTS, PS_HDR_MAGIC 값
+func parseFilter(tier1, tier2, magic string) (trafficFilter, error) {
+	var (
+		f   trafficFilter
+		err error
+	)
+	if f.tier1, err = parsePort(tier1); err != nil { return f, fmt.Errorf("tier-1 port: %w", err) }
+
+	lo, hi, isRange := strings.Cut(tier2, "-")
+	if f.tier2Min, err = parsePort(lo); err != nil { return f, fmt.Errorf("tier-2 ports: %w", err) }
+	f.tier2Max = f.tier2Min
+	if isRange {
+		if f.tier2Max, err = parsePort(hi); err != nil { return f, fmt.Errorf("tier-2 ports: %w", err) }
+		if f.tier2Max < f.tier2Min { return f, fmt.Errorf("tier-2 ports: empty range %q", tier2) }
+	}
+	if f.tier2Max == 0 && isRange { return f, fmt.Errorf("tier-2 ports: empty range %q", tier2) }
+
+	if magic != "" {
+		val, mask, hasMask := strings.Cut(magic, "/")
+		if f.magic, err = parseUint16(val); err != nil { return f, fmt.Errorf("header magic: %w", err) }
+		f.mask = 0xffff
+		if hasMask {
+			if f.mask, err = parseUint16(mask); err != nil { return f, fmt.Errorf("header magic: %w", err) }
+		}
+		// 마스크 밖 비트가 있으면 어떤 패킷도 맞지 않는다
+		if f.mask == 0 || f.magic&^f.mask != 0 { return f, fmt.Errorf("header magic %q matches no packet", magic) }
+	}
+	return f, nil
+}
+
+func (f trafficFilter) apply(c *maps.Config) {
+	c.Tier1Port = f.tier1
+	c.Tier2PortMin, c.Tier2PortMax = f.tier2Min, f.tier2Max
+	c.HdrMagic, c.HdrMagicMask = f.magic, f.mask
+}
+
+func (f trafficFilter) String() string {
+	if f.tier1 == 0 && f.tier2Max == 0 { return "off (all UDP)" }
+	s := fmt.Sprintf("tier1=%d tier2=%d-%d", f.tier1, f.tier2Min, f.tier2Max)
+	if f.mask != 0 { s += fmt.Sprintf(" magic=%#04x/%#04x", f.magic, f.mask) }
+	return s
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/yourorg/psbench/pkg/maps"
+)
+
+func TestParseFilter(t *testing.T) {
+	for _, tc := range []struct {
+		tier1, tier2, magic string
+		want                trafficFilter
+	}{
+		{defaultTier1Port, defaultTier2Ports, "", trafficFilter{tier1: 32000, tier2Min: 31000, tier2Max: 31999}},
+		{"32000", "31001", "", trafficFilter{tier1: 32000, tier2Min: 31001, tier2Max: 31001}},
+		{"0", "0", "", trafficFilter{}},
+		{"32000", "0", "0x5000/0xf000", trafficFilter{tier1: 32000, magic: 0x5000, mask: 0xf000}},
+		{"32000", "0", "7", trafficFilter{tier1: 32000, magic: 7, mask: 0xffff}},
+	} {
+		got, err := parseFilter(tc.tier1, tc.tier2, tc.magic)
+		if err != nil || got != tc.want {
+			t.Errorf("%q %q %q: %+v, %v; want %+v", tc.tier1, tc.tier2, tc.magic, got, err, tc.want)
+		}
+	}
+	for _, bad := range [][3]string{
+		{"", "0", ""},
+		{"70000", "0", ""},
+		{"32000", "31999-31000", ""},
+		{"32000", "0-0", ""},
+		{"32000", "31000-", ""},
+		{"32000", "0", "0x10/0x0f"}, // 마스크 밖 비트
+		{"32000", "0", "0/0"},
+		{"32000", "0", "magic"},
+	} {
+		if f, err := parseFilter(bad[0], bad[1], bad[2]); err == nil {
+			t.Errorf("%q accepted as %+v", bad, f)
+		}
+	}
+}
+
+// loader 소유 필드만 바꾸고 controller 필드(active_gen, node_id)는 그대로 둔다.
+func TestFilterApply(t *testing.T) {
+	c := maps.Config{ActiveGen: 1, LocalNodeID: 4, SampleRate: 10}
+	f, err := parseFilter("32000", "31000-31999", "0x5000/0xf000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.apply(&c)
+	want := maps.Config{
+		ActiveGen: 1, LocalNodeID: 4, SampleRate: 10,
+		Tier1Port: 32000, Tier2PortMin: 31000, Tier2PortMax: 31999, HdrMagic: 0x5000, HdrMagicMask: 0xf000,
+	}
+	if c != want {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+	if !c.PortFiltered() {
+		t.Error("filter not enabled")
+	}
+}
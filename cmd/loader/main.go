@@ -1,23 +1,31 @@
 package main
 
-// Loader DaemonSet: 각 노드에서 bpf .o 로드, clsact/ingress attach, 맵 핀 + cfg 설정.
+// Loader DaemonSet: 각 노드에서 bpf .o 로드, tc attach(tcx 또는 clsact), 맵 핀 + cfg 설정.
 // 권한: NET_ADMIN, BPF, SYS_RESOURCE
+// SIGTERM/SIGINT 시 link detach 후 핀 제거(-keep-pins로 유지 가능).
 
 import (
+	"context"
+	"flag"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/cilium/ebpf"
-	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/ringbuf"
+	"github.com/yourorg/psbench/pkg/api"
+	"github.com/yourorg/psbench/pkg/maps"
 )
 
 const (
-	pinRoot = "/sys/fs/bpf/psbench"
-	objPath = "/usr/local/bin/tc_hier_pubsub_kern.o"
+	defaultPinRoot = "/sys/fs/bpf/psbench"
+	objPath        = "/usr/local/lib/psbench/tc_hier_pubsub_kern.o" // 이미지가 loader와 같은 소스로 빌드해 넣는다. PS_OBJ로 바꿀 수 있다 (이미지 밖 실행, test/e2e)
 )
 
 func ifindex(name string) (int, error) {
@@ -40,6 +48,15 @@ func ensureDir(p string) {
 }
 
 func main() {
+	keepPins := flag.Bool("keep-pins", false, "leave maps pinned in bpffs on shutdown")
+	pinMode := flag.String("stale-pins", pinsAdopt, "pins left by a previous run: adopt (reuse compatible, drop incompatible) | wipe (drop all)")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	// 한 노드에 독립 배포가 여럿이면 배포마다 다른 핀 경로 (controller -pins, psbenchctl -pins와 같게)
+	pinRoot := mustEnv("PS_PIN_ROOT", defaultPinRoot)
 	ensureDir(pinRoot)
 
 	egressIf := mustEnv("PS_EGRESS_IF", "eth0")
@@ -51,54 +68,59 @@ func main() {
 	localIdx, err := ifindex(localRouteIf)
 	if err != nil { log.Fatalf("local route ifindex: %v", err) }
 	nodeID, _ := strconv.Atoi(nodeIDStr)
+	sampleRate, err := strconv.Atoi(mustEnv("PS_SAMPLE_RATE", "0")) // m_ring 1/N 샘플링, 0=끔
+	if err != nil || sampleRate < 0 { log.Fatalf("PS_SAMPLE_RATE: invalid %q", os.Getenv("PS_SAMPLE_RATE")) }
+	filter, err := parseFilter(mustEnv("PS_TIER1_PORT", defaultTier1Port), mustEnv("PS_TIER2_PORTS", defaultTier2Ports), os.Getenv("PS_HDR_MAGIC"))
+	if err != nil { log.Fatalf("traffic filter: %v", err) }
 
-	spec, err := ebpf.LoadCollectionSpec(objPath)
+	obj := mustEnv("PS_OBJ", objPath)
+	spec, err := ebpf.LoadCollectionSpec(obj)
 	if err != nil { log.Fatalf("load spec: %v", err) }
+	// 다른 소스에서 빌드된 오브젝트는 맵 값을 잘못 해석하므로 attach 전에 거부
+	if err := maps.CheckSpec(spec); err != nil { log.Fatalf("%s: %v", obj, err) }
 
 	// 핀 경로 주입
 	for name := range spec.Maps {
 		spec.Maps[name].Pinning = ebpf.PinByName
 	}
+	if err := checkPins(spec, pinRoot, *pinMode); err != nil { log.Fatalf("stale pins: %v", err) }
 
 	coll, err := ebpf.NewCollectionWithOptions(spec, ebpf.CollectionOptions{
 		Maps: ebpf.MapOptions{PinPath: pinRoot},
 	})
 	if err != nil { log.Fatalf("new collection: %v", err) }
-	defer coll.Close()
-
-	// cfg 세팅
-	cfg := coll.Maps["m_cfg"]
-	key := uint32(0)
-	type cfgRec struct {
-		EgressIfidx      uint32
-		LocalRouteIfidx  uint32
-		LocalNodeID      uint32
-		Reserved         uint32
-	}
-	val := cfgRec{uint32(egressIdx), uint32(localIdx), uint32(nodeID), 0}
-	if err := cfg.Update(&key, &val, ebpf.UpdateAny); err != nil {
-		log.Fatalf("cfg update: %v", err)
-	}
 
-	// active_gen 초기값 0
-	act := coll.Maps["m_active_gen"]
-	zero := uint32(0)
-	if err := act.Update(&key, &zero, ebpf.UpdateAny); err != nil {
-		log.Fatalf("active_gen init: %v", err)
-	}
+	// cfg 세팅: loader 소유 필드만 갱신 (규약은 pkg/maps/config.go)
+	// 새로 만든 맵이면 controller 소유 필드(node_id, active_gen=0)도 초기화한다.
+	c, err := maps.UpdateConfig(coll.Maps["m_cfg"], func(c *maps.Config) {
+		if c.EgressIfindex == 0 {
+			c.LocalNodeID = uint32(nodeID)
+			c.ActiveGen = 0
+		}
+		c.EgressIfindex = uint32(egressIdx)
+		c.LocalRouteIfindex = uint32(localIdx)
+		c.SampleRate = uint32(sampleRate)
+		filter.apply(c)
+	})
+	if err != nil { log.Fatalf("cfg update: %v", err) }
+	log.Printf("cfg: node_id=%d active_gen=%d filter=%s", c.LocalNodeID, c.ActiveGen, filter)
 
-	// clsact/ingress attach
+	// clsact attach: PS_ATTACH_DEV="dev[:ingress|egress],..." (glob 허용)
 	prog := coll.Programs["tc_hier_pubsub"]
-	dev := mustEnv("PS_ATTACH_DEV", egressIf) // ingress에만 attach, 필요시 여러개 attach
-	l, err := link.AttachTC(link.TCOptions{
-		Interface:  uint32(egressIdx),
-		AttachPoint: link.Ingress,
-		Program:    prog,
-	})
-	if err != nil {
-		log.Fatalf("tc attach(%s): %v", dev, err)
-	}
-	defer l.Close()
+	specs, err := parseAttachSpecs(mustEnv("PS_ATTACH_DEV", egressIf+":"+dirIngress))
+	if err != nil { log.Fatalf("PS_ATTACH_DEV: %v", err) }
+	rescan, err := time.ParseDuration(mustEnv("PS_ATTACH_RESCAN", "10s"))
+	if err != nil { log.Fatalf("PS_ATTACH_RESCAN: %v", err) }
+	prio, err := strconv.Atoi(mustEnv("PS_TC_PRIO", "1"))
+	if err != nil { log.Fatalf("PS_TC_PRIO: %v", err) }
+	tca, err := newTCAttacher(mustEnv("PS_TC_MODE", mechAuto), mustEnv("PS_TCX_ANCHOR", "head"), prio)
+	if err != nil { log.Fatalf("tc: %v", err) }
+	att := newAttacher(prog, specs, tca)
+	att.sync()
+	att.report()
+	if att.live() == 0 { log.Fatalf("tc attach: no live links") }
+	log.Printf("tc attach mechanism: %s", tca.mode)
+	go att.run(ctx, rescan)
 
 	// 핀 확인 로그
 	files, _ := os.ReadDir(pinRoot)
@@ -106,5 +128,89 @@ func main() {
 	for _, f := range files { names = append(names, f.Name()) }
 
 	log.Printf("psbench loader up. maps pinned in %s: %s", pinRoot, strings.Join(names, ","))
-	for { time.Sleep(1 * time.Hour) }
+
+	// m_metrics → /metrics + JSONL(stdout)
+	metricsAddr := mustEnv("PS_METRICS_ADDR", ":9464")
+	interval, err := time.ParseDuration(mustEnv("PS_METRICS_INTERVAL", "1s"))
+	if err != nil { log.Fatalf("metrics interval: %v", err) }
+	exp := newExporter(coll.Maps["m_metrics"])
+	go exp.run(ctx, interval)
+
+	// m_ring → 샘플 이벤트 JSONL (PS_EVENTS_OUT 미지정 시 stdout)
+	var (
+		rd     *ringbuf.Reader
+		evOut  *os.File
+		evDone = make(chan struct{}) // runEvents 종료
+	)
+	if sampleRate > 0 {
+		evOut = os.Stdout
+		if p := os.Getenv("PS_EVENTS_OUT"); p != "" {
+			evOut, err = os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil { log.Fatalf("events out: %v", err) }
+		}
+		rd, err = ringbuf.NewReader(coll.Maps["m_ring"])
+		if err != nil { log.Fatalf("ringbuf reader: %v", err) }
+		go func() {
+			defer close(evDone)
+			runEvents(rd, exp.node, evOut)
+		}()
+	} else {
+		close(evDone)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exp)
+	mux.Handle("/status", att)
+	srv := &http.Server{Addr: metricsAddr, Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("metrics http: %v", err)
+		}
+	}()
+
+	// controller용 로컬 API (테이블 apply / flip / status). 노출 규칙은 api.go
+	dp, err := maps.New(coll.Maps)
+	if err != nil { log.Fatalf("datapath maps: %v", err) }
+	var token string
+	if p := os.Getenv("PS_API_TOKEN_FILE"); p != "" {
+		token, err = api.ReadToken(p)
+		if err != nil { log.Fatalf("PS_API_TOKEN_FILE: %v", err) }
+	}
+	apiAddr := apiAddrs(os.Getenv("PS_API_ADDR"), os.Getenv("PS_NODE_IP"))
+	if token == "" && !api.LoopbackOnly(apiAddr) { log.Fatalf("loader API on %s needs PS_API_TOKEN_FILE (or bind to loopback only)", strings.Join(apiAddr, ",")) }
+	if token == "" { log.Printf("api: no token, loopback only") }
+	apiHandler := newAPIServer(dp, exp.node, att).handler(token)
+	var apiSrvs []*http.Server
+	for _, a := range apiAddr {
+		apiSrv := &http.Server{Addr: a, Handler: apiHandler}
+		apiSrvs = append(apiSrvs, apiSrv)
+		go func() {
+			if err := apiSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("api http %s: %v", apiSrv.Addr, err)
+			}
+		}()
+	}
+	log.Printf("api listening on %s", strings.Join(apiAddr, ","))
+
+	<-ctx.Done()
+	log.Printf("shutting down")
+
+	// 순서: 트래픽 경로에서 먼저 분리 → 리더/서버 정리 → 핀 제거
+	att.closeAll()
+	if rd != nil { _ = rd.Close() }
+	<-evDone // 마지막 이벤트까지 쓴 뒤에 파일을 닫는다
+	if evOut != nil && evOut != os.Stdout {
+		if err := evOut.Sync(); err != nil { log.Printf("events out: %v", err) }
+		if err := evOut.Close(); err != nil { log.Printf("events out: %v", err) }
+	}
+	sctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	_ = srv.Shutdown(sctx)
+	for _, s := range apiSrvs { _ = s.Shutdown(sctx) }
+	cancel()
+	if *keepPins {
+		log.Printf("keeping pins in %s", pinRoot)
+	} else {
+		unpinAll(coll, pinRoot)
+	}
+	coll.Close()
 }
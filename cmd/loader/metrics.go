@@ -0,0 +1,110 @@
+package main
+
+// m_metrics 주기 판독: CPU 합산값을 /metrics(Prometheus text)로 노출하고,
+// 주기마다 증가율을 JSONL로 표준출력에 남긴다(스윕 결과에 커널측 드롭/복제 수 포함용).
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/yourorg/psbench/pkg/maps"
+)
+
+type metricsRec struct {
+	Kind        string             `json:"kind"`
+	TS          time.Time          `json:"ts"`
+	Node        string             `json:"node"`
+	Tier1Clones uint64             `json:"tier1_clones"`
+	Tier2Clones uint64             `json:"tier2_clones"`
+	Tier1Rate   float64            `json:"tier1_clones_per_s"`
+	Tier2Rate   float64            `json:"tier2_clones_per_s"`
+	Drops       map[string]uint64  `json:"drops"`
+	DropRates   map[string]float64 `json:"drops_per_s"`
+	Skipped     uint64             `json:"skipped"` // 통과시킨 다른 트래픽 (비IP, 비UDP, 필터에 안 맞는 UDP)
+	SkipRate    float64            `json:"skipped_per_s"`
+}
+
+type exporter struct {
+	m    *ebpf.Map
+	node string
+}
+
+func newExporter(m *ebpf.Map) *exporter {
+	node, _ := os.Hostname() // hostNetwork → 노드명
+	return &exporter{m: m, node: node}
+}
+
+// run: ctx 종료까지 interval마다 판독하여 직전 값 대비 rate를 JSONL로 출력.
+func (e *exporter) run(ctx context.Context, interval time.Duration) {
+	prev, err := maps.ReadMetrics(e.m)
+	if err != nil { log.Printf("metrics: %v", err) }
+	prevTS := time.Now()
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-tick.C:
+		}
+		cur, err := maps.ReadMetrics(e.m)
+		if err != nil {
+			log.Printf("metrics: %v", err)
+			continue
+		}
+		dt := now.Sub(prevTS).Seconds()
+		rec := metricsRec{
+			Kind:        "metrics",
+			TS:          now,
+			Node:        e.node,
+			Tier1Clones: cur.Tier1Clones,
+			Tier2Clones: cur.Tier2Clones,
+			Tier1Rate:   float64(cur.Tier1Clones-prev.Tier1Clones) / dt,
+			Tier2Rate:   float64(cur.Tier2Clones-prev.Tier2Clones) / dt,
+			Drops:       map[string]uint64{},
+			DropRates:   map[string]float64{},
+			Skipped:     cur.Skipped,
+			SkipRate:    float64(cur.Skipped-prev.Skipped) / dt,
+		}
+		for r := maps.DrOK + 1; r < maps.DrMax; r++ {
+			name := maps.DropReasons[r]
+			rec.Drops[name] = cur.Drops[r]
+			rec.DropRates[name] = float64(cur.Drops[r]-prev.Drops[r]) / dt
+		}
+		j, _ := json.Marshal(rec)
+		os.Stdout.Write(append(j, '\n')) // 이벤트 JSONL과 섞이지 않도록 한 번에
+		prev, prevTS = cur, now
+	}
+}
+
+// ServeHTTP: 스크레이프 시점 값을 그대로 노출 (rate 계산은 Prometheus 쪽에서).
+func (e *exporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	cur, err := maps.ReadMetrics(e.m)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP psbench_tier1_clones_total Tier-1 (topic->node) clones made by the tc program.")
+	fmt.Fprintln(w, "# TYPE psbench_tier1_clones_total counter")
+	fmt.Fprintf(w, "psbench_tier1_clones_total %d\n", cur.Tier1Clones)
+	fmt.Fprintln(w, "# HELP psbench_tier2_clones_total Tier-2 (node->local subscriber) clones made by the tc program.")
+	fmt.Fprintln(w, "# TYPE psbench_tier2_clones_total counter")
+	fmt.Fprintf(w, "psbench_tier2_clones_total %d\n", cur.Tier2Clones)
+	fmt.Fprintln(w, "# HELP psbench_drops_total Packets the tc program could not fan out, by reason.")
+	fmt.Fprintln(w, "# TYPE psbench_drops_total counter")
+	for r := maps.DrOK + 1; r < maps.DrMax; r++ {
+		fmt.Fprintf(w, "psbench_drops_total{drop_reason=%q} %d\n", maps.DropReasons[r], cur.Drops[r])
+	}
+	fmt.Fprintln(w, "# HELP psbench_skipped_total Non-psbench packets (non-IP, non-UDP, UDP outside the configured ports/header) passed through untouched.")
+	fmt.Fprintln(w, "# TYPE psbench_skipped_total counter")
+	fmt.Fprintf(w, "psbench_skipped_total %d\n", cur.Skipped)
+}
@@ -0,0 +1,69 @@
+package main
+
+// bpffs 핀 관리: 기동 시 이전 실행이 남긴 핀 점검, 종료 시 정리.
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/cilium/ebpf"
+)
+
+const (
+	pinsAdopt = "adopt" // spec과 호환되는 핀은 재사용(내용 유지), 비호환 핀만 삭제
+	pinsWipe  = "wipe"  // 호환 여부와 무관하게 모두 삭제 후 새로 생성
+)
+
+// checkPins: root 아래 핀을 spec과 비교해 채택/삭제한다.
+// spec에 없는 이름(이전 오브젝트의 잔재)은 항상 삭제한다.
+func checkPins(spec *ebpf.CollectionSpec, root, mode string) error {
+	if mode != pinsAdopt && mode != pinsWipe {
+		return fmt.Errorf("unknown pin mode %q (want %s|%s)", mode, pinsAdopt, pinsWipe)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) { return nil }
+		return err
+	}
+	for _, e := range entries {
+		path := filepath.Join(root, e.Name())
+		ms, ok := spec.Maps[e.Name()]
+		if !ok {
+			log.Printf("pins: %s not in object, removing", e.Name())
+			if err := os.Remove(path); err != nil { return err }
+			continue
+		}
+		m, err := ebpf.LoadPinnedMap(path, nil)
+		if err != nil {
+			log.Printf("pins: %s unreadable (%v), removing", e.Name(), err)
+			if err := os.Remove(path); err != nil { return err }
+			continue
+		}
+		cerr := ms.Compatible(m)
+		m.Close()
+		switch {
+		case cerr != nil:
+			log.Printf("pins: %s incompatible with object (%v), removing", e.Name(), cerr)
+		case mode == pinsWipe:
+			log.Printf("pins: %s wiped", e.Name())
+		default:
+			log.Printf("pins: %s adopted", e.Name())
+			continue
+		}
+		if err := os.Remove(path); err != nil { return err }
+	}
+	return nil
+}
+
+// unpinAll: 컬렉션 맵 핀 제거 후 비어 있으면 root도 제거.
+func unpinAll(coll *ebpf.Collection, root string) {
+	for name, m := range coll.Maps {
+		if err := m.Unpin(); err != nil {
+			log.Printf("unpin %s: %v", name, err)
+		}
+	}
+	_ = os.Remove(root)
+}
@@ -0,0 +1,181 @@
+package main
+
+// tc attach 메커니즘 선택.
+// - tcx: 커널 6.6+ bpf_link 기반. 앵커로 다른 프로그램(Cilium 등) 앞/뒤 순서 지정
+// - netlink: 구형 커널. clsact qdisc + direct-action bpf 필터(우선순위 지정)
+// PS_TC_MODE=auto(기본)면 첫 attach에서 TCX 지원 여부를 보고 결정한다.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	mechAuto    = "auto"
+	mechTCX     = "tcx"
+	mechNetlink = "netlink"
+)
+
+// tcxAnchor: PS_TCX_ANCHOR = head | tail | before:<prog id|name> | after:<prog id|name>
+type tcxAnchor struct {
+	where  string
+	target string
+}
+
+func parseAnchor(s string) (tcxAnchor, error) {
+	where, target, _ := strings.Cut(s, ":")
+	switch where {
+	case "head", "tail":
+		if target != "" { return tcxAnchor{}, fmt.Errorf("anchor %q takes no target", where) }
+	case "before", "after":
+		if target == "" { return tcxAnchor{}, fmt.Errorf("anchor %q needs a program id or name", where) }
+	default:
+		return tcxAnchor{}, fmt.Errorf("unknown anchor %q (want head|tail|before:<prog>|after:<prog>)", s)
+	}
+	return tcxAnchor{where: where, target: target}, nil
+}
+
+// resolve: 대상 프로그램은 장치/방향마다 다르므로 attach 시점에 찾는다.
+// 대상이 아직 없으면 오류로 남겨 재스캔 때 다시 시도한다 (head/tail로 바꾸면 순서가 조용히 뒤집힌다).
+func (a tcxAnchor) resolve(ifindex int, attach ebpf.AttachType) (link.Anchor, error) {
+	switch a.where {
+	case "head":
+		return link.Head(), nil
+	case "tail":
+		return link.Tail(), nil
+	}
+	id, err := a.targetID(ifindex, attach)
+	if err != nil { return nil, err }
+	switch {
+	case id == 0:
+		return nil, fmt.Errorf("anchor %s:%s: no such program attached here", a.where, a.target)
+	case a.where == "before":
+		return link.BeforeProgramByID(id), nil
+	default:
+		return link.AfterProgramByID(id), nil
+	}
+}
+
+func (a tcxAnchor) targetID(ifindex int, attach ebpf.AttachType) (ebpf.ProgramID, error) {
+	if id, err := strconv.ParseUint(a.target, 10, 32); err == nil {
+		return ebpf.ProgramID(id), nil
+	}
+	res, err := link.QueryPrograms(link.QueryOptions{Target: ifindex, Attach: attach})
+	if err != nil { return 0, fmt.Errorf("query tcx programs: %w", tcxQueryErr(err)) }
+	// 커널 프로그램 이름은 15자까지만 보존된다
+	name := a.target
+	if len(name) > unix.BPF_OBJ_NAME_LEN-1 { name = name[:unix.BPF_OBJ_NAME_LEN-1] }
+	for _, ap := range res.Programs {
+		p, err := ebpf.NewProgramFromID(ap.ID)
+		if err != nil { continue }
+		info, err := p.Info()
+		p.Close()
+		if err == nil && info.Name == name { return ap.ID, nil }
+	}
+	return 0, nil
+}
+
+// tcxQueryErr: 6.6 이전 커널은 tcx attach type 조회를 EINVAL로 거절한다.
+// attach 전에 조회하는 before/after 앵커도 auto 모드에서 netlink로 넘어가도록 ErrNotSupported로 바꾼다.
+func tcxQueryErr(err error) error {
+	if errors.Is(err, unix.EINVAL) && !errors.Is(err, ebpf.ErrNotSupported) { return fmt.Errorf("%w: %w", ebpf.ErrNotSupported, err) }
+	return err
+}
+
+type tcAttacher struct {
+	mode   string // auto|tcx|netlink, auto는 첫 attach 후 확정
+	anchor tcxAnchor
+	prio   uint16 // netlink 필터 우선순위
+}
+
+func newTCAttacher(mode, anchor string, prio int) (*tcAttacher, error) {
+	switch mode {
+	case mechAuto, mechTCX, mechNetlink:
+	default:
+		return nil, fmt.Errorf("unknown tc mode %q (want %s|%s|%s)", mode, mechAuto, mechTCX, mechNetlink)
+	}
+	an, err := parseAnchor(anchor)
+	if err != nil { return nil, err }
+	if prio < 1 || prio > 0xffff { return nil, fmt.Errorf("filter priority %d out of range", prio) }
+	return &tcAttacher{mode: mode, anchor: an, prio: uint16(prio)}, nil
+}
+
+// attach: 사용한 메커니즘 이름과 함께 반환.
+func (t *tcAttacher) attach(prog *ebpf.Program, ifindex int, dir string) (io.Closer, string, error) {
+	if t.mode != mechNetlink {
+		l, err := t.attachTCX(prog, ifindex, dir)
+		if err == nil {
+			t.mode = mechTCX
+			return l, mechTCX, nil
+		}
+		if t.mode == mechTCX || !errors.Is(err, ebpf.ErrNotSupported) {
+			return nil, mechTCX, err
+		}
+		t.mode = mechNetlink // 커널이 TCX 미지원 → 이후 전부 netlink
+	}
+	c, err := t.attachNetlink(prog, ifindex, dir)
+	return c, mechNetlink, err
+}
+
+func (t *tcAttacher) attachTCX(prog *ebpf.Program, ifindex int, dir string) (link.Link, error) {
+	at := ebpf.AttachTCXIngress
+	if dir == dirEgress { at = ebpf.AttachTCXEgress }
+	anchor, err := t.anchor.resolve(ifindex, at)
+	if err != nil { return nil, err }
+	return link.AttachTCX(link.TCXOptions{
+		Interface: ifindex,
+		Program:   prog,
+		Attach:    at,
+		Anchor:    anchor,
+	})
+}
+
+// netlinkFilter: clsact 위 direct-action 필터. Close 시 필터만 지운다
+// (clsact qdisc는 Cilium 등 다른 사용자와 공유될 수 있으므로 남겨둔다).
+type netlinkFilter struct {
+	f *netlink.BpfFilter
+}
+
+func (n *netlinkFilter) Close() error {
+	return netlink.FilterDel(n.f)
+}
+
+func (t *tcAttacher) attachNetlink(prog *ebpf.Program, ifindex int, dir string) (io.Closer, error) {
+	qdisc := &netlink.GenericQdisc{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: ifindex,
+			Handle:    netlink.MakeHandle(0xffff, 0),
+			Parent:    netlink.HANDLE_CLSACT,
+		},
+		QdiscType: "clsact",
+	}
+	if err := netlink.QdiscReplace(qdisc); err != nil {
+		return nil, fmt.Errorf("clsact qdisc: %w", err)
+	}
+	parent := uint32(netlink.HANDLE_MIN_INGRESS)
+	if dir == dirEgress { parent = netlink.HANDLE_MIN_EGRESS }
+	f := &netlink.BpfFilter{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: ifindex,
+			Parent:    parent,
+			Handle:    1,
+			Protocol:  unix.ETH_P_ALL,
+			Priority:  t.prio,
+		},
+		Fd:           prog.FD(),
+		Name:         "tc_hier_pubsub",
+		DirectAction: true,
+	}
+	if err := netlink.FilterReplace(f); err != nil {
+		return nil, fmt.Errorf("bpf filter: %w", err)
+	}
+	return &netlinkFilter{f: f}, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"golang.org/x/sys/unix"
+)
+
+// 구형 커널의 조회 실패(EINVAL)는 auto 모드가 netlink로 넘어가도록 ErrNotSupported여야 한다.
+func TestTCXQueryErr(t *testing.T) {
+	for _, tc := range []struct {
+		err         error
+		unsupported bool
+	}{
+		{fmt.Errorf("query programs: %w", unix.EINVAL), true},
+		{fmt.Errorf("query programs: %w", ebpf.ErrNotSupported), true},
+		{fmt.Errorf("query programs: %w", unix.ENODEV), false},
+		{fmt.Errorf("query programs: %w", unix.EPERM), false},
+	} {
+		got := tcxQueryErr(tc.err)
+		if errors.Is(got, ebpf.ErrNotSupported) != tc.unsupported {
+			t.Errorf("%v: ErrNotSupported = %v, want %v", tc.err, !tc.unsupported, tc.unsupported)
+		}
+		if !errors.Is(got, errors.Unwrap(tc.err)) {
+			t.Errorf("%v: lost the original error: %v", tc.err, got)
+		}
+	}
+}
+
+func TestParseAnchor(t *testing.T) {
+	for _, s := range []string{"head", "tail", "before:cil_from_netdev", "after:42"} {
+		if _, err := parseAnchor(s); err != nil {
+			t.Errorf("%q: %v", s, err)
+		}
+	}
+	for _, s := range []string{"", "middle", "head:1", "before", "after:"} {
+		if _, err := parseAnchor(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/yourorg/psbench/pkg/maps"
+)
+
+type configView struct {
+	ActiveGen         uint32 `json:"active_gen"`
+	LocalNodeID       uint32 `json:"local_node_id"`
+	EgressIfindex     uint32 `json:"egress_ifindex"`
+	LocalRouteIfindex uint32 `json:"local_route_ifindex"`
+	SampleRate        uint32 `json:"sample_rate"`
+	Tier1Port         uint16 `json:"tier1_port"`
+	Tier2PortMin      uint16 `json:"tier2_port_min"`
+	Tier2PortMax      uint16 `json:"tier2_port_max"`
+	HdrMagic          uint16 `json:"hdr_magic"`
+	HdrMagicMask      uint16 `json:"hdr_magic_mask"`
+}
+
+// genView: 한 세대. 개수는 카운트 맵(데이터패스가 보는 값) 기준.
+type genView struct {
+	Gen         uint32      `json:"gen"`
+	Active      bool        `json:"active"`
+	Topics      int         `json:"topics"`
+	LocalSets   int         `json:"local_sets"`
+	Subscribers int         `json:"subscribers"` // 로컬 집합 원소 합
+	Tables      maps.Tables `json:"tables"`
+}
+
+type metricsView struct {
+	Tier1Clones uint64            `json:"tier1_clones"`
+	Tier2Clones uint64            `json:"tier2_clones"`
+	Drops       map[string]uint64 `json:"drops"`
+	Skipped     uint64            `json:"skipped"` // psbench 트래픽이 아님 (드롭 아님)
+}
+
+type diffView struct {
+	From    uint32   `json:"from"`
+	To      uint32   `json:"to"`
+	Changes []string `json:"changes"`
+}
+
+type showView struct {
+	Config  configView   `json:"config"`
+	Gens    [2]genView   `json:"gens"`
+	Metrics *metricsView `json:"metrics,omitempty"` // m_metrics 핀이 없으면 생략
+}
+
+func (in *inspector) out(v any, text func()) error {
+	if !in.json {
+		text()
+		return nil
+	}
+	enc := json.NewEncoder(in.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (in *inspector) resolveGen(sel string) (uint32, error) {
+	switch sel {
+	case "active", "inactive":
+		a, err := in.s.ActiveGen()
+		if err != nil { return 0, err }
+		if sel == "inactive" { a = 1 - a }
+		return a, nil
+	case "0", "1":
+		g, _ := strconv.Atoi(sel)
+		return uint32(g), nil
+	}
+	return 0, fmt.Errorf("generation %q: want 0|1|active|inactive", sel)
+}
+
+func (in *inspector) gen(gen uint32) (genView, error) {
+	g := genView{Gen: gen}
+	a, err := in.s.ActiveGen()
+	if err != nil { return g, err }
+	g.Active = a == gen
+	c, err := in.s.Counts(gen)
+	if err != nil { return g, err }
+	g.Topics, g.LocalSets = len(c.Topics), len(c.Local)
+	for _, n := range c.Local {
+		g.Subscribers += int(n)
+	}
+	if g.Tables, err = in.s.ReadGeneration(gen); err != nil { return g, fmt.Errorf("gen %d: %w", gen, err) }
+	return g, nil
+}
+
+func (in *inspector) readMetrics() (metricsView, error) {
+	if in.metrics == nil { return metricsView{}, fmt.Errorf("m_metrics is not pinned") }
+	m, err := in.metrics()
+	if err != nil { return metricsView{}, err }
+	v := metricsView{Tier1Clones: m.Tier1Clones, Tier2Clones: m.Tier2Clones, Drops: map[string]uint64{}, Skipped: m.Skipped}
+	for i, n := range m.Drops {
+		v.Drops[maps.DropReasons[i]] = n
+	}
+	return v, nil
+}
+
+func (in *inspector) diff(from, to string) (diffView, error) {
+	var d diffView
+	var err error
+	if d.From, err = in.resolveGen(from); err != nil { return d, err }
+	if d.To, err = in.resolveGen(to); err != nil { return d, err }
+	a, err := in.s.ReadGeneration(d.From)
+	if err != nil { return d, fmt.Errorf("gen %d: %w", d.From, err) }
+	b, err := in.s.ReadGeneration(d.To)
+	if err != nil { return d, fmt.Errorf("gen %d: %w", d.To, err) }
+	d.Changes = maps.Diff(a, b)
+	if d.Changes == nil { d.Changes = []string{} }
+	return d, nil
+}
+
+func (in *inspector) show() error {
+	var v showView
+	c, err := in.s.Config()
+	if err != nil { return err }
+	v.Config = toConfigView(c)
+	for gen := range v.Gens {
+		if v.Gens[gen], err = in.gen(uint32(gen)); err != nil { return err }
+	}
+	if in.metrics != nil {
+		m, err := in.readMetrics()
+		if err != nil { return err }
+		v.Metrics = &m
+	}
+	return in.out(v, func() {
+		printConfig(in.w, c)
+		// 활성 세대 먼저
+		a := c.ActiveGen & 1
+		for _, gen := range []uint32{a, 1 - a} {
+			fmt.Fprintln(in.w)
+			printGen(in.w, v.Gens[gen])
+		}
+		if v.Metrics != nil {
+			fmt.Fprintln(in.w)
+			printMetrics(in.w, *v.Metrics)
+		}
+	})
+}
+
+func toConfigView(c maps.Config) configView {
+	return configView{
+		ActiveGen:         c.ActiveGen,
+		LocalNodeID:       c.LocalNodeID,
+		EgressIfindex:     c.EgressIfindex,
+		LocalRouteIfindex: c.LocalRouteIfindex,
+		SampleRate:        c.SampleRate,
+		Tier1Port:         c.Tier1Port,
+		Tier2PortMin:      c.Tier2PortMin,
+		Tier2PortMax:      c.Tier2PortMax,
+		HdrMagic:          c.HdrMagic,
+		HdrMagicMask:      c.HdrMagicMask,
+	}
+}
+
+func printConfig(w io.Writer, c maps.Config) {
+	fmt.Fprintf(w, "m_cfg: active_gen=%d local_node_id=%d egress_ifindex=%d local_route_ifindex=%d sample_rate=%d\n",
+		c.ActiveGen, c.LocalNodeID, c.EgressIfindex, c.LocalRouteIfindex, c.SampleRate)
+	if !c.PortFiltered() {
+		fmt.Fprintln(w, "  filter: off (all UDP)")
+		return
+	}
+	fmt.Fprintf(w, "  filter: tier1_port=%d tier2_ports=%d-%d", c.Tier1Port, c.Tier2PortMin, c.Tier2PortMax)
+	if c.HdrMagicMask != 0 { fmt.Fprintf(w, " hdr_magic=%#04x/%#04x", c.HdrMagic, c.HdrMagicMask) }
+	fmt.Fprintln(w)
+}
+
+func printGen(w io.Writer, g genView) {
+	state := "inactive"
+	if g.Active { state = "active" }
+	fmt.Fprintf(w, "gen%d (%s): %d topics, %d local sets, %d local subscribers\n", g.Gen, state, g.Topics, g.LocalSets, g.Subscribers)
+
+	tIDs := make([]uint32, 0, len(g.Tables.Topics))
+	for id := range g.Tables.Topics {
+		tIDs = append(tIDs, id)
+	}
+	sort.Slice(tIDs, func(i, j int) bool { return tIDs[i] < tIDs[j] })
+	for _, id := range tIDs {
+		dests := g.Tables.Topics[id]
+		fmt.Fprintf(w, "  topic %d → %d nodes\n", id, len(dests))
+		for _, d := range dests {
+			fmt.Fprintf(w, "    node %-3d %s\n", d.NodeID, d.Dest)
+		}
+	}
+
+	var keys []maps.LocalKey
+	for nID, byTopic := range g.Tables.Nodes {
+		for tID := range byTopic {
+			keys = append(keys, maps.LocalKey{NodeID: nID, TopicID: tID})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].NodeID != keys[j].NodeID { return keys[i].NodeID < keys[j].NodeID }
+		return keys[i].TopicID < keys[j].TopicID
+	})
+	for _, k := range keys {
+		subs := g.Tables.Nodes[k.NodeID][k.TopicID]
+		fmt.Fprintf(w, "  node %d topic %d → %d subscribers\n", k.NodeID, k.TopicID, len(subs))
+		for _, s := range subs {
+			dev := "local_route"
+			if s.Ifindex != 0 { dev = fmt.Sprintf("if%d", s.Ifindex) }
+			fmt.Fprintf(w, "    %s via %s\n", s.Dest, dev)
+		}
+	}
+}
+
+func printMetrics(w io.Writer, m metricsView) {
+	fmt.Fprintf(w, "m_metrics (all CPUs): tier1_clones=%d tier2_clones=%d skipped=%d\n", m.Tier1Clones, m.Tier2Clones, m.Skipped)
+	for _, r := range maps.DropReasons {
+		fmt.Fprintf(w, "  %-12s %d\n", r, m.Drops[r])
+	}
+}
+
+func printDiff(w io.Writer, d diffView) {
+	fmt.Fprintf(w, "gen%d → gen%d: %d changes\n", d.From, d.To, len(d.Changes))
+	for _, l := range d.Changes {
+		fmt.Fprintf(w, "  %s\n", l)
+	}
+}
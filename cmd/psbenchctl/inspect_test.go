@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/yourorg/psbench/pkg/maps"
+)
+
+func testInspector(t *testing.T, jsonOut bool) (*inspector, *bytes.Buffer) {
+	t.Helper()
+	dp := maps.NewFake()
+	old := maps.Tables{Topics: map[uint32][]maps.NodeDest{1: {{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")}}}}
+	cur := maps.Tables{
+		Topics: map[uint32][]maps.NodeDest{1: {{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")}, {NodeID: 1, Dest: netip.MustParseAddrPort("192.168.0.11:32000")}}},
+		Nodes:  map[uint32]map[uint32][]maps.SubDest{1: {1: {{Dest: netip.MustParseAddrPort("10.1.1.1:31001")}, {Ifindex: 9, Dest: netip.MustParseAddrPort("10.1.1.2:31002")}}}},
+	}
+	if err := dp.WriteGeneration(0, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := dp.WriteGeneration(1, cur); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dp.UpdateConfig(func(c *maps.Config) { c.ActiveGen, c.LocalNodeID = 1, 1 }); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	in := &inspector{s: dp, json: jsonOut, w: &buf}
+	in.metrics = func() (maps.Metrics, error) {
+		m := maps.Metrics{Tier1Clones: 10, Tier2Clones: 20}
+		m.Drops[maps.DrNoTopic] = 3
+		return m, nil
+	}
+	return in, &buf
+}
+
+func TestShowText(t *testing.T) {
+	in, buf := testInspector(t, false)
+	if err := in.run(nil); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"active_gen=1 local_node_id=1",
+		"gen1 (active): 1 topics, 1 local sets, 2 local subscribers",
+		"node 1   192.168.0.11:32000",
+		"node 1 topic 1 → 2 subscribers",
+		"10.1.1.2:31002 via if9",
+		"gen0 (inactive): 1 topics, 0 local sets",
+		"tier1_clones=10 tier2_clones=20",
+		"no_topic     3",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "gen1 (active)") > strings.Index(out, "gen0 (inactive)") {
+		t.Errorf("active generation not listed first:\n%s", out)
+	}
+}
+
+func TestShowJSON(t *testing.T) {
+	in, buf := testInspector(t, true)
+	if err := in.run([]string{"show"}); err != nil {
+		t.Fatal(err)
+	}
+	var v showView
+	if err := json.Unmarshal(buf.Bytes(), &v); err != nil {
+		t.Fatalf("%v\n%s", err, buf)
+	}
+	if !v.Gens[1].Active || v.Gens[1].Subscribers != 2 || len(v.Gens[1].Tables.Topics[1]) != 2 {
+		t.Errorf("gen1 = %+v", v.Gens[1])
+	}
+	if v.Metrics == nil || v.Metrics.Drops["no_topic"] != 3 {
+		t.Errorf("metrics = %+v", v.Metrics)
+	}
+}
+
+func TestDiffCommand(t *testing.T) {
+	in, buf := testInspector(t, true)
+	if err := in.run([]string{"diff", "inactive", "active"}); err != nil {
+		t.Fatal(err)
+	}
+	var d diffView
+	if err := json.Unmarshal(buf.Bytes(), &d); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"topic 1: + node 1 192.168.0.11:32000",
+		"node 1 topic 1: + 10.1.1.1:31001",
+		"node 1 topic 1: + 10.1.1.2:31002 if9",
+	}
+	if d.From != 0 || d.To != 1 || strings.Join(d.Changes, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diff = %+v, want 0→1 %q", d, want)
+	}
+
+	for _, args := range [][]string{{"diff", "0"}, {"gen", "0", "1"}, {"bogus"}} {
+		if err := in.run(args); !errors.Is(err, errUsage) {
+			t.Errorf("%v: err = %v, want usage", args, err)
+		}
+	}
+	if err := in.run([]string{"gen", "2"}); err == nil {
+		t.Errorf("gen 2 accepted")
+	}
+}
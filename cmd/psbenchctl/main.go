@@ -0,0 +1,136 @@
+package main
+
+// psbenchctl: 노드에 핀된 데이터패스 상태 확인(bpftool 대신 디코딩된 IP/포트로)과 수동 프로그래밍.
+//
+//	psbenchctl [-pins DIR] [-o text|json] [show]   m_cfg + 양 세대 테이블 + m_metrics
+//	psbenchctl cfg                                 m_cfg
+//	psbenchctl gen [0|1|active|inactive]           한 세대의 topic→node / (node,topic)→구독자 집합
+//	psbenchctl metrics                             m_metrics (CPU 합산)
+//	psbenchctl diff [FROM TO]                      세대 간 차이 (기본 0 1)
+//	psbenchctl [-loader URL | -direct] topic|sub|truncate|count|flip|apply ...   수동 프로그래밍 (write.go)
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/cilium/ebpf"
+	"github.com/yourorg/psbench/pkg/api"
+	"github.com/yourorg/psbench/pkg/maps"
+)
+
+const defaultPinRoot = "/sys/fs/bpf/psbench"
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `usage: psbenchctl [flags] [command]
+  show | cfg | gen [0|1|active|inactive] | metrics | diff [FROM TO]
+  topic add TOPIC NODE ADDR:PORT | topic del TOPIC NODE [ADDR:PORT]
+  sub add NODE TOPIC ADDR:PORT [IFINDEX] | sub del NODE TOPIC ADDR:PORT
+  truncate topic TOPIC N | truncate sub NODE TOPIC N
+  count topic TOPIC N | count sub NODE TOPIC N
+  flip | apply FILE
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	pins := flag.String("pins", defaultPinRoot, "bpffs pin directory of the loader")
+	format := flag.String("o", "text", "output format: text|json")
+	loader := flag.String("loader", "http://127.0.0.1:9465", "loader API used for writes")
+	tokenFile := flag.String("token-file", os.Getenv("PS_API_TOKEN_FILE"), "loader API token file (default $PS_API_TOKEN_FILE)")
+	direct := flag.Bool("direct", false, "write pinned maps directly (only when no loader is running)")
+	flag.Usage = usage
+	flag.Parse()
+	log.SetFlags(0)
+	if *format != "text" && *format != "json" { log.Fatalf("-o %q: want text|json", *format) }
+
+	dp, err := maps.OpenPinned(*pins)
+	if err != nil { log.Fatalf("open %s: %v (is the loader running on this node?)", *pins, err) }
+	defer dp.Close()
+	in := &inspector{s: dp, json: *format == "json", w: os.Stdout}
+	client := api.NewClient(*loader)
+	if *tokenFile != "" {
+		if client.Token, err = api.ReadToken(*tokenFile); err != nil { log.Fatalf("-token-file: %v", err) }
+	}
+	in.apply = apiApplier{client}
+	if *direct {
+		// loader가 살아 있으면 writer가 둘이 된다 (토큰이 틀려 401이어도 살아 있는 것)
+		var he *api.HTTPError
+		if _, err := client.Status(context.Background()); err == nil || errors.As(err, &he) {
+			log.Fatalf("-direct: loader API %s is up; write through it instead", *loader)
+		}
+		in.apply = directApplier{dp}
+	}
+	if mm, err := ebpf.LoadPinnedMap(filepath.Join(*pins, "m_metrics"), nil); err == nil {
+		defer mm.Close()
+		in.metrics = func() (maps.Metrics, error) { return maps.ReadMetrics(mm) }
+	}
+
+	if err := in.run(flag.Args()); err != nil {
+		if errors.Is(err, errUsage) {
+			usage()
+			os.Exit(2)
+		}
+		log.Fatal(err)
+	}
+}
+
+var errUsage = errors.New("usage")
+
+// inspector: 명령 실행. metrics가 nil이면 m_metrics 핀이 없는 것.
+type inspector struct {
+	s       maps.Store
+	metrics func() (maps.Metrics, error)
+	apply   applier
+	json    bool
+	w       io.Writer
+}
+
+func (in *inspector) run(args []string) error {
+	cmd := "show"
+	if len(args) > 0 { cmd, args = args[0], args[1:] }
+	if writeCmds[cmd] { return in.write(context.Background(), cmd, args) }
+	switch cmd {
+	case "show":
+		if len(args) != 0 { return errUsage }
+		return in.show()
+	case "cfg":
+		if len(args) != 0 { return errUsage }
+		c, err := in.s.Config()
+		if err != nil { return err }
+		return in.out(c, func() { printConfig(in.w, c) })
+	case "gen":
+		sel := "active"
+		if len(args) > 1 { return errUsage }
+		if len(args) == 1 { sel = args[0] }
+		gen, err := in.resolveGen(sel)
+		if err != nil { return err }
+		g, err := in.gen(gen)
+		if err != nil { return err }
+		return in.out(g, func() { printGen(in.w, g) })
+	case "metrics":
+		if len(args) != 0 { return errUsage }
+		m, err := in.readMetrics()
+		if err != nil { return err }
+		return in.out(m, func() { printMetrics(in.w, m) })
+	case "diff":
+		from, to := "0", "1"
+		switch len(args) {
+		case 0:
+		case 2:
+			from, to = args[0], args[1]
+		default:
+			return errUsage
+		}
+		d, err := in.diff(from, to)
+		if err != nil { return err }
+		return in.out(d, func() { printDiff(in.w, d) })
+	default:
+		return errUsage
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+// 수동 프로그래밍 (Kubernetes 없는 랩: VM 두 대, netns).
+// 모든 쓰기는 controller와 같은 방식이다: 활성 세대 내용을 바탕으로 새 테이블 전체를 만들어
+// 비활성 세대에 쓰고, 다 써진 뒤에만 플립한다. 데이터패스는 반쯤 바뀐 집합을 보지 않는다.
+//
+//	topic add TOPIC NODE ADDR:PORT          topic → node 목적지 추가
+//	topic del TOPIC NODE [ADDR:PORT]        목적지 제거 (주소 생략 시 그 노드 전부)
+//	sub add NODE TOPIC ADDR:PORT [IFINDEX]  (node, topic) 로컬 구독자 추가 (IFINDEX 0 = local_route)
+//	sub del NODE TOPIC ADDR:PORT
+//	truncate topic TOPIC N                  집합을 앞쪽 N개로 자른다 (뒤쪽 원소는 버려지고 되살릴 수 없음, 0이면 집합 삭제)
+//	truncate sub NODE TOPIC N
+//	count topic TOPIC N                     활성 세대의 카운트만 N으로 (집합은 그대로, 0이나 집합보다 큰 값도 가능)
+//	count sub NODE TOPIC N
+//	flip                                    비활성 세대 내용을 활성으로 (직전 테이블로 되돌리기)
+//	apply FILE                              YAML/JSON 토폴로지 파일로 테이블 전체 교체
+//
+// count만 예외로 세대를 바꾸지 않고 활성 세대의 카운트 맵 한 칸을 바로 쓴다. 카운트 하나는 원자적으로 바뀌므로
+// 데이터패스가 반쯤 바뀐 상태를 보지는 않지만, 집합과 어긋난 카운트(잘린 fan-out, 빈 슬롯의 DR_FAMILY)를 일부러 만든다.
+// 다음 topic/sub/truncate/apply는 활성 세대에서 실제로 보이는 원소까지만 이어받아 카운트를 집합 크기로 되돌린다.
+//
+// 토폴로지 파일은 maps.Tables 모양에 이 노드의 node_id(생략 시 현재 값 유지)를 더한 것:
+//
+//	node_id: 0
+//	topics:
+//	  1: [{node_id: 0, addr: 192.168.0.10, port: 32000}, {node_id: 1, addr: 192.168.0.11, port: 32000}]
+//	nodes:
+//	  0: {1: [{addr: 10.1.0.1, port: 31001}]}
+//	  1: {1: [{addr: 10.1.1.1, port: 31001}]}
+//
+// 맵의 writer는 노드당 하나(pkg/maps/config.go)이므로 기본은 loader 로컬 API(-loader)로 쓴다.
+// loader가 없을 때(-keep-pins로 남긴 핀 등)만 -direct로 핀에 직접 쓴다.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"strconv"
+
+	"github.com/yourorg/psbench/pkg/api"
+	"github.com/yourorg/psbench/pkg/maps"
+	"sigs.k8s.io/yaml"
+)
+
+// applier: apply는 t를 비활성 세대에 쓰고 플립해 활성이 된 세대를, setCount는 활성 세대의 카운트 하나를 쓰고 그 세대를 돌려준다.
+type applier interface {
+	apply(ctx context.Context, t maps.Tables, nodeID uint32) (uint32, error)
+	setCount(ctx context.Context, req api.CountRequest) (uint32, error)
+}
+
+// apiApplier: loader의 apply → flip (pkg/api). controller가 관리 중인 loader면 그 term을 이어 쓴다.
+type apiApplier struct{ c *api.Client }
+
+func (a apiApplier) apply(ctx context.Context, t maps.Tables, nodeID uint32) (uint32, error) {
+	st, err := a.c.Status(ctx)
+	if err != nil { return 0, fmt.Errorf("loader API %s: %w (use -direct if no loader is running)", a.c.Base, err) }
+	if st.Term > 0 {
+		log.Printf("warning: loader is managed by a controller (term %d); its next push overwrites manual changes", st.Term)
+	}
+	version := "manual-" + t.Version()
+	if _, err := a.c.Apply(ctx, api.ApplyRequest{Version: version, NodeID: nodeID, Term: st.Term, Tables: t}); err != nil {
+		return 0, err
+	}
+	ack, err := a.c.Flip(ctx, version, st.Term)
+	return ack.Gen, err
+}
+
+func (a apiApplier) setCount(ctx context.Context, req api.CountRequest) (uint32, error) {
+	st, err := a.c.Status(ctx)
+	if err != nil { return 0, fmt.Errorf("loader API %s: %w (use -direct if no loader is running)", a.c.Base, err) }
+	if st.Term > 0 {
+		log.Printf("warning: loader is managed by a controller (term %d); its next push overwrites manual changes", st.Term)
+	}
+	req.Term = st.Term
+	ack, err := a.c.SetCount(ctx, req)
+	return ack.Gen, err
+}
+
+// directApplier: 핀에 직접 쓰기. loader가 없을 때만.
+type directApplier struct{ s maps.Store }
+
+func (d directApplier) apply(_ context.Context, t maps.Tables, nodeID uint32) (uint32, error) {
+	active, err := d.s.ActiveGen()
+	if err != nil { return 0, err }
+	inactive := 1 - active
+	if err := d.s.WriteGeneration(inactive, t); err != nil { return 0, fmt.Errorf("gen %d left partially written, not flipped: %w", inactive, err) }
+	_, err = d.s.UpdateConfig(func(c *maps.Config) { c.ActiveGen, c.LocalNodeID = inactive, nodeID })
+	return inactive, err
+}
+
+func (d directApplier) setCount(_ context.Context, req api.CountRequest) (uint32, error) {
+	active, err := d.s.ActiveGen()
+	if err != nil { return 0, err }
+	if req.Node == nil { return active, d.s.SetTopicCount(active, req.Topic, req.Count) }
+	return active, d.s.SetLocalCount(active, maps.LocalKey{NodeID: *req.Node, TopicID: req.Topic}, req.Count)
+}
+
+// topology: apply 입력 파일
+type topology struct {
+	NodeID *uint32 `json:"node_id,omitempty"`
+	maps.Tables
+}
+
+func readTopology(path string) (topology, error) {
+	var topo topology
+	b, err := os.ReadFile(path)
+	if err != nil { return topo, err }
+	if err := yaml.UnmarshalStrict(b, &topo); err != nil { return topo, fmt.Errorf("%s: %w", path, err) }
+	return topo, nil
+}
+
+var writeCmds = map[string]bool{"topic": true, "sub": true, "truncate": true, "count": true, "flip": true, "apply": true}
+
+// write: 활성 세대(또는 flip이면 비활성 세대)를 바탕으로 새 테이블을 만들어 적용하고 바뀐 내용을 출력한다.
+func (in *inspector) write(ctx context.Context, cmd string, args []string) error {
+	if in.apply == nil { return errors.New("no writer configured") }
+	if cmd == "count" { return in.count(ctx, args) }
+	c, err := in.s.Config()
+	if err != nil { return err }
+	active := c.ActiveGen & 1
+	before, err := in.s.ReadGeneration(active)
+	if err != nil { return fmt.Errorf("gen %d: %w", active, err) }
+	nodeID := c.LocalNodeID
+
+	var after maps.Tables
+	switch cmd {
+	case "flip":
+		if len(args) != 0 { return errUsage }
+		if after, err = in.s.ReadGeneration(1 - active); err != nil { return fmt.Errorf("gen %d: %w", 1-active, err) }
+	case "apply":
+		if len(args) != 1 { return errUsage }
+		topo, err := readTopology(args[0])
+		if err != nil { return err }
+		after = topo.Tables
+		if topo.NodeID != nil { nodeID = *topo.NodeID }
+	default:
+		after = cloneTables(before)
+		if err := editTables(&after, cmd, args); err != nil { return err }
+	}
+	if err := after.Validate(); err != nil { return err }
+
+	gen, err := in.apply.apply(ctx, after, nodeID)
+	if err != nil { return err }
+	d := diffView{From: active, To: gen, Changes: maps.Diff(before, after)}
+	if d.Changes == nil { d.Changes = []string{} }
+	return in.out(d, func() { printDiff(in.w, d) })
+}
+
+// countView: count 명령 결과 (카운트 맵 한 칸의 이전/이후 값)
+type countView struct {
+	Gen   uint32 `json:"gen"`
+	Key   string `json:"key"`
+	From  uint32 `json:"from"`
+	To    uint32 `json:"to"`
+	Slots int    `json:"slots"` // 새 카운트 안에서 실제로 쓰여 있는 원소 수
+}
+
+// count: count topic TOPIC N | count sub NODE TOPIC N
+func (in *inspector) count(ctx context.Context, args []string) error {
+	var req api.CountRequest
+	var err error
+	switch {
+	case len(args) == 3 && args[0] == "topic":
+		if req.Topic, req.Count, err = parseIDs(args[1], args[2]); err != nil { return err }
+	case len(args) == 4 && args[0] == "sub":
+		node, id, err := parseIDs(args[1], args[2])
+		if err != nil { return err }
+		n, err := strconv.ParseUint(args[3], 10, 32)
+		if err != nil { return fmt.Errorf("count %q: %w", args[3], err) }
+		req.Node, req.Topic, req.Count = &node, id, uint32(n)
+	default:
+		return errUsage
+	}
+	active, err := in.s.ActiveGen()
+	if err != nil { return err }
+	before, err := in.s.Counts(active)
+	if err != nil { return err }
+	v := countView{Key: fmt.Sprintf("topic %d", req.Topic), From: before.Topics[req.Topic], To: req.Count}
+	var lk maps.LocalKey
+	if req.Node != nil {
+		lk = maps.LocalKey{NodeID: *req.Node, TopicID: req.Topic}
+		v.Key, v.From = fmt.Sprintf("node %d topic %d", lk.NodeID, lk.TopicID), before.Local[lk]
+	}
+
+	if v.Gen, err = in.apply.setCount(ctx, req); err != nil { return err }
+	if req.Node == nil {
+		d, err := in.s.TopicNodeSet(v.Gen, req.Topic)
+		if err != nil { return err }
+		v.Slots = len(d)
+	} else {
+		s, err := in.s.NodeLocalSubs(v.Gen, lk)
+		if err != nil { return err }
+		v.Slots = len(s)
+	}
+	return in.out(v, func() {
+		fmt.Fprintf(in.w, "gen%d: %s count %d → %d", v.Gen, v.Key, v.From, v.To)
+		if v.To > uint32(v.Slots) { fmt.Fprintf(in.w, " (only %d programmed; the rest are empty slots)", v.Slots) }
+		fmt.Fprintln(in.w)
+	})
+}
+
+func cloneTables(t maps.Tables) maps.Tables {
+	out := maps.Tables{Topics: map[uint32][]maps.NodeDest{}, Nodes: map[uint32]map[uint32][]maps.SubDest{}}
+	for id, d := range t.Topics {
+		out.Topics[id] = append([]maps.NodeDest(nil), d...)
+	}
+	for nID, byTopic := range t.Nodes {
+		out.Nodes[nID] = map[uint32][]maps.SubDest{}
+		for tID, s := range byTopic {
+			out.Nodes[nID][tID] = append([]maps.SubDest(nil), s...)
+		}
+	}
+	return out
+}
+
+// editTables: topic/sub/truncate 명령을 t에 반영한다.
+func editTables(t *maps.Tables, cmd string, args []string) error {
+	if len(args) == 0 { return errUsage }
+	op, args := args[0], args[1:]
+	switch cmd + " " + op {
+	case "topic add":
+		if len(args) != 3 { return errUsage }
+		id, node, err := parseIDs(args[0], args[1])
+		if err != nil { return err }
+		ap, err := parseAddrPort(args[2])
+		if err != nil { return err }
+		nd := maps.NodeDest{NodeID: node, Dest: ap}
+		for _, d := range t.Topics[id] {
+			if d == nd { return fmt.Errorf("topic %d already has node %d %s", id, node, ap) }
+		}
+		t.Topics[id] = append(t.Topics[id], nd)
+	case "topic del":
+		if len(args) != 2 && len(args) != 3 { return errUsage }
+		id, node, err := parseIDs(args[0], args[1])
+		if err != nil { return err }
+		var ap netip.AddrPort
+		if len(args) == 3 {
+			if ap, err = parseAddrPort(args[2]); err != nil { return err }
+		}
+		kept := t.Topics[id][:0]
+		for _, d := range t.Topics[id] {
+			if d.NodeID == node && (!ap.IsValid() || d.Dest == ap) { continue }
+			kept = append(kept, d)
+		}
+		if len(kept) == len(t.Topics[id]) { return fmt.Errorf("topic %d has no such destination on node %d", id, node) }
+		setTopic(t, id, kept)
+	case "sub add":
+		if len(args) != 3 && len(args) != 4 { return errUsage }
+		node, id, err := parseIDs(args[0], args[1])
+		if err != nil { return err }
+		ap, err := parseAddrPort(args[2])
+		if err != nil { return err }
+		sd := maps.SubDest{Dest: ap}
+		if len(args) == 4 {
+			ifi, err := strconv.ParseUint(args[3], 10, 32)
+			if err != nil { return fmt.Errorf("ifindex %q: %w", args[3], err) }
+			sd.Ifindex = uint32(ifi)
+		}
+		for _, s := range t.Nodes[node][id] {
+			if s.Dest == sd.Dest { return fmt.Errorf("node %d topic %d already has %s", node, id, ap) }
+		}
+		if t.Nodes[node] == nil { t.Nodes[node] = map[uint32][]maps.SubDest{} }
+		t.Nodes[node][id] = append(t.Nodes[node][id], sd)
+	case "sub del":
+		if len(args) != 3 { return errUsage }
+		node, id, err := parseIDs(args[0], args[1])
+		if err != nil { return err }
+		ap, err := parseAddrPort(args[2])
+		if err != nil { return err }
+		subs := t.Nodes[node][id]
+		kept := subs[:0]
+		for _, s := range subs {
+			if s.Dest == ap { continue }
+			kept = append(kept, s)
+		}
+		if len(kept) == len(subs) { return fmt.Errorf("node %d topic %d has no subscriber %s", node, id, ap) }
+		setLocal(t, node, id, kept)
+	case "truncate topic":
+		if len(args) != 2 { return errUsage }
+		id, n, err := parseIDs(args[0], args[1])
+		if err != nil { return err }
+		if int(n) > len(t.Topics[id]) { return truncErr(n, len(t.Topics[id])) }
+		setTopic(t, id, t.Topics[id][:n])
+	case "truncate sub":
+		if len(args) != 3 { return errUsage }
+		node, id, err := parseIDs(args[0], args[1])
+		if err != nil { return err }
+		n, err := strconv.ParseUint(args[2], 10, 32)
+		if err != nil { return fmt.Errorf("count %q: %w", args[2], err) }
+		subs := t.Nodes[node][id]
+		if int(n) > len(subs) { return truncErr(uint32(n), len(subs)) }
+		setLocal(t, node, id, subs[:n])
+	default:
+		return errUsage
+	}
+	return nil
+}
+
+// 원소가 없는 집합은 만들지 않는다 (WriteGeneration이 카운트/슬롯을 지운다)
+func setTopic(t *maps.Tables, id uint32, d []maps.NodeDest) {
+	if len(d) == 0 {
+		delete(t.Topics, id)
+		return
+	}
+	t.Topics[id] = d
+}
+
+func setLocal(t *maps.Tables, node, id uint32, s []maps.SubDest) {
+	if len(s) > 0 {
+		t.Nodes[node][id] = s
+		return
+	}
+	delete(t.Nodes[node], id)
+	if len(t.Nodes[node]) == 0 { delete(t.Nodes, node) }
+}
+
+// 쓰기마다 새 inner 맵에 남는 원소만 쓰므로 잘린 원소는 어디에도 남지 않는다. 다시 늘리려면 add.
+func truncErr(n uint32, have int) error {
+	return fmt.Errorf("truncate to %d: set has only %d entries (truncate can only shrink a set; use add to grow it)", n, have)
+}
+
+func parseIDs(a, b string) (uint32, uint32, error) {
+	x, err := strconv.ParseUint(a, 10, 32)
+	if err != nil { return 0, 0, fmt.Errorf("%q: %w", a, err) }
+	y, err := strconv.ParseUint(b, 10, 32)
+	if err != nil { return 0, 0, fmt.Errorf("%q: %w", b, err) }
+	return uint32(x), uint32(y), nil
+}
+
+func parseAddrPort(s string) (netip.AddrPort, error) {
+	ap, err := netip.ParseAddrPort(s)
+	if err != nil { return ap, fmt.Errorf("address %q: want IP:PORT", s) }
+	return ap, nil
+}
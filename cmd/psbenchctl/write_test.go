@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yourorg/psbench/pkg/api"
+	"github.com/yourorg/psbench/pkg/maps"
+)
+
+func directInspector(t *testing.T) (*inspector, *maps.Fake, *bytes.Buffer) {
+	t.Helper()
+	dp := maps.NewFake()
+	var buf bytes.Buffer
+	return &inspector{s: dp, apply: directApplier{dp}, w: &buf}, dp, &buf
+}
+
+func TestWriteCommandsFlipGenerations(t *testing.T) {
+	in, dp, buf := directInspector(t)
+	steps := []struct {
+		args []string
+		gen  uint32 // 활성 세대
+		want maps.Tables
+		out  string
+	}{
+		{[]string{"topic", "add", "1", "0", "192.168.0.10:32000"}, 1,
+			maps.Tables{Topics: map[uint32][]maps.NodeDest{1: {{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")}}}},
+			"topic 1: + node 0 192.168.0.10:32000"},
+		{[]string{"sub", "add", "0", "1", "10.1.0.1:31001"}, 0,
+			maps.Tables{
+				Topics: map[uint32][]maps.NodeDest{1: {{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")}}},
+				Nodes:  map[uint32]map[uint32][]maps.SubDest{0: {1: {{Dest: netip.MustParseAddrPort("10.1.0.1:31001")}}}},
+			},
+			"node 0 topic 1: + 10.1.0.1:31001"},
+		{[]string{"truncate", "sub", "0", "1", "0"}, 1,
+			maps.Tables{Topics: map[uint32][]maps.NodeDest{1: {{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")}}}},
+			"node 0 topic 1: - 10.1.0.1:31001"},
+		// 직전 테이블로 되돌리기
+		{[]string{"flip"}, 0,
+			maps.Tables{
+				Topics: map[uint32][]maps.NodeDest{1: {{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")}}},
+				Nodes:  map[uint32]map[uint32][]maps.SubDest{0: {1: {{Dest: netip.MustParseAddrPort("10.1.0.1:31001")}}}},
+			},
+			"node 0 topic 1: + 10.1.0.1:31001"},
+	}
+	for i, s := range steps {
+		buf.Reset()
+		if err := in.run(s.args); err != nil {
+			t.Fatalf("step %d %v: %v", i, s.args, err)
+		}
+		gen, _ := dp.ActiveGen()
+		got, _ := dp.ReadGeneration(gen)
+		if gen != s.gen || maps.Diff(got, s.want) != nil {
+			t.Errorf("step %d %v: active gen %d = %+v, want gen %d %+v", i, s.args, gen, got, s.gen, s.want)
+		}
+		if !strings.Contains(buf.String(), s.out) {
+			t.Errorf("step %d %v: output %q lacks %q", i, s.args, buf.String(), s.out)
+		}
+	}
+}
+
+func TestApplyTopologyFile(t *testing.T) {
+	in, dp, _ := directInspector(t)
+	path := filepath.Join(t.TempDir(), "topo.yaml")
+	os.WriteFile(path, []byte(`
+node_id: 1
+topics:
+  1: [{node_id: 0, addr: 192.168.0.10, port: 32000}, {node_id: 1, addr: 192.168.0.11, port: 32000}]
+nodes:
+  1: {1: [{addr: 10.1.1.1, port: 31001, ifindex: 4}]}
+`), 0o644)
+	if err := in.run([]string{"apply", path}); err != nil {
+		t.Fatal(err)
+	}
+	c, _ := dp.Config()
+	got, _ := dp.ReadGeneration(c.ActiveGen)
+	want := maps.Tables{
+		Topics: map[uint32][]maps.NodeDest{1: {{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")}, {NodeID: 1, Dest: netip.MustParseAddrPort("192.168.0.11:32000")}}},
+		Nodes:  map[uint32]map[uint32][]maps.SubDest{1: {1: {{Ifindex: 4, Dest: netip.MustParseAddrPort("10.1.1.1:31001")}}}},
+	}
+	if c.ActiveGen != 1 || c.LocalNodeID != 1 || maps.Diff(got, want) != nil {
+		t.Errorf("cfg %+v tables %+v, want gen 1 node 1 %+v", c, got, want)
+	}
+
+	// 오타와 한도 위반은 맵을 건드리기 전에 거부
+	os.WriteFile(path, []byte("topicz: {}\n"), 0o644)
+	if err := in.run([]string{"apply", path}); err == nil {
+		t.Errorf("unknown field accepted")
+	}
+	os.WriteFile(path, []byte("topics: {4096: [{node_id: 0, addr: 192.168.0.10, port: 32000}]}\n"), 0o644)
+	if err := in.run([]string{"apply", path}); err == nil {
+		t.Errorf("topic 4096 accepted")
+	}
+	if c2, _ := dp.Config(); c2.ActiveGen != 1 {
+		t.Errorf("rejected apply flipped to gen %d", c2.ActiveGen)
+	}
+}
+
+// count는 활성 세대의 카운트만 바꾼다: 플립 없이, 집합은 그대로, 0이나 집합보다 큰 값도 쓴다.
+func TestCountCommand(t *testing.T) {
+	in, dp, buf := directInspector(t)
+	for _, args := range [][]string{
+		{"topic", "add", "1", "0", "192.168.0.10:32000"},
+		{"topic", "add", "1", "1", "192.168.0.11:32000"},
+		{"sub", "add", "0", "1", "10.1.0.1:31001"},
+	} {
+		if err := in.run(args); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+	}
+	active, _ := dp.ActiveGen()
+	steps := []struct {
+		args  []string
+		topic uint32 // topic 1 카운트
+		local uint32 // (0, 1) 카운트
+		nodes int    // ReadGeneration이 보는 topic 1 원소 수
+		out   string
+	}{
+		{[]string{"count", "topic", "1", "1"}, 1, 1, 1, "topic 1 count 2 → 1"},
+		{[]string{"count", "topic", "1", "0"}, 0, 1, 0, "topic 1 count 1 → 0"},
+		{[]string{"count", "topic", "1", "5"}, 5, 1, 2, "only 2 programmed"},
+		{[]string{"count", "sub", "0", "1", "0"}, 5, 0, 2, "node 0 topic 1 count 1 → 0"},
+		{[]string{"count", "sub", "0", "1", "3"}, 5, 3, 2, "only 1 programmed"},
+	}
+	for _, s := range steps {
+		buf.Reset()
+		if err := in.run(s.args); err != nil {
+			t.Fatalf("%v: %v", s.args, err)
+		}
+		if gen, _ := dp.ActiveGen(); gen != active {
+			t.Fatalf("%v flipped to gen %d", s.args, gen)
+		}
+		c, _ := dp.Counts(active)
+		got, err := dp.ReadGeneration(active)
+		if err != nil {
+			t.Fatalf("%v: read back: %v", s.args, err)
+		}
+		if c.Topics[1] != s.topic || c.Local[maps.LocalKey{NodeID: 0, TopicID: 1}] != s.local || len(got.Topics[1]) != s.nodes {
+			t.Errorf("%v: counts %+v, %d topic 1 nodes; want %d/%d, %d", s.args, c, len(got.Topics[1]), s.topic, s.local, s.nodes)
+		}
+		if !strings.Contains(buf.String(), s.out) {
+			t.Errorf("%v: output %q lacks %q", s.args, buf.String(), s.out)
+		}
+	}
+
+	// 다음 세대 쓰기는 보이는 원소를 이어받아 카운트를 집합 크기로 되돌린다
+	if err := in.run([]string{"topic", "add", "1", "2", "192.168.0.12:32000"}); err != nil {
+		t.Fatal(err)
+	}
+	gen, _ := dp.ActiveGen()
+	if c, _ := dp.Counts(gen); c.Topics[1] != 3 || c.Local[maps.LocalKey{NodeID: 0, TopicID: 1}] != 1 {
+		t.Errorf("counts after topic add = %+v, want topic 1 = 3, (0,1) = 1", c)
+	}
+
+	for _, args := range [][]string{
+		{"count", "topic", "1", "257"}, // MAX_FANOUT 초과
+		{"count", "sub", "0", "1", "513"},
+		{"count", "topic", "4096", "1"},
+		{"count", "topic", "1"},
+		{"count", "sub", "0", "1", "x"},
+	} {
+		if err := in.run(args); err == nil {
+			t.Errorf("%v accepted", args)
+		}
+	}
+}
+
+func TestEditTablesErrors(t *testing.T) {
+	base := maps.Tables{
+		Topics: map[uint32][]maps.NodeDest{1: {{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")}}},
+		Nodes:  map[uint32]map[uint32][]maps.SubDest{0: {1: {{Dest: netip.MustParseAddrPort("10.1.0.1:31001")}}}},
+	}
+	for _, args := range [][]string{
+		{"topic", "add", "1", "0", "192.168.0.10:32000"}, // 중복
+		{"topic", "add", "1", "0", "192.168.0.10"},       // 포트 없음
+		{"topic", "del", "1", "5"},
+		{"sub", "del", "0", "1", "10.1.0.9:31001"},
+		{"truncate", "topic", "1", "2"}, // 늘릴 수 없음
+		{"truncate", "sub", "0", "1", "x"},
+		{"sub", "move", "0", "1"},
+	} {
+		tb := cloneTables(base)
+		if err := editTables(&tb, args[0], args[1:]); err == nil {
+			t.Errorf("%v accepted", args)
+		}
+		if !reflect.DeepEqual(tb.Topics, base.Topics) {
+			t.Errorf("%v: failed edit changed topics to %+v", args, tb.Topics)
+		}
+	}
+}
+
+// loader API로 쓸 때는 loader가 본 term을 이어 쓰고 apply → flip 순서로 보낸다.
+func TestAPIApplier(t *testing.T) {
+	var calls []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/status", func(w http.ResponseWriter, _ *http.Request) {
+		calls = append(calls, "status")
+		json.NewEncoder(w).Encode(api.Status{Term: 3})
+	})
+	mux.HandleFunc("/v1/tables", func(w http.ResponseWriter, r *http.Request) {
+		var req api.ApplyRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		calls = append(calls, "apply")
+		if req.Term != 3 || req.NodeID != 2 || !strings.HasPrefix(req.Version, "manual-") {
+			t.Errorf("apply request %+v", req)
+		}
+		json.NewEncoder(w).Encode(api.Ack{Gen: 1, Version: req.Version})
+	})
+	mux.HandleFunc("/v1/flip", func(w http.ResponseWriter, r *http.Request) {
+		var req api.FlipRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		calls = append(calls, "flip")
+		json.NewEncoder(w).Encode(api.Ack{Gen: 1, Version: req.Version})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	gen, err := apiApplier{api.NewClient(srv.URL)}.apply(context.Background(), maps.Tables{}, 2)
+	if err != nil || gen != 1 {
+		t.Fatalf("apply = %d, %v", gen, err)
+	}
+	if strings.Join(calls, ",") != "status,apply,flip" {
+		t.Errorf("calls = %v", calls)
+	}
+}
+
+// count도 loader가 본 term으로 /v1/count 하나만 보낸다.
+func TestAPIApplierCount(t *testing.T) {
+	var calls []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/status", func(w http.ResponseWriter, _ *http.Request) {
+		calls = append(calls, "status")
+		json.NewEncoder(w).Encode(api.Status{Term: 3})
+	})
+	mux.HandleFunc("/v1/count", func(w http.ResponseWriter, r *http.Request) {
+		var req api.CountRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		calls = append(calls, "count")
+		if req.Term != 3 || req.Topic != 1 || req.Node == nil || *req.Node != 2 || req.Count != 0 {
+			t.Errorf("count request %+v", req)
+		}
+		json.NewEncoder(w).Encode(api.Ack{Gen: 1})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	node := uint32(2)
+	gen, err := apiApplier{api.NewClient(srv.URL)}.setCount(context.Background(), api.CountRequest{Topic: 1, Node: &node})
+	if err != nil || gen != 1 {
+		t.Fatalf("setCount = %d, %v", gen, err)
+	}
+	if strings.Join(calls, ",") != "status,count" {
+		t.Errorf("calls = %v", calls)
+	}
+}
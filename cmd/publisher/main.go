@@ -1,6 +1,7 @@
 package main
 
 // 퍼블리셔: UDP 32000으로 hop=0 패킷 송신. QPS 제어, 페이로드 사이즈, 토픽 설정.
+// loader가 헤더 magic을 검사하면(PS_HDR_MAGIC) -magic으로 같은 값을 topic_hdr.flags에 싣는다. 아니면 skipped로 통과한다.
 
 import (
 	"encoding/binary"
@@ -8,24 +9,43 @@ import (
 	"log"
 	"math/rand"
 	"net"
+	"net/netip"
+	"strconv"
 	"time"
 )
 
+// parseDst: IP:port 또는 [IP]:port. 대괄호 IPv4도 받으므로 배포에서 -dst=[$(NODE_IP)]:32000 하나로 두 family를 쓴다.
+// 토픽 family(controller)와 같은 family 주소로 보내야 한다.
+func parseDst(s string) (netip.AddrPort, error) {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil { return netip.AddrPort{}, err }
+	ip, err := netip.ParseAddr(host)
+	if err != nil { return netip.AddrPort{}, err }
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil { return netip.AddrPort{}, err }
+	return netip.AddrPortFrom(ip, uint16(p)), nil
+}
+
 func main() {
 	topic := flag.Uint("topic", 1, "topic id")
 	qps := flag.Int("qps", 50000, "messages per second")
 	payload := flag.Int("payload", 100, "payload bytes (not including 8B header)")
-	dst := flag.String("dst", "255.255.255.255:32000", "dst (for TC(B)/C use nodeIP:32000 of local node)")
+	dst := flag.String("dst", "255.255.255.255:32000", "dst (for TC(B)/C use nodeIP:32000 of local node; IPv6: [nodeIP]:32000)")
+	magicStr := flag.String("magic", "0", "topic_hdr.flags value, e.g. 0x5053 (the VAL of the loader's PS_HDR_MAGIC)")
 	flag.Parse()
 
-	raddr, _ := net.ResolveUDPAddr("udp", *dst)
-	conn, err := net.DialUDP("udp", nil, raddr)
+	magic, err := strconv.ParseUint(*magicStr, 0, 16)
+	if err != nil { log.Fatalf("-magic %q: want a 16-bit value", *magicStr) }
+
+	raddr, err := parseDst(*dst)
+	if err != nil { log.Fatalf("-dst: %v", err) }
+	conn, err := net.DialUDP("udp", nil, net.UDPAddrFromAddrPort(raddr))
 	if err != nil { log.Fatal(err) }
 	defer conn.Close()
 
 	msg := make([]byte, 8+*payload)
 	binary.BigEndian.PutUint32(msg[:4], uint32(*topic))
-	binary.BigEndian.PutUint16(msg[4:6], 0)
+	binary.BigEndian.PutUint16(msg[4:6], uint16(magic))
 	binary.BigEndian.PutUint16(msg[6:8], 0)
 	rand.Read(msg[8:])
 
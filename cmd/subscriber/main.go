@@ -1,69 +1,143 @@
 package main
 
-// 구독자: UDP 수신, p50/p99 측정(간이), JSON 로그 표준출력.
+// 구독자: UDP 수신, p50/p99 측정(간이), 토픽별 JSON 로그 표준출력.
+// PS_TOPICS="1:31001,2:31002" (토픽:포트, 포트 생략 시 PS_UDP_PORT). 같은 포트를 여러 토픽이
+// 공유하면 헤더 topic_id로 구분한다. PS_TOPICS가 없으면 PS_UDP_PORT 하나로 모든 토픽을 받는다.
+// 구독하지 않은 토픽이 들어오면 unexpected=true 레코드로 따로 보고한다.
+// 수신 소켓은 :port (IPv4/IPv6 겸용)라 토픽 family와 상관없이 같은 포트로 받는다.
 
 import (
 	"encoding/binary"
 	"encoding/json"
+	"fmt"
 	"log"
 	"math"
 	"net"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 type Rec struct {
-	TS    time.Time `json:"ts"`
-	P50   float64   `json:"p50_us"`
-	P99   float64   `json:"p99_us"`
-	QPS   float64   `json:"qps"`
-	Drops uint64    `json:"drops"`
+	TS         time.Time `json:"ts"`
+	Topic      uint32    `json:"topic"`
+	Port       int       `json:"port"`
+	P50        float64   `json:"p50_us"`
+	P99        float64   `json:"p99_us"`
+	QPS        float64   `json:"qps"`
+	Drops      uint64    `json:"drops"`
+	Unexpected bool      `json:"unexpected,omitempty"`
 }
 
-func main() {
-	port := os.Getenv("PS_UDP_PORT")
-	if port == "" { port = "31001" }
-	addr, _ := net.ResolveUDPAddr("udp", ":"+port)
-	conn, err := net.ListenUDP("udp", addr)
+type topicStats struct {
+	port       int
+	lat        []float64
+	recv, last uint64
+	unexpected bool
+}
+
+type stats struct {
+	mu     sync.Mutex
+	any    bool // PS_TOPICS 미지정: 모든 토픽 구독
+	topics map[uint32]*topicStats
+}
+
+// parseTopics: "1:31001,2" → topic→port. 포트는 1-65535, 같은 토픽을 두 번 쓰면 오류.
+func parseTopics(s string, defPort int) (map[uint32]int, error) {
+	out := map[uint32]int{}
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e == "" { continue }
+		t, p, hasPort := strings.Cut(e, ":")
+		tID, err := strconv.ParseUint(t, 10, 32)
+		if err != nil { return nil, fmt.Errorf("%q: invalid topic", e) }
+		port := defPort
+		if hasPort {
+			x, err := strconv.ParseUint(p, 10, 16)
+			if err != nil || x == 0 { return nil, fmt.Errorf("%q: invalid port", e) }
+			port = int(x)
+		}
+		if _, dup := out[uint32(tID)]; dup { return nil, fmt.Errorf("%q: topic %d listed twice", e, tID) }
+		out[uint32(tID)] = port
+	}
+	return out, nil
+}
+
+func (s *stats) record(port int, topic uint32, latUs float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ts, ok := s.topics[topic]
+	if !ok {
+		ts = &topicStats{port: port, unexpected: !s.any}
+		s.topics[topic] = ts
+	}
+	ts.lat = append(ts.lat, latUs)
+	ts.recv++
+}
+
+func listen(port int, s *stats) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: port}) // 와일드카드: dual-stack 소켓
 	if err != nil { log.Fatal(err) }
 	defer conn.Close()
 
-	var lat []float64
 	buf := make([]byte, 65535)
-	var recv, lastRecv uint64
-	ticker := time.NewTicker(1 * time.Second)
-	start := time.Now()
-
 	for {
-		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
 		n, _, err := conn.ReadFromUDP(buf)
-		if err == nil && n >= 16 {
-			// payload 첫 8바이트에 publisher 타임스탬프가 들어온다고 가정 (publisher가 넣음)
-			sendNs := int64(binary.BigEndian.Uint64(buf[8:16]))
-			latUs := float64(time.Now().UnixNano()-sendNs) / 1000.0
-			lat = append(lat, latUs)
-			recv++
+		if err != nil || n < 16 { continue }
+		topic := binary.BigEndian.Uint32(buf[:4])
+		// payload 첫 8바이트에 publisher 타임스탬프가 들어온다고 가정 (publisher가 넣음)
+		sendNs := int64(binary.BigEndian.Uint64(buf[8:16]))
+		latUs := float64(time.Now().UnixNano()-sendNs) / 1000.0
+		s.record(port, topic, latUs)
+	}
+}
+
+func main() {
+	port := os.Getenv("PS_UDP_PORT")
+	if port == "" { port = "31001" }
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || p == 0 { log.Fatalf("PS_UDP_PORT: invalid port %q", port) }
+	defPort := int(p)
+
+	s := &stats{topics: map[uint32]*topicStats{}}
+	ports := map[int]bool{}
+	if v := os.Getenv("PS_TOPICS"); v != "" {
+		tp, err := parseTopics(v, defPort)
+		if err != nil { log.Fatalf("PS_TOPICS: %v", err) }
+		for t, p := range tp {
+			s.topics[t] = &topicStats{port: p}
+			ports[p] = true
 		}
-		select {
-		case <-ticker.C:
-			el := time.Since(start).Seconds()
-			qps := float64(recv-lastRecv)
-			lastRecv = recv
-			if len(lat) > 0 {
-				cp := append([]float64(nil), lat...)
-				lat = lat[:0]
-				p50 := quantile(cp, 0.50)
-				p99 := quantile(cp, 0.99)
-				rec := Rec{TS: time.Now(), P50: p50, P99: p99, QPS: qps, Drops: 0}
-				j, _ := json.Marshal(rec)
-				os.Stdout.Write(j); os.Stdout.Write([]byte("\n"))
-			} else {
-				rec := Rec{TS: time.Now(), P50: 0, P99: 0, QPS: qps, Drops: 0}
-				j, _ := json.Marshal(rec)
-				os.Stdout.Write(j); os.Stdout.Write([]byte("\n"))
+	} else {
+		s.any = true
+		ports[defPort] = true
+	}
+	for p := range ports { go listen(p, s) }
+
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.mu.Lock()
+		var recs []Rec
+		for t, ts := range s.topics {
+			rec := Rec{TS: time.Now(), Topic: t, Port: ts.port, QPS: float64(ts.recv - ts.last), Unexpected: ts.unexpected}
+			ts.last = ts.recv
+			if len(ts.lat) > 0 {
+				cp := append([]float64(nil), ts.lat...)
+				ts.lat = ts.lat[:0]
+				rec.P50 = quantile(cp, 0.50)
+				rec.P99 = quantile(cp, 0.99)
 			}
-			_ = el
-		default:
+			recs = append(recs, rec)
+		}
+		s.mu.Unlock()
+		sort.Slice(recs, func(i, j int) bool { return recs[i].Topic < recs[j].Topic })
+		for _, rec := range recs {
+			j, _ := json.Marshal(rec)
+			os.Stdout.Write(append(j, '\n'))
 		}
 	}
 }
@@ -6,8 +6,11 @@ require (
 	github.com/cilium/ebpf v0.14.0
 	github.com/Shopify/sarama v1.41.3
 	github.com/eclipse/paho.mqtt.golang v1.5.0
+	github.com/vishvananda/netlink v1.1.0
+	golang.org/x/sys v0.15.0
 	k8s.io/api v0.30.1
 	k8s.io/apimachinery v0.30.1
 	k8s.io/client-go v0.30.1
+	sigs.k8s.io/yaml v1.3.0
 )
 
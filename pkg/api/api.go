@@ -0,0 +1,78 @@
+package api
+
+// controller ↔ loader 로컬 API (HTTP/JSON).
+//
+//   POST /v1/tables  ApplyRequest → Ack   비활성 세대에 테이블 preload (staged)
+//   POST /v1/flip    FlipRequest  → Ack   staged 세대로 플립 (버전과 term이 일치할 때만)
+//   POST /v1/count   CountRequest → Ack   활성 세대의 카운트 하나만 바꾼다 (psbenchctl count, 수동 실험용)
+//   GET  /v1/status               → Status
+//
+// controller는 desired state를 한 번 계산해 모든 loader에 apply → 노드별 ack 확인 후 flip.
+// Version은 desired state의 내용 해시로, 같은 내용을 반복 적용하지 않는 데 쓴다.
+// Term은 controller 리더 펜싱 토큰: loader는 지금까지 본 최대 term보다 작은 apply/flip을 409로 거부한다.
+
+import "github.com/yourorg/psbench/pkg/maps"
+
+type ApplyRequest struct {
+	Version string      `json:"version"`
+	NodeID  uint32      `json:"node_id"` // 플립 시 m_cfg.local_node_id 로 함께 반영
+	Term    uint64      `json:"term"`
+	Tables  maps.Tables `json:"tables"`
+	Filter  *Filter     `json:"filter,omitempty"` // 플립 시 함께 반영. nil이면 loader의 현재 필터 유지 (psbenchctl)
+}
+
+// Filter: m_cfg 포트 필터 (tier1_port, tier2_port_min/max). controller가 테이블과 같은 설정에서 계산하므로
+// loader env 기본값(PS_TIER1_PORT, PS_TIER2_PORTS)과 어긋나 토픽 트래픽이 skipped로 빠지지 않는다.
+// 헤더 magic(PS_HDR_MAGIC)은 loader 설정으로 남는다.
+type Filter struct {
+	Tier1Port    uint16 `json:"tier1_port"`
+	Tier2PortMin uint16 `json:"tier2_port_min"`
+	Tier2PortMax uint16 `json:"tier2_port_max"` // 0이면 tier-2 포트 없음
+}
+
+type FlipRequest struct {
+	Version string `json:"version"`
+	Term    uint64 `json:"term"`
+}
+
+// CountRequest: Node가 nil이면 topic_fanout_cnt[Topic], 아니면 node_local_cnt[(Node, Topic)].
+// 집합은 그대로 두므로 Count는 0이거나 집합보다 클 수도 있다. 카운트 하나는 원자적으로 바뀌므로 활성 세대에 바로 쓴다.
+type CountRequest struct {
+	Topic uint32  `json:"topic"`
+	Node  *uint32 `json:"node,omitempty"`
+	Count uint32  `json:"count"`
+	Term  uint64  `json:"term"`
+}
+
+type Ack struct {
+	Node    string `json:"node"`
+	Gen     uint32 `json:"gen"`
+	Version string `json:"version"`
+}
+
+type Link struct {
+	Dev  string `json:"dev"`
+	Dir  string `json:"dir"`
+	Mech string `json:"mech,omitempty"`
+	Live bool   `json:"live"`
+	Err  string `json:"error,omitempty"`
+}
+
+type Status struct {
+	Node          string `json:"node"`
+	NodeID        uint32 `json:"node_id"`
+	ActiveGen     uint32 `json:"active_gen"`
+	ActiveVersion string `json:"active_version"`
+	StagedVersion string `json:"staged_version,omitempty"`
+	Term          uint64 `json:"term"`                 // 지금까지 본 최대 term
+	LastError     *Error `json:"last_error,omitempty"` // 마지막 apply 실패 (성공하면 비움)
+	Links         []Link `json:"links"`
+}
+
+// Error: 비-2xx 응답 본문.
+// 세대 쓰기 실패는 Op(maps.WriteError.Op)와 재시도 가치(Transient)를 함께 싣는다.
+type Error struct {
+	Error     string `json:"error"`
+	Op        string `json:"op,omitempty"`
+	Transient bool   `json:"transient,omitempty"`
+}
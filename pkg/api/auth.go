@@ -0,0 +1,65 @@
+package api
+
+// 공유 토큰 인증. loader API는 hostNetwork 포트라 노드에 닿는 모든 Pod가 부를 수 있으므로
+// 모든 /v1 요청에 "Authorization: Bearer <token>"을 요구한다. 토큰은 Secret 파일로 나눠 준다
+// (Secret psbench-loader-api, deploy/daemonset-loader.yaml). term 펜싱은 호출자가 준 값을 믿으므로 인증을 대신하지 못한다.
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// ReadToken: 토큰 파일 (앞뒤 공백 제거). 비어 있으면 오류.
+func ReadToken(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	tok := strings.TrimSpace(string(b))
+	if tok == "" {
+		return "", fmt.Errorf("%s: empty token", path)
+	}
+	return tok, nil
+}
+
+// RequireToken: Bearer 토큰이 다르면 401. token이 비면 next를 그대로 돌려준다.
+func RequireToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintln(w, `{"error":"missing or invalid API token"}`)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LoopbackOnly: 모든 listen 주소가 루프백인지 (":9465"처럼 호스트가 비면 모든 인터페이스).
+// 토큰 없이 열어도 되는지 판단한다 (loader API, controller 등록 엔드포인트).
+func LoopbackOnly(addrs []string) bool {
+	for _, a := range addrs {
+		host, _, err := net.SplitHostPort(a)
+		if err != nil {
+			return false
+		}
+		if host == "localhost" {
+			continue
+		}
+		ip, err := netip.ParseAddr(host)
+		if err != nil || !ip.IsLoopback() {
+			return false
+		}
+	}
+	return true
+}
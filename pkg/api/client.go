@@ -0,0 +1,129 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type Client struct {
+	Base  string // 예: http://10.0.0.1:9465
+	Token string // loader PS_API_TOKEN_FILE과 같은 값 (auth.go). 비면 헤더 없음
+	HTTP  *http.Client
+}
+
+func NewClient(base string) *Client {
+	return &Client{Base: base, HTTP: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (c *Client) Apply(ctx context.Context, req ApplyRequest) (Ack, error) {
+	var ack Ack
+	err := c.do(ctx, http.MethodPost, "/v1/tables", req, &ack)
+	return ack, err
+}
+
+func (c *Client) Flip(ctx context.Context, version string, term uint64) (Ack, error) {
+	var ack Ack
+	err := c.do(ctx, http.MethodPost, "/v1/flip", FlipRequest{Version: version, Term: term}, &ack)
+	return ack, err
+}
+
+func (c *Client) SetCount(ctx context.Context, req CountRequest) (Ack, error) {
+	var ack Ack
+	err := c.do(ctx, http.MethodPost, "/v1/count", req, &ack)
+	return ack, err
+}
+
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	var st Status
+	err := c.do(ctx, http.MethodGet, "/v1/status", nil, &st)
+	return st, err
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.Base+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		e := &HTTPError{Method: method, Path: path, Code: resp.StatusCode}
+		_ = json.NewDecoder(resp.Body).Decode(&e.Body)
+		return e
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// HTTPError: loader가 비-2xx로 응답함
+type HTTPError struct {
+	Method, Path string
+	Code         int
+	Body         Error
+}
+
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("%s %s: %d %s: %s", e.Method, e.Path, e.Code, http.StatusText(e.Code), e.Body.Error)
+	if e.Body.Op != "" {
+		msg += " (op " + e.Body.Op + ")"
+	}
+	return msg
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent: Retry가 더 시도하지 않도록 표시
+func Permanent(err error) error { return permanentError{err} }
+
+// retryable: 4xx(요청 자체가 틀림: 잘못된 테이블, staged 아님)와 Permanent는 재시도하지 않는다.
+func retryable(err error) bool {
+	var p permanentError
+	if errors.As(err, &p) {
+		return false
+	}
+	var h *HTTPError
+	if errors.As(err, &h) {
+		return h.Code/100 != 4 || h.Code == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// Retry: fn이 성공하거나 attempts회 실패할 때까지 지수 백오프로 재시도.
+// 재시도해도 소용없는 오류는 바로 돌려준다.
+func Retry(ctx context.Context, attempts int, backoff time.Duration, fn func() error) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if i == attempts-1 || !retryable(err) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff << i):
+		}
+	}
+	return err
+}
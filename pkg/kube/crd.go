@@ -0,0 +1,134 @@
+package kube
+
+// PubSubTopic / PubSubSubscription CRD (psbench.io/v1alpha1).
+// 코드 생성 없이 dynamic client + unstructured 변환으로 다룬다. 스키마는 deploy/crds.yaml.
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	Group   = "psbench.io"
+	Version = "v1alpha1"
+
+	TierHierarchical = "hierarchical" // 기본: publisher 노드 → 구독 노드 → 로컬 구독자 (2단)
+	TierDirect       = "direct"       // publisher 노드 → 구독자 Pod 직접 (1단)
+
+	OverflowReject   = "reject"   // 기본: 한도를 넘는 토픽은 프로그래밍하지 않음
+	OverflowTruncate = "truncate" // 한도만큼만 남기고 나머지는 버림(경고 메트릭)
+
+	// 상태 조건
+	CondReady = "Ready"
+)
+
+var (
+	TopicGVR        = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "pubsubtopics"}
+	SubscriptionGVR = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "pubsubsubscriptions"}
+)
+
+type PubSubTopic struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              TopicSpec   `json:"spec"`
+	Status            TopicStatus `json:"status,omitempty"`
+}
+
+type TopicSpec struct {
+	ID             uint32 `json:"id"`                       // 데이터패스 topic_id (< MAX_TOPICS)
+	MaxFanout      int    `json:"maxFanout,omitempty"`      // 토픽당 최대 노드 수, 0이면 MAX_FANOUT
+	Port           int    `json:"port,omitempty"`           // 구독자 UDP 포트 기본값
+	TierMode       string `json:"tierMode,omitempty"`       // hierarchical | direct
+	OverflowPolicy string `json:"overflowPolicy,omitempty"` // reject | truncate, 비면 controller 기본값
+	IPFamily       string `json:"ipFamily,omitempty"`       // IPv4 | IPv6 (dual-stack), 비면 controller 기본값
+}
+
+type TopicStatus struct {
+	ObservedGeneration  int64              `json:"observedGeneration,omitempty"`
+	Nodes               int                `json:"nodes"`
+	Subscribers         int                `json:"subscribers"`
+	Destinations        int                `json:"destinations"`          // 프로그래밍된 1차 목적지 수
+	FanoutLimit         int                `json:"fanoutLimit,omitempty"` // 1차 목적지 한도
+	MaxLocalSubscribers int                `json:"maxLocalSubscribers"`   // 가장 큰 노드 로컬 집합 (한도 MAX_LOCAL_SUB)
+	Conditions          []metav1.Condition `json:"conditions,omitempty"`
+}
+
+type PubSubSubscription struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              SubscriptionSpec   `json:"spec"`
+	Status            SubscriptionStatus `json:"status,omitempty"`
+}
+
+type SubscriptionSpec struct {
+	Topic    string                `json:"topic"`          // PubSubTopic 이름 (같은 네임스페이스)
+	Selector *metav1.LabelSelector `json:"selector"`       // 구독자 Pod 선택
+	Port     int                   `json:"port,omitempty"` // 토픽 기본 포트보다 우선
+}
+
+type SubscriptionStatus struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	MatchedPods        int                `json:"matchedPods"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ListTopics: CRD가 설치되지 않았으면 빈 목록.
+func ListTopics(ctx context.Context, dyn dynamic.Interface, ns string) ([]PubSubTopic, error) {
+	var out []PubSubTopic
+	err := list(ctx, dyn, TopicGVR, ns, func(obj map[string]interface{}) error {
+		var t PubSubTopic
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &t); err != nil { return err }
+		out = append(out, t)
+		return nil
+	})
+	return out, err
+}
+
+func ListSubscriptions(ctx context.Context, dyn dynamic.Interface, ns string) ([]PubSubSubscription, error) {
+	var out []PubSubSubscription
+	err := list(ctx, dyn, SubscriptionGVR, ns, func(obj map[string]interface{}) error {
+		var s PubSubSubscription
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, &s); err != nil { return err }
+		out = append(out, s)
+		return nil
+	})
+	return out, err
+}
+
+func list(ctx context.Context, dyn dynamic.Interface, gvr schema.GroupVersionResource, ns string, each func(map[string]interface{}) error) error {
+	ul, err := dyn.Resource(gvr).Namespace(ns).List(ctx, metav1.ListOptions{})
+	if apierrors.IsNotFound(err) { return nil }
+	if err != nil { return err }
+	for _, u := range ul.Items {
+		if err := each(u.Object); err != nil { return err }
+	}
+	return nil
+}
+
+func UpdateTopicStatus(ctx context.Context, dyn dynamic.Interface, t *PubSubTopic) error {
+	return updateStatus(ctx, dyn, TopicGVR, t.Namespace, t)
+}
+
+func UpdateSubscriptionStatus(ctx context.Context, dyn dynamic.Interface, s *PubSubSubscription) error {
+	return updateStatus(ctx, dyn, SubscriptionGVR, s.Namespace, s)
+}
+
+// updateStatus: JSON을 거쳐 unstructured로 바꾼다. ToUnstructured는 uint32(spec.id)를 uint64로 남기는데,
+// unstructured의 DeepCopy(client-go fake, 캐시)는 int64/float64만 받는다.
+func updateStatus(ctx context.Context, dyn dynamic.Interface, gvr schema.GroupVersionResource, ns string, obj interface{}) error {
+	b, err := json.Marshal(obj)
+	if err != nil { return err }
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil { return err }
+	u := &unstructured.Unstructured{Object: m}
+	u.SetAPIVersion(Group + "/" + Version)
+	_, err = dyn.Resource(gvr).Namespace(ns).UpdateStatus(ctx, u, metav1.UpdateOptions{})
+	return err
+}
@@ -1,5 +1,10 @@
 package kube
 
-// (예비 확장 지점) 현재는 controller/main.go에서 직접 구현.
-// 필요시 공통화 또는 CRD 방식으로 확장.
+// 컨트롤러 공용 K8s 유틸. 토픽/구독 CRD 타입과 접근자는 crd.go.
 
+// 구독자 Pod 규약 (해석은 cmd/controller/topics.go)
+const (
+	TopicLabel       = "ps/topic"    // "1" 또는 "1_2_orders"
+	TopicsAnnotation = "ps/topics"   // "1:31001,2:31002,orders"
+	PortEnv          = "PS_UDP_PORT" // 구독자 기본 UDP 포트
+)
@@ -0,0 +1,84 @@
+package maps
+
+// m_cfg(ARRAY, 키=0) 판독/갱신. 레이아웃은 commons.h의 struct cfg_rec와 동일해야 한다.
+//
+// 갱신 규약 (controller ↔ loader):
+//   - 활성 세대의 단일 원천은 cfg_rec.active_gen 이다. 데이터패스는 이것만 읽는다.
+//   - 필드 소유권
+//       loader     : EgressIfindex, LocalRouteIfindex, SampleRate, HdrMagic*
+//       controller : ActiveGen, LocalNodeID, 포트 필터(Tier*Port*, 테이블의 포트와 같이 바뀌어야 하므로)
+//     loader는 맵을 새로 만들었을 때(EgressIfindex==0)만 ActiveGen, LocalNodeID의 초기값을 쓴다.
+//     포트 필터는 loader가 시작할 때 env 값으로 쓰고, controller가 필터를 실은 apply를 플립하면 그 값으로 바뀐다.
+//   - controller 필드는 loader API(pkg/api)의 flip 요청으로만 바뀌고, 실제 맵 쓰기는
+//     loader 프로세스가 한다. 즉 m_cfg의 writer는 노드당 하나다.
+//   - 모든 쓰기는 UpdateConfig(읽기-수정-쓰기)로 해당 필드만 바꾼다.
+//     값 전체를 통째로 덮어쓰면 다른 소유자의 필드가 되돌아간다.
+//   - UpdateConfig는 그 writer 프로세스(loader, loader가 없을 때만 psbenchctl -direct)만 부른다.
+//     프로세스 안의 쓰기(시작 시 초기화, API flip)는 cfgMu로 직렬화되지만 프로세스 사이에는 잠금이 없다.
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/cilium/ebpf"
+)
+
+type Config struct {
+	EgressIfindex     uint32
+	LocalRouteIfindex uint32
+	LocalNodeID       uint32
+	ActiveGen         uint32
+	SampleRate        uint32
+
+	// psbench 트래픽 필터 (host order). 맞지 않는 UDP는 (비UDP와 같이) 건드리지 않고 Metrics.Skipped로 센다.
+	// Tier1Port와 Tier2PortMax가 모두 0이면 필터를 끈다(모든 UDP가 토픽 메시지).
+	Tier1Port    uint16
+	Tier2PortMin uint16
+	Tier2PortMax uint16
+	HdrMagic     uint16 // topic_hdr.flags & HdrMagicMask == HdrMagic
+	HdrMagicMask uint16 // 0이면 헤더 검사 안 함
+	_            uint16
+}
+
+// PortFiltered: 데이터패스가 포트로 트래픽을 거르는지
+func (c Config) PortFiltered() bool { return c.Tier1Port != 0 || c.Tier2PortMax != 0 }
+
+func ReadConfig(m Map) (Config, error) {
+	var (
+		key uint32
+		c   Config
+	)
+	if err := m.Lookup(&key, &c); err != nil {
+		return c, fmt.Errorf("lookup m_cfg: %w", err)
+	}
+	return c, nil
+}
+
+// cfgMu: m_cfg 읽기-수정-쓰기 직렬화. 사이에 끼어든 쓰기가 active_gen이나 필터 필드를 되돌리지 않게 한다.
+var cfgMu sync.Mutex
+
+// UpdateConfig: 현재 값을 읽어 fn으로 수정한 뒤 기록. 갱신된 값을 반환.
+// m_cfg writer(위 규약)만 호출한다.
+func UpdateConfig(m Map, fn func(*Config)) (Config, error) {
+	cfgMu.Lock()
+	defer cfgMu.Unlock()
+	c, err := ReadConfig(m)
+	if err != nil {
+		return c, err
+	}
+	fn(&c)
+	key := uint32(0)
+	if err := m.Update(&key, &c, ebpf.UpdateExist); err != nil {
+		return c, fmt.Errorf("update m_cfg: %w", err)
+	}
+	return c, nil
+}
+
+// SetActiveGen: 세대 플립. 토글이 아니라 목표 세대를 지정하므로 재시도해도 안전하다.
+func SetActiveGen(m Map, gen uint32) error {
+	if gen > 1 {
+		return fmt.Errorf("invalid generation %d", gen)
+	}
+	_, err := UpdateConfig(m, func(c *Config) { c.ActiveGen = gen })
+	return err
+}
@@ -0,0 +1,136 @@
+package maps
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"sync"
+	"testing"
+
+	"github.com/cilium/ebpf"
+)
+
+// 플립 후 데이터패스가 실제로 어느 세대를 보는지 패킷으로 확인한다.
+func TestSetActiveGenSeenByDatapath(t *testing.T) {
+	coll := loadObject(t)
+	cfg := coll.Maps["m_cfg"]
+	prog := coll.Programs["tc_hier_pubsub"]
+
+	key := uint32(0)
+	if err := cfg.Update(&key, &Config{EgressIfindex: 1, LocalRouteIfindex: 1, SampleRate: 0}, ebpf.UpdateAny); err != nil {
+		t.Fatalf("cfg init: %v", err)
+	}
+
+	const topic = 7
+	dst := [2]netip.Addr{netip.MustParseAddr("10.0.1.1"), netip.MustParseAddr("10.0.2.1")}
+	for gen := range dst {
+		setTopicNodes(t, coll, gen, topic, NodeDest{NodeID: uint32(gen), Dest: netip.AddrPortFrom(dst[gen], 32000)})
+	}
+
+	for _, gen := range []uint32{0, 1, 0, 1} {
+		if err := SetActiveGen(cfg, gen); err != nil {
+			t.Fatalf("flip to %d: %v", gen, err)
+		}
+		c, err := ReadConfig(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.ActiveGen != gen || c.EgressIfindex != 1 {
+			t.Fatalf("cfg after flip = %+v, want active_gen=%d with loader fields kept", c, gen)
+		}
+
+		_, out := runPacket(t, prog, udpPacket(netip.MustParseAddr("10.0.0.1"), 32000, topic, 0))
+		got, _ := netip.AddrFromSlice(out[14+16 : 14+20])
+		if got != dst[gen] {
+			t.Errorf("active_gen=%d: datapath rewrote daddr to %s, want %s", gen, got, dst[gen])
+		}
+	}
+}
+
+func TestSetActiveGenRejectsInvalid(t *testing.T) {
+	if err := SetActiveGen(nil, 2); err == nil {
+		t.Fatal("SetActiveGen(2) succeeded")
+	}
+}
+
+// Config의 맵 값 인코딩(cilium/ebpf는 encoding/binary를 쓴다)이 struct cfg_rec와 같은 자리에 필드를 둔다.
+func TestConfigLayoutMatchesC(t *testing.T) {
+	c := Config{
+		EgressIfindex: 1, LocalRouteIfindex: 2, LocalNodeID: 3, ActiveGen: 4, SampleRate: 5,
+		Tier1Port: 6, Tier2PortMin: 7, Tier2PortMax: 8, HdrMagic: 9, HdrMagicMask: 10,
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.NativeEndian, &c); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	off, size := cStruct(t, "cfg_rec")
+	if len(b) != size {
+		t.Fatalf("Config encodes to %d bytes, sizeof(struct cfg_rec) = %d", len(b), size)
+	}
+	for f, want := range map[string]uint32{
+		"egress_ifindex": 1, "local_route_ifindex": 2, "local_node_id": 3, "active_gen": 4, "sample_rate": 5,
+	} {
+		if got := binary.NativeEndian.Uint32(b[off[f]:]); got != want {
+			t.Errorf("%s at %d: %d, want %d", f, off[f], got, want)
+		}
+	}
+	for f, want := range map[string]uint16{
+		"tier1_port": 6, "tier2_port_min": 7, "tier2_port_max": 8, "hdr_magic": 9, "hdr_magic_mask": 10, "_pad": 0,
+	} {
+		o, ok := off[f]
+		if !ok {
+			t.Errorf("cfg_rec.%s missing in commons.h", f)
+			continue
+		}
+		if got := binary.NativeEndian.Uint16(b[o:]); got != want {
+			t.Errorf("%s at %d: %d, want %d", f, o, got, want)
+		}
+	}
+}
+
+func TestConfigPortFiltered(t *testing.T) {
+	for _, tc := range []struct {
+		c    Config
+		want bool
+	}{
+		{Config{}, false},
+		{Config{HdrMagic: 1, HdrMagicMask: 1}, false}, // 헤더 검사는 포트 필터와 별개
+		{Config{Tier1Port: 32000}, true},
+		{Config{Tier2PortMin: 31000, Tier2PortMax: 31999}, true},
+	} {
+		if got := tc.c.PortFiltered(); got != tc.want {
+			t.Errorf("%+v: PortFiltered %v, want %v", tc.c, got, tc.want)
+		}
+	}
+}
+
+// 한 프로세스 안의 동시 writer(시작 시 초기화, API flip)가 서로의 갱신을 잃지 않아야 한다.
+func TestUpdateConfigSerialized(t *testing.T) {
+	f := NewFake()
+	const n = 200
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := f.UpdateConfig(func(c *Config) { c.SampleRate++ }); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := f.UpdateConfig(func(c *Config) { c.Tier1Port++ }); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	c, err := f.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.SampleRate != n || c.Tier1Port != n {
+		t.Errorf("after %d concurrent updates each: sample_rate %d, tier1_port %d", n, c.SampleRate, c.Tier1Port)
+	}
+}
@@ -0,0 +1,170 @@
+package maps
+
+// 데이터패스 검증용 공통 헬퍼: 실제 tc 오브젝트를 로드해 BPF_PROG_TEST_RUN으로 패킷을 흘린다.
+// 오브젝트는 추적하지 않고 make -C bpf로 빌드한다. 없으면 skip(PS_REQUIRE_BPF=1이면 실패),
+// 있는데 낡았으면(소스/레이아웃과 불일치) 실패. root가 아니면 skip.
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"os"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/yourorg/psbench/pkg/proto"
+)
+
+const objPath = "../../bpf/tc_hier_pubsub_kern.o"
+
+func loadObject(t *testing.T) *ebpf.Collection {
+	t.Helper()
+	if _, err := os.Stat(objPath); errors.Is(err, os.ErrNotExist) {
+		if os.Getenv("PS_REQUIRE_BPF") == "1" {
+			t.Fatalf("%s not built (make -C bpf)", objPath)
+		}
+		t.Skipf("%s not built (make -C bpf); PS_REQUIRE_BPF=1 makes this a failure", objPath)
+	}
+	spec, err := ebpf.LoadCollectionSpec(objPath)
+	if err != nil {
+		t.Fatalf("stale bpf object, rebuild with make -C bpf: %v", err)
+	}
+	if err := CheckSpec(spec); err != nil {
+		t.Fatalf("stale bpf object, rebuild with make -C bpf: %v", err)
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("needs root (CAP_BPF, CAP_NET_ADMIN)")
+	}
+	coll, err := ebpf.NewCollection(spec)
+	if err != nil {
+		t.Fatalf("load collection: %v", err)
+	}
+	t.Cleanup(func() { coll.Close() })
+	return coll
+}
+
+// setTopicNodes: gen 세대의 topic → node_set 과 fanout 카운트를 채운다.
+func setTopicNodes(t *testing.T, coll *ebpf.Collection, gen int, topic uint32, dests ...NodeDest) {
+	t.Helper()
+	suffix := "_gen0"
+	if gen == 1 {
+		suffix = "_gen1"
+	}
+	inner, err := ebpf.NewMap(&ebpf.MapSpec{Type: ebpf.Array, KeySize: 4, ValueSize: DestSize, MaxEntries: MaxFanout})
+	if err != nil {
+		t.Fatalf("inner map: %v", err)
+	}
+	defer inner.Close()
+	for i := range dests {
+		k := uint32(i)
+		if err := inner.Update(&k, &dests[i], ebpf.UpdateAny); err != nil {
+			t.Fatalf("inner update: %v", err)
+		}
+	}
+	if err := coll.Maps["topic_to_node_set"+suffix].Update(&topic, inner, ebpf.UpdateAny); err != nil {
+		t.Fatalf("outer update: %v", err)
+	}
+	n := uint32(len(dests))
+	if err := coll.Maps["topic_fanout_cnt"+suffix].Update(&topic, &n, ebpf.UpdateAny); err != nil {
+		t.Fatalf("fanout cnt: %v", err)
+	}
+}
+
+// udpPacket: eth + ipv4 + udp + topic_hdr + 16B payload
+func udpPacket(dst netip.Addr, dport uint16, topic uint32, hop uint16) []byte {
+	b := make([]byte, 14+20+8+8+16)
+	binary.BigEndian.PutUint16(b[12:14], 0x0800)
+
+	ip := b[14:34]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(len(b)-14))
+	ip[8] = 64
+	ip[9] = 17
+	copy(ip[12:16], []byte{10, 0, 0, 100})
+	d := dst.As4()
+	copy(ip[16:20], d[:])
+	binary.BigEndian.PutUint16(ip[10:12], ipChecksum(ip))
+
+	udp := b[34:42]
+	binary.BigEndian.PutUint16(udp[0:2], 40000)
+	binary.BigEndian.PutUint16(udp[2:4], dport)
+	binary.BigEndian.PutUint16(udp[4:6], uint16(len(b)-34))
+
+	// topic_hdr는 와이어 포맷(NBO): publisher가 쓰는 그대로
+	(&proto.TopicHdr{Topic: topic, Hop: hop}).MarshalTo(b[42:50])
+	binary.BigEndian.PutUint16(udp[6:8], udpChecksum(ip, b[34:]))
+	return b
+}
+
+// udp6Packet: eth + ipv6 + udp + topic_hdr + 16B payload (UDP 체크섬은 IPv6에서 필수)
+func udp6Packet(dst netip.Addr, dport uint16, topic uint32, hop uint16) []byte {
+	b := make([]byte, 14+40+8+8+16)
+	binary.BigEndian.PutUint16(b[12:14], 0x86dd)
+
+	ip := b[14:54]
+	ip[0] = 0x60
+	binary.BigEndian.PutUint16(ip[4:6], uint16(len(b)-54))
+	ip[6] = 17
+	ip[7] = 64
+	src := netip.MustParseAddr("fd00::100").As16()
+	copy(ip[8:24], src[:])
+	d := dst.As16()
+	copy(ip[24:40], d[:])
+
+	udp := b[54:62]
+	binary.BigEndian.PutUint16(udp[0:2], 40000)
+	binary.BigEndian.PutUint16(udp[2:4], dport)
+	binary.BigEndian.PutUint16(udp[4:6], uint16(len(b)-54))
+
+	(&proto.TopicHdr{Topic: topic, Hop: hop}).MarshalTo(b[62:70])
+	binary.BigEndian.PutUint16(udp[6:8], udpChecksum(ip, b[54:]))
+	return b
+}
+
+// udpChecksum: 의사 헤더(saddr, daddr, 길이, 프로토콜) + UDP 헤더/페이로드. ip는 IPv4 또는 IPv6 헤더.
+// 체크섬이 채워진 패킷에 대해 0이면 정상.
+func udpChecksum(ip, l4 []byte) uint16 {
+	var sum uint32
+	add := func(b []byte) {
+		for i := 0; i+1 < len(b); i += 2 {
+			sum += uint32(binary.BigEndian.Uint16(b[i:]))
+		}
+	}
+	if ip[0]>>4 == 4 {
+		add(ip[12:20])
+	} else {
+		add(ip[8:40])
+	}
+	sum += uint32(len(l4)) + 17
+	add(l4)
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+func ipChecksum(h []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(h); i += 2 {
+		if i == 10 {
+			continue
+		}
+		sum += uint32(binary.BigEndian.Uint16(h[i:]))
+	}
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// runPacket: 프로그램에 패킷 하나를 흘리고 (반환 코드, 수정된 패킷)을 돌려준다.
+func runPacket(t *testing.T, prog *ebpf.Program, pkt []byte) (uint32, []byte) {
+	t.Helper()
+	out := make([]byte, len(pkt)+256)
+	opts := &ebpf.RunOptions{Data: pkt, DataOut: out}
+	ret, err := prog.Run(opts)
+	if err != nil {
+		t.Fatalf("prog run: %v", err)
+	}
+	return ret, opts.DataOut
+}
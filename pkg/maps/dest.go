@@ -0,0 +1,166 @@
+package maps
+
+// node_set / local_sub 원소 인코딩. 레이아웃은 commons.h의 struct node_dest, struct sub_dest와 동일해야 한다.
+// 바이트 순서는 이 파일에서만 다룬다: 첫 u32(node_id, ifindex)는 host order,
+// daddr/dport는 데이터패스가 패킷 헤더에 그대로 쓰므로 NBO. 호출자는 netip.AddrPort만 다룬다.
+//
+//	off  0  __u32 node_id | ifindex   host order
+//	off  4  __u32 daddr[4]            NBO, IPv4는 앞 4바이트
+//	off 20  __u16 dport               NBO
+//	off 22  __u8  family              4 | 6
+//	off 23  __u8  flags               node_dest만 (ND_F_DIRECT), sub_dest는 0
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+)
+
+// DestSize: sizeof(struct node_dest) == sizeof(struct sub_dest)
+const DestSize = 24
+
+const (
+	destOffDaddr  = 4
+	destOffDport  = 20
+	destOffFamily = 22
+	destOffFlags  = 23
+
+	ndFlagDirect = 1 // ND_F_DIRECT
+)
+
+// errEmptyDest: 한 번도 쓰지 않은 inner 슬롯 (family 0). 카운트가 집합보다 크면(SetTopicCount 등) 읽힌다.
+var errEmptyDest = errors.New("dest value: empty slot")
+
+// NodeDest: topic → node_set 원소 (struct node_dest)
+type NodeDest struct {
+	NodeID uint32
+	Dest   netip.AddrPort
+	// Direct: Dest가 구독자 Pod다 (direct 토픽). 데이터패스가 hop=2로 보내 받는 노드는 2차 fan-out 없이 통과시킨다.
+	Direct bool
+}
+
+// SubDest: (node, topic) → local_sub 원소 (struct sub_dest)
+type SubDest struct {
+	Ifindex uint32 // 0이면 cfg.local_route_ifindex
+	Dest    netip.AddrPort
+}
+
+// destFamily: 4 또는 6. IPv4-mapped IPv6는 IPv6로 본다(패킷 family와 같아야 하므로 변환하지 않는다).
+func destFamily(ap netip.AddrPort) (uint8, error) {
+	a := ap.Addr()
+	if !a.IsValid() || a.Zone() != "" {
+		return 0, fmt.Errorf("not an IP address: %q", a)
+	}
+	if a.Is4() {
+		return 4, nil
+	}
+	return 6, nil
+}
+
+func putDest(b []byte, first uint32, ap netip.AddrPort) error {
+	fam, err := destFamily(ap)
+	if err != nil {
+		return err
+	}
+	binary.NativeEndian.PutUint32(b[0:4], first)
+	if fam == 4 {
+		v4 := ap.Addr().As4()
+		copy(b[destOffDaddr:], v4[:])
+	} else {
+		v6 := ap.Addr().As16()
+		copy(b[destOffDaddr:], v6[:])
+	}
+	binary.BigEndian.PutUint16(b[destOffDport:], ap.Port())
+	b[destOffFamily] = fam
+	return nil
+}
+
+func getDest(b []byte) (uint32, netip.AddrPort, error) {
+	if len(b) != DestSize {
+		return 0, netip.AddrPort{}, fmt.Errorf("dest value: %d bytes, want %d", len(b), DestSize)
+	}
+	var a netip.Addr
+	switch fam := b[destOffFamily]; fam {
+	case 4:
+		a = netip.AddrFrom4([4]byte(b[destOffDaddr : destOffDaddr+4]))
+	case 6:
+		a = netip.AddrFrom16([16]byte(b[destOffDaddr : destOffDaddr+16]))
+	case 0:
+		return 0, netip.AddrPort{}, errEmptyDest
+	default:
+		return 0, netip.AddrPort{}, fmt.Errorf("dest value: family %d", fam)
+	}
+	return binary.NativeEndian.Uint32(b[0:4]), netip.AddrPortFrom(a, binary.BigEndian.Uint16(b[destOffDport:])), nil
+}
+
+// MarshalBinary: struct node_dest (cilium/ebpf가 맵 쓰기에 쓴다)
+func (d NodeDest) MarshalBinary() ([]byte, error) {
+	b := make([]byte, DestSize)
+	if d.Direct {
+		b[destOffFlags] = ndFlagDirect
+	}
+	return b, putDest(b, d.NodeID, d.Dest)
+}
+
+func (d *NodeDest) UnmarshalBinary(b []byte) (err error) {
+	d.NodeID, d.Dest, err = getDest(b)
+	d.Direct = err == nil && b[destOffFlags]&ndFlagDirect != 0
+	return err
+}
+
+// MarshalBinary: struct sub_dest
+func (s SubDest) MarshalBinary() ([]byte, error) {
+	b := make([]byte, DestSize)
+	return b, putDest(b, s.Ifindex, s.Dest)
+}
+
+func (s *SubDest) UnmarshalBinary(b []byte) (err error) {
+	s.Ifindex, s.Dest, err = getDest(b)
+	return err
+}
+
+// JSON(loader API, psbenchctl apply 파일)은 주소와 포트를 나눈 모양을 유지한다:
+//
+//	{"node_id": 0, "addr": "192.168.0.10", "port": 32000}
+//	{"node_id": 1, "addr": "10.1.1.1", "port": 31002, "direct": true}
+//	{"ifindex": 7, "addr": "fd00:10:1::1", "port": 31001}
+type nodeDestJSON struct {
+	NodeID uint32     `json:"node_id"`
+	Addr   netip.Addr `json:"addr"`
+	Port   uint16     `json:"port"`
+	Direct bool       `json:"direct,omitempty"`
+}
+
+type subDestJSON struct {
+	Ifindex uint32     `json:"ifindex,omitempty"`
+	Addr    netip.Addr `json:"addr"`
+	Port    uint16     `json:"port"`
+}
+
+func (d NodeDest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(nodeDestJSON{d.NodeID, d.Dest.Addr(), d.Dest.Port(), d.Direct})
+}
+
+func (d *NodeDest) UnmarshalJSON(b []byte) error {
+	var v nodeDestJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*d = NodeDest{NodeID: v.NodeID, Dest: netip.AddrPortFrom(v.Addr, v.Port), Direct: v.Direct}
+	return nil
+}
+
+func (s SubDest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(subDestJSON{s.Ifindex, s.Dest.Addr(), s.Dest.Port()})
+}
+
+func (s *SubDest) UnmarshalJSON(b []byte) error {
+	var v subDestJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*s = SubDest{Ifindex: v.Ifindex, Dest: netip.AddrPortFrom(v.Addr, v.Port)}
+	return nil
+}
@@ -0,0 +1,155 @@
+package maps
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/netip"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// cStruct: commons.h의 struct 필드 오프셋과 크기 (자연 정렬, __u8/__u16/__u32 배열만)
+func cStruct(t *testing.T, name string) (map[string]int, int) {
+	t.Helper()
+	src, err := os.ReadFile("../../bpf/commons.h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := regexp.MustCompile(`(?s)struct ` + name + ` \{(.*?)\};`).FindSubmatch(src)
+	if body == nil {
+		t.Fatalf("struct %s not found in commons.h", name)
+	}
+	field := regexp.MustCompile(`__u(8|16|32) (\w+)(?:\[(\d+)\])?;`)
+	off, size, align := map[string]int{}, 0, 1
+	for _, f := range field.FindAllSubmatch(body[1], -1) {
+		bits, _ := strconv.Atoi(string(f[1]))
+		w, n := bits/8, 1
+		if len(f[3]) > 0 {
+			n, _ = strconv.Atoi(string(f[3]))
+		}
+		size = (size + w - 1) / w * w
+		off[string(f[2])] = size
+		size += w * n
+		align = max(align, w)
+	}
+	return off, (size + align - 1) / align * align
+}
+
+func TestDestLayoutMatchesC(t *testing.T) {
+	for _, c := range []struct{ name, first string }{{"node_dest", "node_id"}, {"sub_dest", "ifindex"}} {
+		off, size := cStruct(t, c.name)
+		want := map[string]int{c.first: 0, "daddr": destOffDaddr, "dport": destOffDport, "family": destOffFamily}
+		if c.name == "node_dest" {
+			want["flags"] = destOffFlags
+		}
+		for f, o := range want {
+			if got, ok := off[f]; !ok || got != o {
+				t.Errorf("%s.%s: C offset %d (present %v), Go %d", c.name, f, got, ok, o)
+			}
+		}
+		if size != DestSize {
+			t.Errorf("sizeof(struct %s) = %d, DestSize %d", c.name, size, DestSize)
+		}
+	}
+}
+
+func TestDestBinary(t *testing.T) {
+	for _, tc := range []struct {
+		dest  string
+		daddr []byte
+		fam   byte
+	}{
+		{"192.168.0.10:32000", []byte{192, 168, 0, 10}, 4},
+		{"[fd00:10:1::1]:31001", []byte{0xfd, 0, 0, 0x10, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, 6},
+	} {
+		d := NodeDest{NodeID: 7, Dest: netip.MustParseAddrPort(tc.dest)}
+		b, err := d.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: %v", tc.dest, err)
+		}
+		if len(b) != DestSize {
+			t.Fatalf("%s: %d bytes", tc.dest, len(b))
+		}
+		if got := binary.NativeEndian.Uint32(b[0:]); got != 7 {
+			t.Errorf("%s: node_id %d", tc.dest, got)
+		}
+		if got := b[destOffDaddr : destOffDaddr+len(tc.daddr)]; !bytes.Equal(got, tc.daddr) {
+			t.Errorf("%s: daddr % x, want % x", tc.dest, got, tc.daddr)
+		}
+		if got := binary.BigEndian.Uint16(b[destOffDport:]); got != d.Dest.Port() {
+			t.Errorf("%s: dport bytes % x are not network order", tc.dest, b[destOffDport:destOffDport+2])
+		}
+		if b[destOffFamily] != tc.fam {
+			t.Errorf("%s: family %d", tc.dest, b[destOffFamily])
+		}
+
+		var back NodeDest
+		if err := back.UnmarshalBinary(b); err != nil || back != d {
+			t.Errorf("%s: node round trip %+v, %v", tc.dest, back, err)
+		}
+		if b[destOffFlags] != 0 {
+			t.Errorf("%s: flags %#x for a node destination", tc.dest, b[destOffFlags])
+		}
+		d.Direct = true
+		if b, err = d.MarshalBinary(); err != nil || b[destOffFlags] != ndFlagDirect {
+			t.Errorf("%s: direct flags % x, %v", tc.dest, b, err)
+		}
+		if err := back.UnmarshalBinary(b); err != nil || back != d {
+			t.Errorf("%s: direct round trip %+v, %v", tc.dest, back, err)
+		}
+		s := SubDest{Ifindex: 3, Dest: d.Dest}
+		b, err = s.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sback SubDest
+		if err := sback.UnmarshalBinary(b); err != nil || sback != s {
+			t.Errorf("%s: sub round trip %+v, %v", tc.dest, sback, err)
+		}
+	}
+}
+
+func TestDestBinaryInvalid(t *testing.T) {
+	for _, d := range []NodeDest{{}, {Dest: netip.MustParseAddrPort("[fe80::1%eth0]:1")}} {
+		if _, err := d.MarshalBinary(); err == nil {
+			t.Errorf("%v: marshalled", d.Dest)
+		}
+	}
+	var d NodeDest
+	if err := d.UnmarshalBinary(make([]byte, DestSize)); err == nil {
+		t.Error("family 0 accepted")
+	}
+	if err := d.UnmarshalBinary(make([]byte, 20)); err == nil {
+		t.Error("short value accepted")
+	}
+}
+
+// JSON 모양(loader API, apply 파일)은 바뀌지 않는다
+func TestDestJSON(t *testing.T) {
+	in := `{"node_id":1,"addr":"fd00::11","port":32000}`
+	var d NodeDest
+	if err := json.Unmarshal([]byte(in), &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Dest != netip.MustParseAddrPort("[fd00::11]:32000") {
+		t.Fatalf("decoded %v", d.Dest)
+	}
+	out, _ := json.Marshal(d)
+	if string(out) != in {
+		t.Errorf("got %s, want %s", out, in)
+	}
+	direct := `{"node_id":2,"addr":"10.1.2.1","port":31002,"direct":true}`
+	if err := json.Unmarshal([]byte(direct), &d); err != nil || !d.Direct {
+		t.Fatalf("decoded %+v, %v", d, err)
+	}
+	if out, _ = json.Marshal(d); string(out) != direct {
+		t.Errorf("got %s, want %s", out, direct)
+	}
+	out, _ = json.Marshal(SubDest{Dest: netip.MustParseAddrPort("10.1.0.1:31001")})
+	if want := `{"addr":"10.1.0.1","port":31001}`; string(out) != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+}
@@ -0,0 +1,106 @@
+package maps
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Diff: a → b 변화를 한 줄씩 (topic, (node, topic) 순으로 정렬). 같으면 nil.
+// 집합 안의 원소 순서는 데이터패스 의미가 없으므로 무시한다.
+//
+//	topic 3: + node 2 192.168.0.12:32000
+//	topic 4: + node 1 [fd00::11]:32000
+//	node 0 topic 2: - 10.1.0.5:31001
+func Diff(a, b Tables) []string {
+	var out []string
+
+	topics := map[uint32]bool{}
+	for id := range a.Topics {
+		topics[id] = true
+	}
+	for id := range b.Topics {
+		topics[id] = true
+	}
+	for _, id := range sortedKeys(topics) {
+		prefix := fmt.Sprintf("topic %d: ", id)
+		out = append(out, diffSet(prefix, nodeDestStrings(a.Topics[id]), nodeDestStrings(b.Topics[id]))...)
+	}
+
+	locals := map[LocalKey]bool{}
+	for _, t := range []Tables{a, b} {
+		for nID, byTopic := range t.Nodes {
+			for tID := range byTopic {
+				locals[LocalKey{NodeID: nID, TopicID: tID}] = true
+			}
+		}
+	}
+	keys := make([]LocalKey, 0, len(locals))
+	for k := range locals {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].NodeID != keys[j].NodeID {
+			return keys[i].NodeID < keys[j].NodeID
+		}
+		return keys[i].TopicID < keys[j].TopicID
+	})
+	for _, k := range keys {
+		prefix := fmt.Sprintf("node %d topic %d: ", k.NodeID, k.TopicID)
+		out = append(out, diffSet(prefix, subDestStrings(a.Nodes[k.NodeID][k.TopicID]), subDestStrings(b.Nodes[k.NodeID][k.TopicID]))...)
+	}
+	return out
+}
+
+func sortedKeys(m map[uint32]bool) []uint32 {
+	out := make([]uint32, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+func nodeDestStrings(ds []NodeDest) []string {
+	out := make([]string, len(ds))
+	for i, d := range ds {
+		out[i] = fmt.Sprintf("node %d %s", d.NodeID, d.Dest)
+		if d.Direct {
+			out[i] += " direct"
+		}
+	}
+	return out
+}
+
+func subDestStrings(ss []SubDest) []string {
+	out := make([]string, len(ss))
+	for i, s := range ss {
+		out[i] = s.Dest.String()
+		if s.Ifindex != 0 {
+			out[i] += fmt.Sprintf(" if%d", s.Ifindex)
+		}
+	}
+	return out
+}
+
+// diffSet: 다중집합 차이. 삭제(-)를 먼저, 각각 정렬.
+func diffSet(prefix string, a, b []string) []string {
+	cnt := map[string]int{}
+	for _, s := range a {
+		cnt[s]--
+	}
+	for _, s := range b {
+		cnt[s]++
+	}
+	var del, add []string
+	for s, n := range cnt {
+		for ; n < 0; n++ {
+			del = append(del, prefix+"- "+s)
+		}
+		for ; n > 0; n-- {
+			add = append(add, prefix+"+ "+s)
+		}
+	}
+	sort.Strings(del)
+	sort.Strings(add)
+	return append(del, add...)
+}
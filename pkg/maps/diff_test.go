@@ -0,0 +1,101 @@
+package maps
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestReadGenerationRoundTrip(t *testing.T) {
+	f := NewFake()
+	want := Tables{
+		Topics: map[uint32][]NodeDest{
+			1: {{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")}, {NodeID: 1, Dest: netip.MustParseAddrPort("192.168.0.11:32000")}},
+			2: {{NodeID: 1, Dest: netip.MustParseAddrPort("[fd00::11]:32000")}},
+		},
+		Nodes: map[uint32]map[uint32][]SubDest{
+			0: {1: {{Dest: netip.MustParseAddrPort("10.1.0.1:31001")}, {Ifindex: 7, Dest: netip.MustParseAddrPort("10.1.0.2:31002")}}},
+			1: {1: {{Dest: netip.MustParseAddrPort("10.1.1.1:31001")}}, 2: {{Dest: netip.MustParseAddrPort("[fd00:10:1:1::1]:31001")}}},
+		},
+	}
+	if err := f.WriteGeneration(0, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.ReadGeneration(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read back %+v, want %+v", got, want)
+	}
+	if d := Diff(want, got); d != nil {
+		t.Errorf("diff of identical tables: %v", d)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := Tables{
+		Topics: map[uint32][]NodeDest{
+			1: {{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")}, {NodeID: 1, Dest: netip.MustParseAddrPort("192.168.0.11:32000")}},
+			2: {{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")}},
+		},
+		Nodes: map[uint32]map[uint32][]SubDest{
+			0: {1: {{Dest: netip.MustParseAddrPort("10.1.0.1:31001")}}, 2: {{Dest: netip.MustParseAddrPort("10.1.0.2:31001")}}},
+		},
+	}
+	b := Tables{
+		Topics: map[uint32][]NodeDest{
+			// 순서만 바뀐 것은 차이 아님
+			1: {{NodeID: 1, Dest: netip.MustParseAddrPort("192.168.0.11:32000")}, {NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")}},
+			3: {{NodeID: 2, Dest: netip.MustParseAddrPort("192.168.0.12:32000")}},
+			4: {{NodeID: 1, Dest: netip.MustParseAddrPort("[fd00::11]:32000")}},
+		},
+		Nodes: map[uint32]map[uint32][]SubDest{
+			0: {1: {{Dest: netip.MustParseAddrPort("10.1.0.1:31002")}}},
+		},
+	}
+	want := []string{
+		"topic 2: - node 0 192.168.0.10:32000",
+		"topic 3: + node 2 192.168.0.12:32000",
+		"topic 4: + node 1 [fd00::11]:32000",
+		"node 0 topic 1: - 10.1.0.1:31001",
+		"node 0 topic 1: + 10.1.0.1:31002",
+		"node 0 topic 2: - 10.1.0.2:31001",
+	}
+	if got := Diff(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff =\n%v\nwant\n%v", got, want)
+	}
+}
+
+// Version은 내용에만 의존한다 (controller와 psbenchctl이 같은 값을 내야 한다).
+// 목적지 순서도 내용이다: 카운트를 줄이면 앞쪽만 남고 마지막 목적지가 원본 skb를 받는다.
+// 그래서 같은 원소라도 순서가 다르면 버전이 다르다 (controller는 목적지를 정렬해 버전을 안정시킨다).
+func TestTablesVersion(t *testing.T) {
+	n0 := NodeDest{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")}
+	n1 := NodeDest{NodeID: 1, Dest: netip.MustParseAddrPort("192.168.0.11:32000")}
+	s0 := SubDest{Dest: netip.MustParseAddrPort("10.1.0.1:31001")}
+	s1 := SubDest{Dest: netip.MustParseAddrPort("10.1.0.2:31001")}
+	build := func(nodes []NodeDest, subs []SubDest) Tables {
+		return Tables{
+			Topics: map[uint32][]NodeDest{1: nodes, 2: {n0}},
+			Nodes:  map[uint32]map[uint32][]SubDest{0: {1: subs}},
+		}
+	}
+	a := build([]NodeDest{n0, n1}, []SubDest{s0, s1})
+	if v := a.Version(); len(v) != 16 {
+		t.Errorf("version %q, want 16 hex digits", v)
+	}
+	if b := build([]NodeDest{n0, n1}, []SubDest{s0, s1}); b.Version() != a.Version() {
+		t.Errorf("same tables: versions %s, %s", a.Version(), b.Version())
+	}
+	for name, b := range map[string]Tables{
+		"node order":       build([]NodeDest{n1, n0}, []SubDest{s0, s1}),
+		"subscriber order": build([]NodeDest{n0, n1}, []SubDest{s1, s0}),
+		"direct flag":      build([]NodeDest{n0, {NodeID: 1, Dest: n1.Dest, Direct: true}}, []SubDest{s0, s1}),
+		"fewer nodes":      build([]NodeDest{n0}, []SubDest{s0, s1}),
+	} {
+		if b.Version() == a.Version() {
+			t.Errorf("%s: different tables share version %s", name, a.Version())
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package maps
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// ErrInvalid: 테이블이 데이터패스 한도나 형식을 어김. 다시 써도 결과가 같다.
+var ErrInvalid = errors.New("invalid tables")
+
+func invalidf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, args...))
+}
+
+// WriteError: 세대 쓰기가 멈춘 위치. 실패한 세대는 일부만 쓰였으므로 플립하면 안 된다.
+// Op: topic | local | clear_topics | clear_local
+type WriteError struct {
+	Gen   uint32
+	Op    string
+	Node  uint32 // Op == local
+	Topic uint32 // Op == topic | local
+	Err   error
+}
+
+func (e *WriteError) Error() string {
+	switch e.Op {
+	case "topic":
+		return fmt.Sprintf("gen %d: topic %d: %v", e.Gen, e.Topic, e.Err)
+	case "local":
+		return fmt.Sprintf("gen %d: node %d topic %d: %v", e.Gen, e.Node, e.Topic, e.Err)
+	}
+	return fmt.Sprintf("gen %d: %s: %v", e.Gen, e.Op, e.Err)
+}
+
+func (e *WriteError) Unwrap() error { return e.Err }
+
+// Transient: 같은 쓰기를 다시 하면 성공할 수 있는 커널 오류(메모리 부족, 경합, 인터럽트).
+func Transient(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.ENOMEM, syscall.EAGAIN, syscall.EBUSY, syscall.EINTR} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
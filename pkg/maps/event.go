@@ -0,0 +1,41 @@
+package maps
+
+// m_ring 샘플 이벤트 디코딩. 레이아웃은 commons.h의 struct pkt_event와 동일해야 한다.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type Event struct {
+	KtimeNs    uint64
+	TopicID    uint32
+	Hop        uint16
+	Fanout     uint16
+	DropReason uint32
+	Pad        uint32
+}
+
+// EventSize: sizeof(struct pkt_event)
+const EventSize = 24
+
+// DecodeEvent: ringbuf 레코드(raw sample) → Event
+func DecodeEvent(b []byte) (Event, error) {
+	var e Event
+	if len(b) < EventSize {
+		return e, fmt.Errorf("short event: %d bytes", len(b))
+	}
+	if err := binary.Read(bytes.NewReader(b[:EventSize]), binary.NativeEndian, &e); err != nil {
+		return e, err
+	}
+	return e, nil
+}
+
+// Reason: drop_reason 라벨 (범위 밖이면 숫자 그대로)
+func (e Event) Reason() string {
+	if e.DropReason < DrMax {
+		return DropReasons[e.DropReason]
+	}
+	return fmt.Sprint(e.DropReason)
+}
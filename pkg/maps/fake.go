@@ -0,0 +1,199 @@
+package maps
+
+// 메모리 데이터패스: 권한/bpffs 없이 Datapath를 쓰는 코드(loader API, controller reconcile)를 테스트한다.
+// Datapath의 읽기/쓰기 로직은 그대로 두고 맵만 메모리 구현으로 바꾸므로, 커널 맵과 다르게 보일 수
+// 있는 부분만 흉내 내면 된다:
+//   - ARRAY / ARRAY_OF_MAPS: 키는 0..max-1. ARRAY는 모든 인덱스가 0 값으로 존재하고 삭제 불가(EINVAL),
+//     ARRAY_OF_MAPS의 빈 슬롯은 ErrKeyNotExist. 범위 밖 쓰기는 E2BIG.
+//   - HASH / HASH_OF_MAPS: max_entries를 넘는 새 키는 E2BIG.
+//   - UpdateExist / UpdateNoExist 플래그.
+// NextKey 순서는 ARRAY는 인덱스 순, HASH는 삽입 순이다(커널은 순서를 보장하지 않는다).
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"syscall"
+
+	"github.com/cilium/ebpf"
+)
+
+type memKind int
+
+const (
+	memArray memKind = iota
+	memHash
+	memArrayOfMaps
+	memHashOfMaps
+)
+
+type memMap struct {
+	name string
+	kind memKind
+	max  uint32
+	keys []string          // 삽입 순서 (HASH NextKey용)
+	kv   map[string][2]any // 키 문자열 → {키, 값}
+	fail *func(op, name string, key any) error
+}
+
+// Fake: 메모리 맵 위의 Datapath. m_cfg와 gen0/gen1 테이블의 종류와 크기는 tc_hier_pubsub_kern.c와 같다.
+type Fake struct {
+	*Datapath
+	// Fail: nil이 아니면 맵 쓰기마다(op = update|delete, name = 맵 이름, inner 맵은 "inner") 먼저 호출된다.
+	// 오류를 돌려주면 그 쓰기는 반영되지 않고 그 오류로 실패한다.
+	Fail func(op, name string, key any) error
+}
+
+func NewFake() *Fake {
+	f := &Fake{}
+	mk := func(name string, kind memKind, max uint32) *memMap {
+		return &memMap{name: name, kind: kind, max: max, kv: map[string][2]any{}, fail: &f.Fail}
+	}
+	d := &Datapath{Cfg: mk("m_cfg", memArray, 1)}
+	for gen := range d.gens {
+		n := genNames(gen)
+		d.gens[gen] = genMaps{
+			topicNodes: mk(n[0], memArrayOfMaps, MaxTopics),
+			topicCnt:   mk(n[1], memArray, MaxTopics),
+			nodeSubs:   mk(n[2], memHashOfMaps, MaxLocalSets),
+			nodeCnt:    mk(n[3], memHash, MaxLocalSets),
+		}
+	}
+	d.newInner = func(max uint32) (innerMap, error) { return mk("inner", memArray, max), nil }
+	d.lookupInner = func(outer Map, key any) (innerMap, error) {
+		var in *memMap
+		if err := outer.Lookup(key, &in); err != nil {
+			return nil, err
+		}
+		return in, nil
+	}
+	f.Datapath = d
+	return f
+}
+
+func deref(v any) any { return reflect.Indirect(reflect.ValueOf(v)).Interface() }
+
+func (m *memMap) isArray() bool { return m.kind == memArray || m.kind == memArrayOfMaps }
+
+// index: ARRAY 계열 키(uint32)와 범위 검사
+func (m *memMap) index(key any) (uint32, bool) {
+	i, ok := deref(key).(uint32)
+	return i, ok && i < m.max
+}
+
+func (m *memMap) Lookup(key, out any) error {
+	if m.isArray() {
+		if _, ok := m.index(key); !ok {
+			return ebpf.ErrKeyNotExist
+		}
+	}
+	e, ok := m.kv[fmt.Sprint(deref(key))]
+	switch {
+	case ok:
+		reflect.ValueOf(out).Elem().Set(reflect.ValueOf(e[1]))
+	case m.kind == memArray:
+		// 커널처럼 0 바이트를 디코드한다 (BinaryUnmarshaler인 값은 dest 원소뿐이다)
+		if u, ok := out.(encoding.BinaryUnmarshaler); ok {
+			return u.UnmarshalBinary(make([]byte, DestSize))
+		}
+		o := reflect.ValueOf(out).Elem()
+		o.Set(reflect.Zero(o.Type()))
+	default:
+		return ebpf.ErrKeyNotExist
+	}
+	return nil
+}
+
+func (m *memMap) Update(key, value any, flags ebpf.MapUpdateFlags) error {
+	k := fmt.Sprint(deref(key))
+	if m.fail != nil && *m.fail != nil {
+		if err := (*m.fail)("update", m.name, deref(key)); err != nil {
+			return err
+		}
+	}
+	_, exists := m.kv[k]
+	if m.isArray() {
+		if _, ok := m.index(key); !ok {
+			return fmt.Errorf("update %s: %w", m.name, syscall.E2BIG)
+		}
+		exists = exists || m.kind == memArray
+	}
+	switch {
+	case flags == ebpf.UpdateNoExist && exists:
+		return ebpf.ErrKeyExist
+	case flags == ebpf.UpdateExist && !exists:
+		return ebpf.ErrKeyNotExist
+	case !exists && !m.isArray() && uint32(len(m.kv)) >= m.max:
+		return fmt.Errorf("update %s: %w", m.name, syscall.E2BIG)
+	}
+	if m.kind == memArrayOfMaps || m.kind == memHashOfMaps {
+		if _, ok := value.(*memMap); !ok {
+			return fmt.Errorf("update %s: value %T is not a map: %w", m.name, value, syscall.EINVAL)
+		}
+	} else {
+		value = deref(value)
+	}
+	if _, ok := m.kv[k]; !ok {
+		m.keys = append(m.keys, k)
+	}
+	m.kv[k] = [2]any{deref(key), value}
+	return nil
+}
+
+func (m *memMap) Delete(key any) error {
+	if m.fail != nil && *m.fail != nil {
+		if err := (*m.fail)("delete", m.name, deref(key)); err != nil {
+			return err
+		}
+	}
+	if m.kind == memArray {
+		return fmt.Errorf("delete %s: %w", m.name, syscall.EINVAL)
+	}
+	k := fmt.Sprint(deref(key))
+	if _, ok := m.kv[k]; !ok {
+		return ebpf.ErrKeyNotExist
+	}
+	delete(m.kv, k)
+	for i, s := range m.keys {
+		if s == k {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// NextKey: 커널처럼 key가 nil이거나 없는 키면 첫 키부터.
+func (m *memMap) NextKey(key, out any) error {
+	o := reflect.ValueOf(out).Elem()
+	if m.isArray() {
+		next := uint32(0)
+		if key != nil {
+			if i, ok := m.index(key); ok {
+				next = i + 1
+			}
+		}
+		if next >= m.max {
+			return ebpf.ErrKeyNotExist
+		}
+		o.Set(reflect.ValueOf(next))
+		return nil
+	}
+	i := 0
+	if key != nil {
+		k := fmt.Sprint(deref(key))
+		for j, s := range m.keys {
+			if s == k {
+				i = j + 1
+				break
+			}
+		}
+	}
+	if i >= len(m.keys) {
+		return ebpf.ErrKeyNotExist
+	}
+	o.Set(reflect.ValueOf(m.kv[m.keys[i]][0]))
+	return nil
+}
+
+func (m *memMap) Close() error { return nil }
@@ -0,0 +1,216 @@
+package maps
+
+// NewFake의 실패 주입으로 WriteGeneration의 중단/재시도 경로를 커널 없이 검증한다.
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"syscall"
+	"testing"
+
+	"github.com/cilium/ebpf"
+)
+
+func testTables(subs ...string) Tables {
+	t := Tables{
+		Topics: map[uint32][]NodeDest{1: {{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")}}},
+		Nodes:  map[uint32]map[uint32][]SubDest{0: {}},
+	}
+	for i, s := range subs {
+		a, _ := netip.ParseAddr(s) // 잘못된 주소는 0값 Addr (Validate가 거른다)
+		t.Nodes[0][uint32(i+1)] = []SubDest{{Dest: netip.AddrPortFrom(a, 31001)}}
+	}
+	return t
+}
+
+func TestWriteGenerationInvalidTouchesNothing(t *testing.T) {
+	f := NewFake()
+	var ops int
+	f.Fail = func(string, string, any) error { ops++; return nil }
+
+	tb := testTables("10.1.0.1")
+	tb.Topics[MaxTopics] = nil
+	err := f.WriteGeneration(1, tb)
+	if !errors.Is(err, ErrInvalid) {
+		t.Fatalf("err = %v, want ErrInvalid", err)
+	}
+	if ops != 0 {
+		t.Errorf("%d map writes before rejecting invalid tables", ops)
+	}
+}
+
+// 토픽 하나의 목적지는 한 family여야 한다. 토픽이 다르면 섞여도 된다.
+func TestValidateAddressFamily(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		subs []string // testTables: 노드 0 topic i+1 구독자, topic 1 노드는 IPv4
+		ok   bool
+	}{
+		{"ipv4", []string{"10.1.0.1"}, true},
+		{"per-topic families", []string{"10.1.0.1", "fd00:10:1::2"}, true},
+		{"mixed in topic", []string{"fd00:10:1::1"}, false},
+		{"zone", []string{"10.1.0.1", "fe80::1%eth0"}, false},
+		{"unset", []string{"sub-0"}, false},
+	} {
+		err := testTables(tc.subs...).Validate()
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: Validate = %v, want ok=%v", tc.name, err, tc.ok)
+		}
+		if err != nil && !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: %v is not ErrInvalid", tc.name, err)
+		}
+	}
+}
+
+// 중간에 실패하면 *WriteError로 위치를 알려주고, 같은 테이블로 다시 쓰면 정상 상태가 된다.
+func TestWriteGenerationPartialFailureThenRetry(t *testing.T) {
+	f := NewFake()
+	if err := f.WriteGeneration(1, testTables("10.1.0.1", "10.1.0.2", "10.1.0.3")); err != nil {
+		t.Fatal(err)
+	}
+
+	broken := LocalKey{NodeID: 0, TopicID: 2}
+	f.Fail = func(op, name string, key any) error {
+		if op == "update" && name == "node_to_local_sub_gen1" && key == broken {
+			return fmt.Errorf("outer: %w", syscall.ENOMEM)
+		}
+		return nil
+	}
+	want := testTables("10.1.0.11", "10.1.0.12")
+	err := f.WriteGeneration(1, want)
+	var we *WriteError
+	if !errors.As(err, &we) {
+		t.Fatalf("err = %v, want *WriteError", err)
+	}
+	if we.Gen != 1 || we.Op != "local" || we.Node != 0 || we.Topic != 2 {
+		t.Errorf("WriteError = %+v, want gen 1 local node 0 topic 2", we)
+	}
+	if !Transient(err) {
+		t.Errorf("ENOMEM not reported as transient: %v", err)
+	}
+	// gen0은 건드리지 않음
+	if keys, _ := mapKeys[LocalKey](f.gens[0].nodeCnt); len(keys) != 0 {
+		t.Errorf("gen0 local sets written: %v", keys)
+	}
+
+	f.Fail = nil
+	if err := f.WriteGeneration(1, want); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	for topic, addr := range map[uint32]string{1: "10.1.0.11", 2: "10.1.0.12"} {
+		got, err := f.NodeLocalSubs(1, LocalKey{NodeID: 0, TopicID: topic})
+		if err != nil || len(got) != 1 || got[0].Dest.Addr().String() != addr {
+			t.Errorf("topic %d: local set %+v (err %v) after retry", topic, got, err)
+		}
+	}
+	if got, err := f.NodeLocalSubs(1, LocalKey{NodeID: 0, TopicID: 3}); got != nil || err != nil {
+		t.Errorf("stale topic 3 local set survived retry: %+v (err %v)", got, err)
+	}
+}
+
+func TestTransient(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("x: %w", syscall.ENOMEM), true},
+		{&WriteError{Op: "topic", Err: syscall.EBUSY}, true},
+		{fmt.Errorf("x: %w", syscall.EINVAL), false},
+		{invalidf("too big"), false},
+	} {
+		if got := Transient(tc.err); got != tc.want {
+			t.Errorf("Transient(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestFakeMapKinds(t *testing.T) {
+	f := NewFake()
+	key := uint32(0)
+	if err := f.Cfg.Delete(&key); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("ARRAY delete: %v, want EINVAL", err)
+	}
+	if err := f.Cfg.Update(&key, &Config{}, ebpf.UpdateNoExist); !errors.Is(err, ebpf.ErrKeyExist) {
+		t.Errorf("ARRAY update NoExist: %v, want ErrKeyExist", err)
+	}
+	var c Config
+	if one := uint32(1); !errors.Is(f.Cfg.Lookup(&one, &c), ebpf.ErrKeyNotExist) {
+		t.Errorf("ARRAY lookup past max_entries succeeded")
+	}
+	if _, err := f.lookupInner(f.gens[0].topicNodes, &key); !errors.Is(err, ebpf.ErrKeyNotExist) {
+		t.Errorf("ARRAY_OF_MAPS empty slot: %v, want ErrKeyNotExist", err)
+	}
+
+	cnt := f.gens[0].nodeCnt
+	n := uint32(1)
+	for i := uint32(0); i < MaxLocalSets; i++ {
+		if err := cnt.Update(&LocalKey{NodeID: i}, &n, ebpf.UpdateAny); err != nil {
+			t.Fatalf("HASH update %d: %v", i, err)
+		}
+	}
+	if err := cnt.Update(&LocalKey{NodeID: MaxLocalSets}, &n, ebpf.UpdateAny); !errors.Is(err, syscall.E2BIG) {
+		t.Errorf("HASH update past max_entries: %v, want E2BIG", err)
+	}
+	if err := cnt.Update(&LocalKey{NodeID: 0}, &n, ebpf.UpdateExist); err != nil {
+		t.Errorf("HASH overwrite when full: %v", err)
+	}
+}
+
+// storeTrace: Store 공개 API로 세대를 쓰고 다시 쓰며 관찰한 결과. 커널 맵과 NewFake가 같아야 한다.
+func storeTrace(t *testing.T, s Store) []string {
+	t.Helper()
+	var out []string
+	note := func(format string, args ...any) { out = append(out, fmt.Sprintf(format, args...)) }
+
+	if _, err := s.UpdateConfig(func(c *Config) { c.EgressIfindex, c.LocalNodeID = 1, 0 }); err != nil {
+		t.Fatal(err)
+	}
+	for _, subs := range [][]string{{"10.1.0.1", "10.1.0.2", "10.1.0.3"}, {"10.1.0.9"}} {
+		if err := s.WriteGeneration(1, testTables(subs...)); err != nil {
+			t.Fatal(err)
+		}
+		c, err := s.Counts(1)
+		note("counts %v %v err=%v", c.Topics, c.Local, err)
+		nd, err := s.TopicNodeSet(1, 1)
+		note("topic 1 %v err=%v", nd, err)
+		nd, err = s.TopicNodeSet(1, 2)
+		note("topic 2 %v err=%v", nd, err)
+		for topic := uint32(1); topic <= 3; topic++ {
+			sd, err := s.NodeLocalSubs(1, LocalKey{NodeID: 0, TopicID: topic})
+			note("local 0/%d %v err=%v", topic, sd, err)
+		}
+		tb, err := s.ReadGeneration(1)
+		note("read %v err=%v", Diff(tb, testTables(subs...)), err)
+	}
+	if err := s.SetActiveGen(1); err != nil {
+		t.Fatal(err)
+	}
+	c, err := s.Config()
+	note("cfg %+v err=%v", c, err)
+	note("gen2 %v", s.WriteGeneration(2, Tables{}))
+	return out
+}
+
+func TestFakeMatchesKernel(t *testing.T) {
+	want := storeTrace(t, NewFake())
+	if len(want) == 0 {
+		t.Fatal("empty trace")
+	}
+	t.Run("kernel", func(t *testing.T) {
+		coll := loadObject(t)
+		dp, err := New(coll.Maps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := storeTrace(t, dp)
+		if len(got) != len(want) {
+			t.Fatalf("kernel trace has %d steps, fake %d", len(got), len(want))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("step %d: kernel %q, fake %q", i, got[i], want[i])
+			}
+		}
+	})
+}
@@ -1,4 +1,37 @@
 package maps
 
-// (예비 확장 지점) bpffs 맵 유틸. 현재는 controller/main.go에 인라인.
+// bpffs 맵 유틸. 데이터패스(commons.h)와 값 레이아웃을 공유하는 Go 타입을 모아둔다.
 
+import "github.com/cilium/ebpf"
+
+// Map: 테이블/설정 쓰기에 필요한 맵 연산. *ebpf.Map이 그대로 만족하며,
+// NewFake(fake.go)는 같은 의미의 메모리 구현으로 바꿔 끼운다.
+type Map interface {
+	Lookup(key, valueOut interface{}) error
+	Update(key, value interface{}, flags ebpf.MapUpdateFlags) error
+	Delete(key interface{}) error
+	NextKey(key, nextKeyOut interface{}) error
+}
+
+// Store: 한 노드의 데이터패스 테이블에 대한 타입 있는 API.
+// 실제 맵(New, OpenPinned)과 메모리 구현(NewFake)이 같은 Datapath 코드를 공유하므로 의미가 같다.
+type Store interface {
+	// m_cfg (config.go)
+	Config() (Config, error)
+	UpdateConfig(fn func(*Config)) (Config, error)
+	ActiveGen() (uint32, error)
+	SetActiveGen(gen uint32) error
+
+	// 세대별 테이블 (tables.go)
+	TopicNodeSet(gen, topic uint32) ([]NodeDest, error)
+	NodeLocalSubs(gen uint32, k LocalKey) ([]SubDest, error)
+	Counts(gen uint32) (Counts, error)
+	WriteGeneration(gen uint32, t Tables) error
+	ReadGeneration(gen uint32) (Tables, error)
+	SetTopicCount(gen, topic, n uint32) error
+	SetLocalCount(gen uint32, k LocalKey, n uint32) error
+
+	Close()
+}
+
+var _ Store = (*Datapath)(nil)
@@ -0,0 +1,68 @@
+package maps
+
+// m_metrics(PERCPU_ARRAY, 키=0) 판독. 레이아웃은 commons.h의 struct metrics와 동일해야 한다.
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf"
+)
+
+// enum drop_reason 과 동일한 순서
+const (
+	DrOK     = iota
+	DrNotUDP // 데이터패스가 더 이상 세지 않는다 (Metrics.Skipped)
+	DrTooShort
+	DrNoTopic
+	DrNoNodeset
+	DrNoLocalset
+	DrCloneFail
+	DrHelperErr
+	DrFamily // 목적지와 패킷의 주소 family 불일치
+	DrMax
+)
+
+// DropReasons: drop_reason 라벨 값 (인덱스 = enum 값)
+var DropReasons = [DrMax]string{
+	"ok",
+	"not_udp",
+	"too_short",
+	"no_topic",
+	"no_nodeset",
+	"no_localset",
+	"clone_fail",
+	"helper_err",
+	"family_mismatch",
+}
+
+type Metrics struct {
+	Tier1Clones uint64
+	Tier2Clones uint64
+	Drops       [DrMax]uint64
+	Skipped     uint64 // psbench 트래픽 아님: 비IP, 비UDP, cfg 필터에 안 맞는 UDP (드롭 아님)
+}
+
+func (m *Metrics) add(o Metrics) {
+	m.Tier1Clones += o.Tier1Clones
+	m.Tier2Clones += o.Tier2Clones
+	m.Skipped += o.Skipped
+	for i := range m.Drops {
+		m.Drops[i] += o.Drops[i]
+	}
+}
+
+// ReadMetrics: CPU별 값을 모두 합산해 반환.
+func ReadMetrics(m *ebpf.Map) (Metrics, error) {
+	var (
+		key uint32
+		per []Metrics
+		sum Metrics
+	)
+	if err := m.Lookup(&key, &per); err != nil {
+		return sum, fmt.Errorf("lookup m_metrics: %w", err)
+	}
+	for _, v := range per {
+		sum.add(v)
+	}
+	return sum, nil
+}
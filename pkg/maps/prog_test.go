@@ -0,0 +1,464 @@
+package maps
+
+// tc_hier_pubsub 단위 테스트: 맵은 pkg/maps로 채우고 BPF_PROG_TEST_RUN으로 패킷 하나씩 흘린다.
+// 반환 코드, 바뀐 헤더(hop, daddr, dport), 체크섬, m_metrics 증가분을 본다.
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+
+	"github.com/cilium/ebpf"
+)
+
+const (
+	// tcActNext: TC_ACT_UNSPEC(-1) = TCX_NEXT. 소비하지 않은 패킷은 뒤 프로그램(Cilium 등)으로 넘겨야 한다.
+	// TC_ACT_OK(0)는 체인을 끝내므로 어떤 경로도 내면 안 된다.
+	tcActNext = ^uint32(0)
+	tcActShot = 2
+)
+
+// progEnv: 오브젝트 하나와 그 맵 위의 Datapath (테스트마다 새로 로드하므로 카운터는 0에서 시작)
+type progEnv struct {
+	coll *ebpf.Collection
+	dp   *Datapath
+	prog *ebpf.Program
+}
+
+func newProgEnv(t *testing.T, cfg Config) *progEnv {
+	t.Helper()
+	coll := loadObject(t)
+	dp, err := New(coll.Maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := uint32(0)
+	if err := dp.Cfg.Update(&key, &cfg, ebpf.UpdateAny); err != nil {
+		t.Fatalf("cfg init: %v", err)
+	}
+	return &progEnv{coll: coll, dp: dp, prog: coll.Programs["tc_hier_pubsub"]}
+}
+
+func (e *progEnv) metrics(t *testing.T) Metrics {
+	t.Helper()
+	m, err := ReadMetrics(e.coll.Maps["m_metrics"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// run: 패킷 하나를 흘리고 (반환 코드, 결과 패킷, 이번 실행의 카운터 증가분)
+func (e *progEnv) run(t *testing.T, pkt []byte) (uint32, []byte, Metrics) {
+	t.Helper()
+	before := e.metrics(t)
+	ret, out := runPacket(t, e.prog, pkt)
+	after := e.metrics(t)
+	d := Metrics{
+		Tier1Clones: after.Tier1Clones - before.Tier1Clones,
+		Tier2Clones: after.Tier2Clones - before.Tier2Clones,
+		Skipped:     after.Skipped - before.Skipped,
+	}
+	for i := range d.Drops {
+		d.Drops[i] = after.Drops[i] - before.Drops[i]
+	}
+	return ret, out, d
+}
+
+// udpView: 결과 패킷에서 보는 필드 (eth + IPv4/IPv6 + UDP + topic_hdr)
+type udpView struct {
+	daddr netip.Addr
+	dport uint16
+	hop   uint16
+	ip    []byte
+	l4    []byte
+}
+
+func viewPacket(t *testing.T, b []byte) udpView {
+	t.Helper()
+	ipLen := 20
+	if binary.BigEndian.Uint16(b[12:14]) == 0x86dd {
+		ipLen = 40
+	}
+	if len(b) < 14+ipLen+16 {
+		t.Fatalf("short output packet: %d bytes", len(b))
+	}
+	v := udpView{ip: b[14 : 14+ipLen], l4: b[14+ipLen:]}
+	if ipLen == 20 {
+		v.daddr, _ = netip.AddrFromSlice(v.ip[16:20])
+	} else {
+		v.daddr, _ = netip.AddrFromSlice(v.ip[24:40])
+	}
+	v.dport = binary.BigEndian.Uint16(v.l4[2:4])
+	v.hop = binary.BigEndian.Uint16(v.l4[8+6 : 8+8])
+	return v
+}
+
+// checkSums: IPv4 헤더 체크섬과 (사용 중이면) UDP 체크섬
+func (v udpView) checkSums(t *testing.T) {
+	t.Helper()
+	if v.ip[0]>>4 == 4 {
+		if got, want := binary.BigEndian.Uint16(v.ip[10:12]), ipChecksum(v.ip); got != want {
+			t.Errorf("ip checksum %#04x, want %#04x", got, want)
+		}
+		if binary.BigEndian.Uint16(v.l4[6:8]) == 0 {
+			return
+		}
+	}
+	if c := udpChecksum(v.ip, v.l4); c != 0 {
+		t.Errorf("udp checksum invalid (residue %#04x)", c)
+	}
+}
+
+// 1차 fan-out: 마지막 목적지는 원본 skb, 나머지는 clone. hop은 1이 된다.
+func TestProgHop0(t *testing.T) {
+	e := newProgEnv(t, Config{EgressIfindex: 1, LocalRouteIfindex: 1, LocalNodeID: 0})
+	nodes := []NodeDest{
+		{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")},
+		{NodeID: 1, Dest: netip.MustParseAddrPort("192.168.0.11:32000")},
+		{NodeID: 2, Dest: netip.MustParseAddrPort("192.168.0.12:32001")},
+	}
+	node6 := []NodeDest{
+		{NodeID: 0, Dest: netip.MustParseAddrPort("[fd00::10]:32000")},
+		{NodeID: 1, Dest: netip.MustParseAddrPort("[fd00::11]:32002")},
+	}
+	if err := e.dp.WriteGeneration(0, Tables{Topics: map[uint32][]NodeDest{1: nodes, 6: node6}}); err != nil {
+		t.Fatalf("write generation: %v", err)
+	}
+
+	noCsum := udpPacket(netip.MustParseAddr("10.0.0.1"), 32000, 1, 0)
+	noCsum[34+6], noCsum[34+7] = 0, 0
+
+	for _, tc := range []struct {
+		name   string
+		pkt    []byte
+		want   netip.AddrPort
+		n      int
+		noCsum bool
+	}{
+		{"ipv4", udpPacket(netip.MustParseAddr("10.0.0.1"), 32000, 1, 0), nodes[2].Dest, len(nodes), false},
+		{"ipv4 without udp checksum", noCsum, nodes[2].Dest, len(nodes), true},
+		{"ipv6", udp6Packet(netip.MustParseAddr("fd00::1"), 32000, 6, 0), node6[1].Dest, len(node6), false},
+	} {
+		ret, out, m := e.run(t, tc.pkt)
+		if ret != tcActNext {
+			t.Errorf("%s: ret %d, want TC_ACT_UNSPEC", tc.name, ret)
+		}
+		v := viewPacket(t, out)
+		if got := netip.AddrPortFrom(v.daddr, v.dport); got != tc.want {
+			t.Errorf("%s: original skb sent to %s, want last destination %s", tc.name, got, tc.want)
+		}
+		if v.hop != 1 {
+			t.Errorf("%s: hop %d, want 1", tc.name, v.hop)
+		}
+		v.checkSums(t)
+		if tc.noCsum && binary.BigEndian.Uint16(v.l4[6:8]) != 0 {
+			t.Errorf("%s: udp checksum filled in", tc.name)
+		}
+		if m.Tier1Clones != uint64(tc.n-1) || m.Tier2Clones != 0 || m.Drops != ([DrMax]uint64{}) {
+			t.Errorf("%s: metrics %+v, want %d tier-1 clones and no drops", tc.name, m, tc.n-1)
+		}
+	}
+}
+
+// 2차 fan-out: cfg.local_node_id의 (node, topic) 집합만 보고, hop은 2가 된다.
+func TestProgHop1(t *testing.T) {
+	const node = 4
+	e := newProgEnv(t, Config{EgressIfindex: 1, LocalRouteIfindex: 1, LocalNodeID: node})
+	subs := []SubDest{
+		{Dest: netip.MustParseAddrPort("10.1.4.1:31001")},
+		{Ifindex: 1, Dest: netip.MustParseAddrPort("10.1.4.2:31002")},
+	}
+	err := e.dp.WriteGeneration(0, Tables{Nodes: map[uint32]map[uint32][]SubDest{
+		node:     {1: subs},
+		node + 1: {2: {{Dest: netip.MustParseAddrPort("10.1.5.1:31001")}}},
+	}})
+	if err != nil {
+		t.Fatalf("write generation: %v", err)
+	}
+
+	ret, out, m := e.run(t, udpPacket(netip.MustParseAddr("192.168.0.14"), 32000, 1, 1))
+	if ret != tcActNext {
+		t.Errorf("ret %d, want TC_ACT_UNSPEC", ret)
+	}
+	v := viewPacket(t, out)
+	if got := netip.AddrPortFrom(v.daddr, v.dport); got != subs[1].Dest {
+		t.Errorf("original skb sent to %s, want %s", got, subs[1].Dest)
+	}
+	if v.hop != 2 {
+		t.Errorf("hop %d, want 2", v.hop)
+	}
+	v.checkSums(t)
+	if m.Tier2Clones != 1 || m.Tier1Clones != 0 || m.Drops != ([DrMax]uint64{}) {
+		t.Errorf("metrics %+v, want 1 tier-2 clone", m)
+	}
+
+	// 다른 노드의 집합(topic 2)은 이 노드에서 보이지 않는다
+	pkt := udpPacket(netip.MustParseAddr("192.168.0.14"), 32000, 2, 1)
+	ret, out, m = e.run(t, pkt)
+	if ret != tcActNext || string(out) != string(pkt) || m.Drops[DrNoLocalset] != 1 {
+		t.Errorf("foreign local set: ret %d, changed %v, metrics %+v", ret, string(out) != string(pkt), m)
+	}
+}
+
+// direct 목적지(구독자 Pod)는 hop=2로 나가 받는 노드에서 no_localset 없이 통과한다.
+// 같은 집합의 노드 목적지는 그대로 hop=1.
+func TestProgDirectDest(t *testing.T) {
+	e := newProgEnv(t, Config{EgressIfindex: 1, LocalRouteIfindex: 1})
+	node := NodeDest{NodeID: 1, Dest: netip.MustParseAddrPort("192.168.0.11:32000")}
+	pod := NodeDest{NodeID: 2, Dest: netip.MustParseAddrPort("10.1.2.1:31002"), Direct: true}
+	err := e.dp.WriteGeneration(0, Tables{Topics: map[uint32][]NodeDest{
+		1: {node, pod},
+		2: {pod, node},
+		3: {pod},
+	}})
+	if err != nil {
+		t.Fatalf("write generation: %v", err)
+	}
+	for _, tc := range []struct {
+		topic uint32
+		want  NodeDest
+		hop   uint16
+	}{
+		{1, pod, 2},
+		{2, node, 1},
+		{3, pod, 2},
+	} {
+		ret, out, m := e.run(t, udpPacket(netip.MustParseAddr("10.0.0.1"), 32000, tc.topic, 0))
+		if ret != tcActNext {
+			t.Errorf("topic %d: ret %d, want TC_ACT_UNSPEC", tc.topic, ret)
+		}
+		v := viewPacket(t, out)
+		if got := netip.AddrPortFrom(v.daddr, v.dport); got != tc.want.Dest || v.hop != tc.hop {
+			t.Errorf("topic %d: original skb to %s hop %d, want %s hop %d", tc.topic, got, v.hop, tc.want.Dest, tc.hop)
+		}
+		v.checkSums(t)
+		if m.Drops != ([DrMax]uint64{}) {
+			t.Errorf("topic %d: drops %v", tc.topic, m.Drops)
+		}
+
+		// 받는 노드: hop=2 패킷은 로컬 집합 없이 그대로 통과
+		in := append([]byte(nil), out...)
+		ret, out, m = e.run(t, in)
+		if ret != tcActNext || (tc.hop == 2 && (string(out) != string(in) || m != Metrics{})) {
+			t.Errorf("topic %d at receiver: ret %d, metrics %+v", tc.topic, ret, m)
+		}
+	}
+}
+
+// hop >= 2는 이미 구독자에게 가는 패킷: 그대로 통과하고 아무것도 세지 않는다.
+func TestProgPassThrough(t *testing.T) {
+	e := newProgEnv(t, Config{EgressIfindex: 1, LocalRouteIfindex: 1})
+	err := e.dp.WriteGeneration(0, Tables{
+		Topics: map[uint32][]NodeDest{1: {{Dest: netip.MustParseAddrPort("192.168.0.10:32000")}}},
+		Nodes:  map[uint32]map[uint32][]SubDest{0: {1: {{Dest: netip.MustParseAddrPort("10.1.0.1:31001")}}}},
+	})
+	if err != nil {
+		t.Fatalf("write generation: %v", err)
+	}
+	for _, hop := range []uint16{2, 3, 0xffff} {
+		pkt := udpPacket(netip.MustParseAddr("10.1.0.1"), 31001, 1, hop)
+		ret, out, m := e.run(t, pkt)
+		if ret != tcActNext || string(out) != string(pkt) {
+			t.Errorf("hop %d: ret %d, packet changed %v", hop, ret, string(out) != string(pkt))
+		}
+		if m != (Metrics{}) {
+			t.Errorf("hop %d: metrics %+v", hop, m)
+		}
+	}
+}
+
+// 집합이 없거나 카운트가 0이면 패킷은 손대지 않고 no_nodeset/no_localset으로 센다.
+func TestProgMissingAndEmpty(t *testing.T) {
+	e := newProgEnv(t, Config{EgressIfindex: 1, LocalRouteIfindex: 1})
+	err := e.dp.WriteGeneration(0, Tables{
+		Topics: map[uint32][]NodeDest{2: {{Dest: netip.MustParseAddrPort("192.168.0.10:32000")}}},
+		Nodes:  map[uint32]map[uint32][]SubDest{0: {2: {{Dest: netip.MustParseAddrPort("10.1.0.1:31001")}}}},
+	})
+	if err != nil {
+		t.Fatalf("write generation: %v", err)
+	}
+	// inner 맵은 남기고 카운트만 0으로
+	zero, topic := uint32(0), uint32(2)
+	if err := e.dp.gens[0].topicCnt.Update(&topic, &zero, ebpf.UpdateAny); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.dp.gens[0].nodeCnt.Update(&LocalKey{NodeID: 0, TopicID: 2}, &zero, ebpf.UpdateAny); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		topic  uint32
+		hop    uint16
+		reason int
+	}{
+		{"no node set", 9, 0, DrNoNodeset},
+		{"zero fanout", 2, 0, DrNoNodeset},
+		{"no local set", 9, 1, DrNoLocalset},
+		{"zero local count", 2, 1, DrNoLocalset},
+		{"topic out of range", MaxTopics + 1, 0, DrNoNodeset},
+	} {
+		pkt := udpPacket(netip.MustParseAddr("192.168.0.10"), 32000, tc.topic, tc.hop)
+		ret, out, m := e.run(t, pkt)
+		if ret != tcActNext {
+			t.Errorf("%s: ret %d, want TC_ACT_UNSPEC", tc.name, ret)
+		}
+		if string(out) != string(pkt) {
+			t.Errorf("%s: packet modified", tc.name)
+		}
+		want, what := Metrics{Skipped: 1}, "skipped"
+		if tc.reason >= 0 {
+			want, what = Metrics{}, DropReasons[tc.reason]
+			want.Drops[tc.reason] = 1
+		}
+		if m != want {
+			t.Errorf("%s: metrics %+v, want one %s", tc.name, m, what)
+		}
+	}
+}
+
+// 잘린 프레임은 too_short로 센다. IP/UDP가 아닌 프레임은 드롭이 아니므로 skipped로만 센다.
+func TestProgShortAndNonUDP(t *testing.T) {
+	e := newProgEnv(t, Config{EgressIfindex: 1, LocalRouteIfindex: 1})
+	if err := e.dp.WriteGeneration(0, Tables{Topics: map[uint32][]NodeDest{
+		1: {{Dest: netip.MustParseAddrPort("192.168.0.10:32000")}},
+	}}); err != nil {
+		t.Fatalf("write generation: %v", err)
+	}
+	full := udpPacket(netip.MustParseAddr("10.0.0.1"), 32000, 1, 0)
+	full6 := udp6Packet(netip.MustParseAddr("fd00::1"), 32000, 1, 0)
+	tcp := udpPacket(netip.MustParseAddr("10.0.0.1"), 32000, 1, 0)
+	tcp[14+9] = 6
+	icmp := udpPacket(netip.MustParseAddr("10.0.0.1"), 32000, 1, 0)
+	icmp[14+9] = 1
+	tcp6 := udp6Packet(netip.MustParseAddr("fd00::1"), 32000, 1, 0)
+	tcp6[14+6] = 6
+	arp := make([]byte, 42)
+	binary.BigEndian.PutUint16(arp[12:14], 0x0806)
+	lldp := make([]byte, 60)
+	binary.BigEndian.PutUint16(lldp[12:14], 0x88cc)
+
+	for _, tc := range []struct {
+		name   string
+		pkt    []byte
+		reason int // -1: skipped
+	}{
+		{"eth only", full[:14], DrTooShort},
+		{"truncated ipv4 header", full[:14+12], DrTooShort},
+		{"no topic header", full[:14+20+8], DrTooShort},
+		{"partial topic header", full[:14+20+8+4], DrTooShort},
+		{"truncated ipv6 header", full6[:14+30], DrTooShort},
+		{"ipv6 no topic header", full6[:14+40+8+2], DrTooShort},
+		{"tcp", tcp, -1},
+		{"icmp", icmp, -1},
+		{"ipv6 tcp", tcp6, -1},
+		{"arp", arp, -1},
+		{"lldp", lldp, -1},
+	} {
+		ret, out, m := e.run(t, tc.pkt)
+		if ret != tcActNext {
+			t.Errorf("%s: ret %d, want TC_ACT_UNSPEC", tc.name, ret)
+		}
+		if string(out) != string(tc.pkt) {
+			t.Errorf("%s: packet modified", tc.name)
+		}
+		want, what := Metrics{Skipped: 1}, "skipped"
+		if tc.reason >= 0 {
+			want, what = Metrics{}, DropReasons[tc.reason]
+			want.Drops[tc.reason] = 1
+		}
+		if m != want {
+			t.Errorf("%s: metrics %+v, want one %s", tc.name, m, what)
+		}
+	}
+}
+
+// 마지막 목적지를 건너뛰면 원본은 이미 clone으로 보낸 목적지를 담고 있으므로 버린다 (TC_ACT_SHOT).
+func TestProgLastDestinationSkipped(t *testing.T) {
+	e := newProgEnv(t, Config{EgressIfindex: 1, LocalRouteIfindex: 1})
+	// Validate는 family 섞인 토픽을 거부하므로 집합을 직접 끼운다
+	setTopicNodes(t, e.coll, 0, 3,
+		NodeDest{NodeID: 0, Dest: netip.MustParseAddrPort("192.168.0.10:32000")},
+		NodeDest{NodeID: 1, Dest: netip.MustParseAddrPort("[fd00::11]:32000")},
+	)
+	ret, _, m := e.run(t, udpPacket(netip.MustParseAddr("10.0.0.1"), 32000, 3, 0))
+	if ret != tcActShot {
+		t.Errorf("ret %d, want TC_ACT_SHOT", ret)
+	}
+	if m.Tier1Clones != 1 || m.Drops[DrFamily] != 1 {
+		t.Errorf("metrics %+v, want 1 clone and 1 family_mismatch", m)
+	}
+}
+
+// 포트/헤더 필터: 맞지 않는 UDP는 짧든 길든 손대지 않고 skipped로만 센다. 맞는 패킷은 그대로 fan-out.
+func TestProgTrafficFilter(t *testing.T) {
+	e := newProgEnv(t, Config{
+		EgressIfindex: 1, LocalRouteIfindex: 1,
+		Tier1Port: 32000, Tier2PortMin: 31000, Tier2PortMax: 31999,
+		HdrMagic: 0x5000, HdrMagicMask: 0xf000,
+	})
+	node := NodeDest{Dest: netip.MustParseAddrPort("192.168.0.10:32000")}
+	if err := e.dp.WriteGeneration(0, Tables{Topics: map[uint32][]NodeDest{1: {node}}}); err != nil {
+		t.Fatalf("write generation: %v", err)
+	}
+	// flags: 상위 4비트가 매직
+	withFlags := func(pkt []byte, flags uint16) []byte {
+		l4 := pkt[14+20:]
+		if binary.BigEndian.Uint16(pkt[12:14]) == 0x86dd {
+			l4 = pkt[14+40:]
+		}
+		binary.BigEndian.PutUint16(l4[8+4:], flags)
+		binary.BigEndian.PutUint16(l4[6:8], 0)
+		binary.BigEndian.PutUint16(l4[6:8], udpChecksum(pkt[14:len(pkt)-len(l4)], l4))
+		return pkt
+	}
+	v4 := func(dport uint16, hop uint16, flags uint16) []byte {
+		return withFlags(udpPacket(netip.MustParseAddr("10.0.0.1"), dport, 1, hop), flags)
+	}
+	dns := udpPacket(netip.MustParseAddr("10.0.0.53"), 53, 1, 0)
+
+	for _, tc := range []struct {
+		name string
+		pkt  []byte
+		skip bool
+	}{
+		{"dns", dns, true},
+		{"dns without payload", dns[:14+20+8], true},
+		{"vxlan", v4(4789, 0, 0x5001), true},
+		{"below tier-2 range", v4(30999, 2, 0x5000), true},
+		{"above tier-2 range", v4(32001, 0, 0x5000), true},
+		{"tier-1 port, wrong magic", v4(32000, 0, 0x4000), true},
+		{"tier-1 port, no magic", v4(32000, 0, 0), true},
+		{"ipv6 other port", withFlags(udp6Packet(netip.MustParseAddr("fd00::53"), 53, 1, 0), 0x5000), true},
+		{"tier-2 port", v4(31500, 2, 0x5000), false},
+		{"tier-1 port", v4(32000, 0, 0x5abc), false},
+	} {
+		in := append([]byte(nil), tc.pkt...)
+		ret, out, m := e.run(t, tc.pkt)
+		if ret != tcActNext {
+			t.Errorf("%s: ret %d, want TC_ACT_UNSPEC", tc.name, ret)
+		}
+		if !tc.skip {
+			if m.Skipped != 0 {
+				t.Errorf("%s: skipped %d", tc.name, m.Skipped)
+			}
+			continue
+		}
+		if string(out) != string(in) {
+			t.Errorf("%s: packet modified", tc.name)
+		}
+		if want := (Metrics{Skipped: 1}); m != want {
+			t.Errorf("%s: metrics %+v, want only skipped=1", tc.name, m)
+		}
+	}
+
+	// 맞는 hop 0 패킷은 필터가 없을 때와 같이 재작성된다
+	_, out, m := e.run(t, v4(32000, 0, 0x5000))
+	if v := viewPacket(t, out); v.daddr != node.Dest.Addr() || v.hop != 1 {
+		t.Errorf("matching packet: daddr %s hop %d", v.daddr, v.hop)
+	}
+	if m.Skipped != 0 || m.Drops != ([DrMax]uint64{}) {
+		t.Errorf("matching packet: metrics %+v", m)
+	}
+}
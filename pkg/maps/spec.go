@@ -0,0 +1,83 @@
+package maps
+
+// 오브젝트(.o)와 이 패키지의 레이아웃 대조. 낡은 오브젝트는 맵 값 크기가 달라
+// 로드는 되더라도 값을 잘못 읽고 쓰므로, loader와 테스트가 로드 전에 거른다.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/cilium/ebpf"
+)
+
+type mapLayout struct {
+	typ        ebpf.MapType
+	key, value uint32
+	maxEntries uint32
+	inner      *mapLayout // map-in-map의 inner 템플릿
+}
+
+func expectedLayout() map[string]mapLayout {
+	destSet := func(n uint32) *mapLayout { return &mapLayout{typ: ebpf.Array, key: 4, value: DestSize, maxEntries: n} }
+	localKey := uint32(binary.Size(LocalKey{}))
+	ms := map[string]mapLayout{
+		"m_cfg":     {typ: ebpf.Array, key: 4, value: uint32(binary.Size(Config{})), maxEntries: 1},
+		"m_metrics": {typ: ebpf.PerCPUArray, key: 4, value: uint32(binary.Size(Metrics{})), maxEntries: 1},
+	}
+	for gen := 0; gen < 2; gen++ {
+		n := genNames(gen)
+		ms[n[0]] = mapLayout{typ: ebpf.ArrayOfMaps, key: 4, value: 4, maxEntries: MaxTopics, inner: destSet(MaxFanout)}
+		ms[n[1]] = mapLayout{typ: ebpf.Array, key: 4, value: 4, maxEntries: MaxTopics}
+		ms[n[2]] = mapLayout{typ: ebpf.HashOfMaps, key: localKey, value: 4, maxEntries: MaxLocalSets, inner: destSet(MaxLocalSub)}
+		ms[n[3]] = mapLayout{typ: ebpf.Hash, key: localKey, value: 4, maxEntries: MaxLocalSets}
+	}
+	return ms
+}
+
+func (l mapLayout) check(name string, ms *ebpf.MapSpec) error {
+	var errs []error
+	if ms.Type != l.typ {
+		errs = append(errs, fmt.Errorf("%s: type %s, want %s", name, ms.Type, l.typ))
+	}
+	if ms.KeySize != l.key || ms.ValueSize != l.value {
+		errs = append(errs, fmt.Errorf("%s: key/value %d/%d bytes, want %d/%d", name, ms.KeySize, ms.ValueSize, l.key, l.value))
+	}
+	if ms.MaxEntries != l.maxEntries {
+		errs = append(errs, fmt.Errorf("%s: max_entries %d, want %d", name, ms.MaxEntries, l.maxEntries))
+	}
+	if l.inner != nil {
+		if ms.InnerMap == nil {
+			errs = append(errs, fmt.Errorf("%s: no inner map definition", name))
+		} else {
+			errs = append(errs, l.inner.check(name+" inner", ms.InnerMap))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckSpec: spec의 맵이 commons.h 레이아웃(Config, Metrics, NodeDest/SubDest, LocalKey, 상수 바운드)과
+// 같은지 확인한다. 다르면 오브젝트를 다시 빌드해야 한다 (make -C bpf).
+func CheckSpec(spec *ebpf.CollectionSpec) error {
+	want := expectedLayout()
+	names := make([]string, 0, len(want))
+	for name := range want {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		l := want[name]
+		ms, ok := spec.Maps[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: missing from object", name))
+			continue
+		}
+		errs = append(errs, l.check(name, ms))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("object layout mismatch: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package maps
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+)
+
+func (l mapLayout) spec() *ebpf.MapSpec {
+	ms := &ebpf.MapSpec{Type: l.typ, KeySize: l.key, ValueSize: l.value, MaxEntries: l.maxEntries}
+	if l.inner != nil {
+		ms.InnerMap = l.inner.spec()
+	}
+	return ms
+}
+
+func currentSpec() *ebpf.CollectionSpec {
+	spec := &ebpf.CollectionSpec{Maps: map[string]*ebpf.MapSpec{}}
+	for name, l := range expectedLayout() {
+		spec.Maps[name] = l.spec()
+	}
+	return spec
+}
+
+func TestCheckSpec(t *testing.T) {
+	if err := CheckSpec(currentSpec()); err != nil {
+		t.Fatalf("current layout rejected: %v", err)
+	}
+	for _, tc := range []struct {
+		name   string
+		mutate func(*ebpf.CollectionSpec)
+		want   string
+	}{
+		// 필터 필드 이전의 cfg_rec (20바이트)
+		{"old cfg_rec", func(s *ebpf.CollectionSpec) { s.Maps["m_cfg"].ValueSize = 20 }, "m_cfg: key/value 4/20"},
+		{"old metrics", func(s *ebpf.CollectionSpec) { s.Maps["m_metrics"].ValueSize = 88 }, "m_metrics"},
+		// IPv4 전용 node_dest (12바이트)
+		{"old node_dest", func(s *ebpf.CollectionSpec) { s.Maps["topic_to_node_set_gen1"].InnerMap.ValueSize = 12 }, "topic_to_node_set_gen1 inner"},
+		{"no inner template", func(s *ebpf.CollectionSpec) { s.Maps["node_to_local_sub_gen0"].InnerMap = nil }, "no inner map definition"},
+		// 노드 단위 로컬 집합 (u32 키)
+		{"node-only local sets", func(s *ebpf.CollectionSpec) { s.Maps["node_local_cnt_gen0"].KeySize = 4 }, "node_local_cnt_gen0"},
+		{"missing map", func(s *ebpf.CollectionSpec) { delete(s.Maps, "node_local_cnt_gen1") }, "node_local_cnt_gen1: missing"},
+	} {
+		spec := currentSpec()
+		tc.mutate(spec)
+		err := CheckSpec(spec)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: %v, want error mentioning %q", tc.name, err, tc.want)
+		}
+	}
+}
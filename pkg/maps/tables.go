@@ -0,0 +1,535 @@
+package maps
+
+// 세대별 topic/node 테이블 프로그래밍.
+// Tables는 한 세대 분량의 desired state이며 controller가 계산하고 loader가 자기 노드의 맵에 적용한다.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"path/filepath"
+
+	"github.com/cilium/ebpf"
+)
+
+// commons.h 상수 바운드
+const (
+	MaxTopics   = 4096
+	MaxNodes    = 256
+	MaxFanout   = 256
+	MaxLocalSub = 512
+	// MaxLocalSets: (node, topic) 로컬 집합 수 (MAX_LOCAL_SETS)
+	MaxLocalSets = 16384
+)
+
+// Tables: topic_id → node 목록, node_id → topic_id → 그 노드에서 그 토픽을 구독하는 로컬 구독자 목록
+type Tables struct {
+	Topics map[uint32][]NodeDest           `json:"topics"`
+	Nodes  map[uint32]map[uint32][]SubDest `json:"nodes"`
+}
+
+// Version: 테이블 내용 해시 (encoding/json은 map 키를 정렬하므로 같은 내용은 같은 값).
+// 목적지 슬라이스 순서는 데이터패스 동작의 일부(카운트로 자를 때 남는 앞쪽, 원본 skb를 받는 마지막)이므로 해시에 들어간다.
+// controller가 desired version으로, psbenchctl이 수동 적용 version으로 쓴다.
+func (t Tables) Version() string {
+	b, _ := json.Marshal(t)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// LocalKey: struct local_key
+type LocalKey struct {
+	NodeID  uint32
+	TopicID uint32
+}
+
+type genMaps struct {
+	topicNodes Map // topic_to_node_set_genN
+	topicCnt   Map // topic_fanout_cnt_genN
+	nodeSubs   Map // node_to_local_sub_genN ((node, topic) 키 HASH_OF_MAPS)
+	nodeCnt    Map // node_local_cnt_genN ((node, topic) 키 HASH)
+}
+
+// innerMap: outer 맵에 끼우는 inner array. outer가 참조를 잡은 뒤 닫는다.
+type innerMap interface {
+	Map
+	Close() error
+}
+
+// Datapath: 한 노드의 데이터패스 맵 묶음 (m_cfg + gen0/gen1 테이블)
+type Datapath struct {
+	Cfg      Map
+	gens     [2]genMaps
+	newInner func(maxEntries uint32) (innerMap, error)
+	// lookupInner: outer[key]에 끼워진 inner 맵 (ReadGeneration용)
+	lookupInner func(outer Map, key any) (innerMap, error)
+	closers     []io.Closer // OpenPinned로 연 경우 Close 책임
+}
+
+func newInnerArray(maxEntries uint32) (innerMap, error) {
+	m, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.Array,
+		KeySize:    4,
+		ValueSize:  DestSize,
+		MaxEntries: maxEntries,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func lookupInnerMap(outer Map, key any) (innerMap, error) {
+	var m *ebpf.Map
+	if err := outer.Lookup(key, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func genNames(gen int) [4]string {
+	return [4]string{
+		fmt.Sprintf("topic_to_node_set_gen%d", gen),
+		fmt.Sprintf("topic_fanout_cnt_gen%d", gen),
+		fmt.Sprintf("node_to_local_sub_gen%d", gen),
+		fmt.Sprintf("node_local_cnt_gen%d", gen),
+	}
+}
+
+// New: 로드된 컬렉션의 맵으로 구성 (맵 수명은 호출자 소유).
+func New(ms map[string]*ebpf.Map) (*Datapath, error) {
+	get := func(name string) (*ebpf.Map, error) {
+		m, ok := ms[name]
+		if !ok {
+			return nil, fmt.Errorf("map %s missing from object", name)
+		}
+		return m, nil
+	}
+	d := &Datapath{newInner: newInnerArray, lookupInner: lookupInnerMap}
+	cfg, err := get("m_cfg")
+	if err != nil {
+		return nil, err
+	}
+	d.Cfg = cfg
+	for gen := range d.gens {
+		var m [4]*ebpf.Map
+		for i, name := range genNames(gen) {
+			if m[i], err = get(name); err != nil {
+				return nil, err
+			}
+		}
+		d.gens[gen] = genMaps{m[0], m[1], m[2], m[3]}
+	}
+	return d, nil
+}
+
+// OpenPinned: bpffs 핀(root)에서 맵을 연다.
+func OpenPinned(root string) (*Datapath, error) {
+	ms := map[string]*ebpf.Map{}
+	names := []string{"m_cfg"}
+	for gen := 0; gen < 2; gen++ {
+		n := genNames(gen)
+		names = append(names, n[:]...)
+	}
+	for _, name := range names {
+		m, err := ebpf.LoadPinnedMap(filepath.Join(root, name), nil)
+		if err != nil {
+			for _, o := range ms {
+				o.Close()
+			}
+			return nil, fmt.Errorf("open map %s: %w", name, err)
+		}
+		ms[name] = m
+	}
+	d, err := New(ms)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range ms {
+		d.closers = append(d.closers, m)
+	}
+	return d, nil
+}
+
+func (d *Datapath) Close() {
+	for _, c := range d.closers {
+		c.Close()
+	}
+	d.closers = nil
+}
+
+func (d *Datapath) ActiveGen() (uint32, error) {
+	c, err := ReadConfig(d.Cfg)
+	return c.ActiveGen & 1, err
+}
+
+// SetActiveGen, Config, UpdateConfig: m_cfg 접근 (config.go의 규약 그대로)
+func (d *Datapath) SetActiveGen(gen uint32) error { return SetActiveGen(d.Cfg, gen) }
+
+func (d *Datapath) Config() (Config, error) { return ReadConfig(d.Cfg) }
+
+func (d *Datapath) UpdateConfig(fn func(*Config)) (Config, error) { return UpdateConfig(d.Cfg, fn) }
+
+// Validate: 데이터패스 한도(commons.h)와 주소 형식 검사. 맵을 건드리기 전에 전체를 본다.
+// 한 토픽의 목적지(1차 노드 집합과 모든 노드의 로컬 집합)는 주소 family가 같아야 한다.
+// 데이터패스는 패킷과 family가 다른 목적지를 건너뛰기만 하므로(DR_FAMILY) 섞인 토픽은 일부에만 도달한다.
+func (t Tables) Validate() error {
+	family := map[uint32]uint8{} // topic → 처음 본 목적지의 family
+	sameFamily := func(tID uint32, ap netip.AddrPort) error {
+		fam, err := destFamily(ap)
+		if err != nil {
+			return err
+		}
+		if f, ok := family[tID]; ok && f != fam {
+			return fmt.Errorf("%s is IPv%d but topic %d destinations are IPv%d", ap.Addr(), fam, tID, f)
+		}
+		family[tID] = fam
+		return nil
+	}
+	for tID, dests := range t.Topics {
+		if tID >= MaxTopics {
+			return invalidf("topic %d out of range (max %d)", tID, MaxTopics-1)
+		}
+		if len(dests) > MaxFanout {
+			return invalidf("topic %d: %d nodes exceeds MAX_FANOUT=%d", tID, len(dests), MaxFanout)
+		}
+		for _, nd := range dests {
+			if err := sameFamily(tID, nd.Dest); err != nil {
+				return invalidf("topic %d node %d: %v", tID, nd.NodeID, err)
+			}
+		}
+	}
+	var nLocal int
+	for nID, byTopic := range t.Nodes {
+		if nID >= MaxNodes {
+			return invalidf("node %d out of range (max %d)", nID, MaxNodes-1)
+		}
+		nLocal += len(byTopic)
+		for tID, subs := range byTopic {
+			if tID >= MaxTopics {
+				return invalidf("node %d: topic %d out of range (max %d)", nID, tID, MaxTopics-1)
+			}
+			if len(subs) > MaxLocalSub {
+				return invalidf("node %d topic %d: %d subscribers exceeds MAX_LOCAL_SUB=%d", nID, tID, len(subs), MaxLocalSub)
+			}
+			for i, sd := range subs {
+				if err := sameFamily(tID, sd.Dest); err != nil {
+					return invalidf("node %d topic %d sub %d: %v", nID, tID, i, err)
+				}
+			}
+		}
+	}
+	if nLocal > MaxLocalSets {
+		return invalidf("%d local sets exceeds MAX_LOCAL_SETS=%d", nLocal, MaxLocalSets)
+	}
+	return nil
+}
+
+// WriteGeneration: gen 세대를 t로 교체. t에 없는 topic은 카운트 0 + outer 슬롯 삭제,
+// t에 없는 (node, topic) 로컬 집합은 해시 엔트리 자체를 삭제한다.
+// 한도 위반은 Validate로 먼저 걸러(ErrInvalid) 맵을 건드리지 않는다.
+// 도중 실패는 *WriteError로 돌려주며 그 세대는 일부만 쓰인 상태다. 전체를 다시 쓰면 복구되므로
+// Transient 오류는 같은 t로 재시도하면 되고, 그 전까지 이 세대로 플립하지 않는 것은 호출자 책임.
+// 활성 세대에 쓰지 않는 것도 호출자 책임.
+func (d *Datapath) WriteGeneration(gen uint32, t Tables) error {
+	if gen > 1 {
+		return fmt.Errorf("invalid generation %d", gen)
+	}
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	g := d.gens[gen]
+
+	wantTopics := map[uint32]bool{}
+	for tID, dests := range t.Topics {
+		if err := writeSet(d.newInner, g.topicNodes, g.topicCnt, tID, MaxFanout, dests); err != nil {
+			return &WriteError{Gen: gen, Op: "topic", Topic: tID, Err: err}
+		}
+		wantTopics[tID] = true
+	}
+	if err := clearStale(g.topicNodes, g.topicCnt, wantTopics); err != nil {
+		return &WriteError{Gen: gen, Op: "clear_topics", Err: err}
+	}
+
+	wantLocal := map[LocalKey]bool{}
+	for nID, byTopic := range t.Nodes {
+		for tID, subs := range byTopic {
+			k := LocalKey{NodeID: nID, TopicID: tID}
+			if err := writeSet(d.newInner, g.nodeSubs, g.nodeCnt, k, MaxLocalSub, subs); err != nil {
+				return &WriteError{Gen: gen, Op: "local", Node: nID, Topic: tID, Err: err}
+			}
+			wantLocal[k] = true
+		}
+	}
+	if err := deleteStale(g.nodeSubs, g.nodeCnt, wantLocal); err != nil {
+		return &WriteError{Gen: gen, Op: "clear_local", Err: err}
+	}
+	return nil
+}
+
+// ReadGeneration: gen 세대에 프로그래밍된 내용을 Tables로 되읽는다. 카운트 0인 슬롯은 없는 것으로 본다.
+func (d *Datapath) ReadGeneration(gen uint32) (Tables, error) {
+	t := Tables{Topics: map[uint32][]NodeDest{}, Nodes: map[uint32]map[uint32][]SubDest{}}
+	c, err := d.Counts(gen)
+	if err != nil {
+		return t, err
+	}
+	for tID := range c.Topics {
+		if t.Topics[tID], err = d.TopicNodeSet(gen, tID); err != nil {
+			return t, err
+		}
+	}
+	for k := range c.Local {
+		subs, err := d.NodeLocalSubs(gen, k)
+		if err != nil {
+			return t, err
+		}
+		if t.Nodes[k.NodeID] == nil {
+			t.Nodes[k.NodeID] = map[uint32][]SubDest{}
+		}
+		t.Nodes[k.NodeID][k.TopicID] = subs
+	}
+	return t, nil
+}
+
+// SetTopicCount: gen 세대의 topic 카운트만 바꾼다 (집합은 그대로, 수동 실험용 psbenchctl count).
+// 집합보다 작으면 데이터패스가 앞쪽 n개에만 보내고, 크면 남는 빈 슬롯을 DR_FAMILY로 센다.
+// 다음 WriteGeneration이 카운트를 집합 크기로 되돌린다.
+func (d *Datapath) SetTopicCount(gen, topic, n uint32) error {
+	if gen > 1 {
+		return fmt.Errorf("invalid generation %d", gen)
+	}
+	if topic >= MaxTopics {
+		return invalidf("topic %d out of range (max %d)", topic, MaxTopics-1)
+	}
+	if n > MaxFanout {
+		return invalidf("topic %d: count %d exceeds MAX_FANOUT=%d", topic, n, MaxFanout)
+	}
+	if err := d.gens[gen].topicCnt.Update(&topic, &n, ebpf.UpdateAny); err != nil {
+		return fmt.Errorf("gen %d: topic %d count: %w", gen, topic, err)
+	}
+	return nil
+}
+
+// SetLocalCount: gen 세대의 (node, topic) 로컬 카운트만 바꾼다. 0도 엔트리로 남긴다(집합 없음과 다름).
+func (d *Datapath) SetLocalCount(gen uint32, k LocalKey, n uint32) error {
+	if gen > 1 {
+		return fmt.Errorf("invalid generation %d", gen)
+	}
+	if k.NodeID >= MaxNodes {
+		return invalidf("node %d out of range (max %d)", k.NodeID, MaxNodes-1)
+	}
+	if k.TopicID >= MaxTopics {
+		return invalidf("node %d: topic %d out of range (max %d)", k.NodeID, k.TopicID, MaxTopics-1)
+	}
+	if n > MaxLocalSub {
+		return invalidf("node %d topic %d: count %d exceeds MAX_LOCAL_SUB=%d", k.NodeID, k.TopicID, n, MaxLocalSub)
+	}
+	if err := d.gens[gen].nodeCnt.Update(&k, &n, ebpf.UpdateAny); err != nil {
+		return fmt.Errorf("gen %d: node %d topic %d count: %w", gen, k.NodeID, k.TopicID, err)
+	}
+	return nil
+}
+
+// Counts: 한 세대의 카운트 맵 중 0이 아닌 항목 (topic_fanout_cnt, node_local_cnt)
+type Counts struct {
+	Topics map[uint32]uint32
+	Local  map[LocalKey]uint32
+}
+
+func (d *Datapath) Counts(gen uint32) (Counts, error) {
+	c := Counts{Topics: map[uint32]uint32{}, Local: map[LocalKey]uint32{}}
+	if gen > 1 {
+		return c, fmt.Errorf("invalid generation %d", gen)
+	}
+	g := d.gens[gen]
+	if err := readCounts(g.topicCnt, c.Topics); err != nil {
+		return c, fmt.Errorf("topic counts: %w", err)
+	}
+	if err := readCounts(g.nodeCnt, c.Local); err != nil {
+		return c, fmt.Errorf("local counts: %w", err)
+	}
+	return c, nil
+}
+
+func readCounts[K comparable](m Map, out map[K]uint32) error {
+	keys, err := mapKeys[K](m)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		var n uint32
+		if err := m.Lookup(&k, &n); err != nil {
+			if errors.Is(err, ebpf.ErrKeyNotExist) {
+				continue // 읽는 사이 지워짐
+			}
+			return err
+		}
+		if n > 0 {
+			out[k] = n
+		}
+	}
+	return nil
+}
+
+// TopicNodeSet: gen 세대의 topic → node 목록. 집합이 없으면(카운트 0) nil.
+func (d *Datapath) TopicNodeSet(gen, topic uint32) ([]NodeDest, error) {
+	if gen > 1 {
+		return nil, fmt.Errorf("invalid generation %d", gen)
+	}
+	g := d.gens[gen]
+	dests, err := readSet[NodeDest](d.lookupInner, g.topicNodes, g.topicCnt, topic)
+	if err != nil || len(dests) == 0 {
+		if err != nil {
+			err = fmt.Errorf("topic %d: %w", topic, err)
+		}
+		return nil, err
+	}
+	return dests, nil
+}
+
+// NodeLocalSubs: gen 세대의 (node, topic) → 로컬 구독자 목록. 집합이 없으면 nil.
+func (d *Datapath) NodeLocalSubs(gen uint32, k LocalKey) ([]SubDest, error) {
+	if gen > 1 {
+		return nil, fmt.Errorf("invalid generation %d", gen)
+	}
+	g := d.gens[gen]
+	subs, err := readSet[SubDest](d.lookupInner, g.nodeSubs, g.nodeCnt, k)
+	if errors.Is(err, ebpf.ErrKeyNotExist) {
+		return nil, nil // HASH: 키 없음 = 집합 없음
+	}
+	if err != nil || len(subs) == 0 {
+		if err != nil {
+			err = fmt.Errorf("node %d topic %d: %w", k.NodeID, k.TopicID, err)
+		}
+		return nil, err
+	}
+	return subs, nil
+}
+
+// readSet: cnt[key]개 만큼 outer[key]의 inner 원소를 읽는다.
+// 카운트만 따로 쓴 경우(SetTopicCount, SetLocalCount) 카운트가 집합보다 클 수 있다.
+// 데이터패스는 빈 슬롯을 family 불일치로 건너뛰므로 실제로 쓰인 원소까지만 돌려준다.
+func readSet[T, K any](lookupInner func(Map, any) (innerMap, error), outer, cnt Map, key K) ([]T, error) {
+	var n uint32
+	if err := cnt.Lookup(&key, &n); err != nil {
+		return nil, fmt.Errorf("count lookup: %w", err)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	inner, err := lookupInner(outer, &key)
+	if errors.Is(err, ebpf.ErrKeyNotExist) {
+		return nil, nil // 집합 없이 카운트만 있음
+	}
+	if err != nil {
+		return nil, fmt.Errorf("outer lookup: %w", err)
+	}
+	defer inner.Close()
+	out := make([]T, n)
+	for i := range out {
+		k := uint32(i)
+		err := inner.Lookup(&k, &out[i])
+		if errors.Is(err, errEmptyDest) {
+			return out[:i], nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("inner lookup %d: %w", i, err)
+		}
+	}
+	return out, nil
+}
+
+// writeSet: inner array를 새로 만들어 채우고 outer[key]에 끼운 뒤 카운트 기록.
+// inner는 outer가 참조를 잡으므로 여기서 닫아도 된다(핀 불필요).
+func writeSet[K, T any](newInner func(uint32) (innerMap, error), outer, cnt Map, key K, max uint32, vals []T) error {
+	inner, err := newInner(max)
+	if err != nil {
+		return fmt.Errorf("inner map: %w", err)
+	}
+	defer inner.Close()
+	for i := range vals {
+		k := uint32(i)
+		if err := inner.Update(&k, &vals[i], ebpf.UpdateAny); err != nil {
+			return fmt.Errorf("inner update: %w", err)
+		}
+	}
+	if err := outer.Update(&key, inner, ebpf.UpdateAny); err != nil {
+		return fmt.Errorf("outer update: %w", err)
+	}
+	n := uint32(len(vals))
+	if err := cnt.Update(&key, &n, ebpf.UpdateAny); err != nil {
+		return fmt.Errorf("count update: %w", err)
+	}
+	return nil
+}
+
+// mapKeys: NextKey로 키 전체를 모은다 (수정은 다 모은 뒤에).
+func mapKeys[K any](m Map) ([]K, error) {
+	var (
+		out []K
+		cur any // nil이면 첫 키
+	)
+	for {
+		var next K
+		err := m.NextKey(cur, &next)
+		if errors.Is(err, ebpf.ErrKeyNotExist) {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, next)
+		cur = &next
+	}
+}
+
+// clearStale: 배열 키 맵용. want에 없는 슬롯은 카운트 0 + outer 엔트리 삭제.
+func clearStale(outer, cnt Map, want map[uint32]bool) error {
+	keys, err := mapKeys[uint32](cnt)
+	if err != nil {
+		return err
+	}
+	zero := uint32(0)
+	for _, k := range keys {
+		if want[k] {
+			continue
+		}
+		var v uint32
+		if err := cnt.Lookup(&k, &v); err != nil || v == 0 {
+			continue
+		}
+		if err := cnt.Update(&k, &zero, ebpf.UpdateAny); err != nil {
+			return err
+		}
+		if err := outer.Delete(&k); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteStale: 해시 키 맵용. want에 없는 키는 카운트와 outer 엔트리를 모두 지운다.
+// 카운트를 먼저 지워 데이터패스가 빈 집합 대신 "집합 없음"으로 보게 한다.
+func deleteStale(outer, cnt Map, want map[LocalKey]bool) error {
+	keys, err := mapKeys[LocalKey](cnt)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if want[k] {
+			continue
+		}
+		if err := cnt.Delete(&k); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return err
+		}
+		if err := outer.Delete(&k); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package maps
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/cilium/ebpf"
+)
+
+// 같은 노드의 topic 2 구독자는 topic 1 패킷(hop=1)을 받으면 안 된다.
+func TestLocalSetsIsolatedByTopic(t *testing.T) {
+	coll := loadObject(t)
+	dp, err := New(coll.Maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog := coll.Programs["tc_hier_pubsub"]
+
+	const node = 3
+	key := uint32(0)
+	if err := dp.Cfg.Update(&key, &Config{EgressIfindex: 1, LocalRouteIfindex: 1, LocalNodeID: node}, ebpf.UpdateAny); err != nil {
+		t.Fatalf("cfg init: %v", err)
+	}
+	sub1, sub2 := netip.MustParseAddr("10.1.0.1"), netip.MustParseAddr("10.1.0.2")
+	err = dp.WriteGeneration(0, Tables{Nodes: map[uint32]map[uint32][]SubDest{
+		node: {
+			1: {{Dest: netip.AddrPortFrom(sub1, 31001)}},
+			2: {{Dest: netip.AddrPortFrom(sub2, 31002)}},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("write generation: %v", err)
+	}
+
+	nodeAddr := netip.MustParseAddr("192.168.0.10")
+	for _, tc := range []struct {
+		topic uint32
+		want  netip.Addr
+	}{
+		{1, sub1},
+		{2, sub2},
+		{3, nodeAddr}, // 로컬 집합 없음: 그대로 통과
+	} {
+		_, out := runPacket(t, prog, udpPacket(nodeAddr, 32000, tc.topic, 1))
+		got, _ := netip.AddrFromSlice(out[14+16 : 14+20])
+		if got != tc.want {
+			t.Errorf("topic %d: daddr = %s, want %s", tc.topic, got, tc.want)
+		}
+	}
+
+	// topic 2 집합을 빼면 해시 엔트리까지 지워져야 한다
+	err = dp.WriteGeneration(0, Tables{Nodes: map[uint32]map[uint32][]SubDest{
+		node: {1: {{Dest: netip.AddrPortFrom(sub1, 31001)}}},
+	}})
+	if err != nil {
+		t.Fatalf("rewrite generation: %v", err)
+	}
+	var n uint32
+	if err := dp.gens[0].nodeCnt.Lookup(&LocalKey{NodeID: node, TopicID: 2}, &n); err == nil {
+		t.Errorf("stale (node %d, topic 2) count still present: %d", node, n)
+	}
+}
+
+// IPv6 토픽: 주소 16바이트를 바꾸고 UDP 체크섬(의사 헤더 포함)을 유지한다.
+// 같은 토픽으로 들어온 IPv4 패킷은 바꿀 수 없으므로 그대로 두고 family_mismatch로 센다.
+func TestIPv6Destinations(t *testing.T) {
+	coll := loadObject(t)
+	dp, err := New(coll.Maps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog := coll.Programs["tc_hier_pubsub"]
+
+	key := uint32(0)
+	if err := dp.Cfg.Update(&key, &Config{EgressIfindex: 1, LocalRouteIfindex: 1}, ebpf.UpdateAny); err != nil {
+		t.Fatalf("cfg init: %v", err)
+	}
+	node := netip.MustParseAddr("fd00::11")
+	err = dp.WriteGeneration(0, Tables{Topics: map[uint32][]NodeDest{
+		5: {{NodeID: 1, Dest: netip.AddrPortFrom(node, 32000)}},
+	}})
+	if err != nil {
+		t.Fatalf("write generation: %v", err)
+	}
+
+	_, out := runPacket(t, prog, udp6Packet(netip.MustParseAddr("fd00::10"), 32000, 5, 0))
+	got, _ := netip.AddrFromSlice(out[14+24 : 14+40])
+	if got != node {
+		t.Errorf("daddr = %s, want %s", got, node)
+	}
+	if c := udpChecksum(out[14:54], out[54:]); c != 0 {
+		t.Errorf("udp checksum invalid after rewrite (residue %#04x)", c)
+	}
+
+	v4 := netip.MustParseAddr("192.168.0.10")
+	_, out = runPacket(t, prog, udpPacket(v4, 32000, 5, 0))
+	if got, _ := netip.AddrFromSlice(out[14+16 : 14+20]); got != v4 {
+		t.Errorf("IPv4 packet on IPv6 topic rewritten to %s", got)
+	}
+	m, err := ReadMetrics(coll.Maps["m_metrics"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Drops[DrFamily] != 1 {
+		t.Errorf("family_mismatch = %d, want 1", m.Drops[DrFamily])
+	}
+}
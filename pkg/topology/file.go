@@ -0,0 +1,117 @@
+package topology
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// File: 정적 YAML/JSON 토폴로지 파일 (Spec). Run이 mtime/크기를 폴링해 바뀌면 다시 읽고 Changed로 알린다.
+// 제자리에서 덮어쓰는 편집기는 잠깐 빈 파일이나 쓰다 만 파일을 보이므로, 정상 내용이 있는 동안에는
+// mtime/크기가 두 번 연속 폴링에서 같아야 다시 읽는다. 빈 파일이나 잘못된 내용이면 로그를 남기고
+// 마지막으로 읽은 정상 내용을 계속 쓴다. 처음부터 읽을 수 없으면 Snapshot이 실패한다.
+type File struct {
+	path     string
+	interval time.Duration
+	changed  chan struct{}
+
+	mu   sync.Mutex
+	read stamp // 마지막으로 읽은 내용
+	seen stamp // 직전 폴링에서 본 값
+	spec *Spec // 마지막 정상 내용
+	err  error // 마지막 읽기 실패 (같은 오류를 반복해 로그하지 않기 위해)
+}
+
+type stamp struct {
+	mod  time.Time
+	size int64
+}
+
+func (a stamp) same(b stamp) bool { return a.mod.Equal(b.mod) && a.size == b.size }
+
+func NewFile(path string, interval time.Duration) *File {
+	return &File{path: path, interval: interval, changed: make(chan struct{}, 1)}
+}
+
+func (f *File) Name() string              { return "file:" + f.path }
+func (f *File) Changed() <-chan struct{} { return f.changed }
+
+func (f *File) Snapshot(context.Context) (*Snapshot, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.poll()
+	if f.spec == nil { return nil, &Error{"read_file", f.err} }
+	return f.spec.Snapshot(), nil
+}
+
+// ReadSpec: 토폴로지 파일 한 번 읽기 (YAML/JSON, 모르는 필드는 오류)
+func ReadSpec(path string) (*Spec, error) {
+	b, err := os.ReadFile(path)
+	if err != nil { return nil, err }
+	spec, err := ParseSpec(b)
+	if err != nil { return nil, fmt.Errorf("%s: %w", path, err) }
+	return spec, nil
+}
+
+func ParseSpec(b []byte) (*Spec, error) {
+	var spec Spec
+	if err := yaml.UnmarshalStrict(b, &spec); err != nil { return nil, err }
+	if err := spec.Validate(); err != nil { return nil, err }
+	return &spec, nil
+}
+
+// Run: ctx가 끝날 때까지 interval마다 폴링
+func (f *File) Run(ctx context.Context) {
+	t := time.NewTicker(f.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		f.mu.Lock()
+		changed := f.poll()
+		f.mu.Unlock()
+		if changed { notify(f.changed) }
+	}
+}
+
+// poll: 파일이 바뀌었으면 다시 읽는다. 새 정상 내용을 읽었으면 true. f.mu를 잡고 호출.
+func (f *File) poll() bool {
+	st, err := os.Stat(f.path)
+	if err != nil { return f.fail(err) }
+	cur := stamp{st.ModTime(), st.Size()}
+	if f.spec != nil && cur.same(f.read) { return false }
+	// 쓰는 중일 수 있다: 다음 폴링에서도 같으면 읽는다 (정상 내용이 없는 처음에는 바로)
+	prev := f.seen
+	f.seen = cur
+	if f.spec != nil && !cur.same(prev) { return false }
+	b, err := os.ReadFile(f.path)
+	if err != nil { return f.fail(err) }
+	// 읽기 실패한 내용도 다시 읽지 않도록 먼저 기록한다
+	f.read = cur
+	// 빈 YAML은 노드도 구독자도 없는 정상 Spec으로 읽히므로 따로 거부한다 (덮어쓰기 도중 잘린 파일)
+	if len(bytes.TrimSpace(b)) == 0 { return f.fail(errors.New("empty file")) }
+	spec, err := ParseSpec(b)
+	if err != nil { return f.fail(err) }
+	if f.spec != nil || f.err != nil { log.Printf("topology %s: reloaded (%d nodes, %d subscribers)", f.path, len(spec.Nodes), len(spec.Subscribers)) }
+	f.spec, f.err = spec, nil
+	return true
+}
+
+func (f *File) fail(err error) bool {
+	err = fmt.Errorf("%s: %w", f.path, err)
+	if f.spec != nil && (f.err == nil || f.err.Error() != err.Error()) {
+		log.Printf("topology %v (keeping the last good contents)", err)
+	}
+	f.err = err
+	return false
+}
@@ -0,0 +1,177 @@
+package topology
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourorg/psbench/pkg/kube"
+)
+
+const testSpec = `nodes:
+  - {name: vm1, ip: fd00::11, ips: [192.168.0.11]}
+  - {name: vm0, ip: 192.168.0.10, loader: "http://127.0.0.1:19465"}
+subscribers:
+  - {name: s1, node: vm0, ip: 10.1.0.1, topics: ["1", "orders:31007"]}
+  - {name: s2, node: vm1, ip: 10.1.1.1, ips: ["fd00:10:1:1::1"], port: 31002, labels: {role: orders}}
+topics:
+  - {name: orders, id: 7, maxFanout: 2}
+`
+
+// writeFile: 임시 파일에 쓰고 rename한다. 폴링이 쓰다 만 파일을 보지 않는다.
+func writeFile(t *testing.T, path, s string, mod time.Time) {
+	t.Helper()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(s), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(tmp, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpecSnapshot(t *testing.T) {
+	spec, err := ParseSpec([]byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap := spec.Snapshot()
+	if len(snap.Nodes) != 2 || snap.Nodes[0].Name != "vm0" || snap.Nodes[0].Status.Addresses[0].Address != "192.168.0.10" {
+		t.Errorf("nodes = %+v, want vm0 first", snap.Nodes)
+	}
+	if snap.Loaders["vm0"] != "http://127.0.0.1:19465" || snap.Loaders["vm1"] != "http://[fd00::11]:9465" {
+		t.Errorf("loaders = %v", snap.Loaders)
+	}
+	s1, s2 := snap.Pods[0], snap.Pods[1]
+	if s1.Annotations[kube.TopicsAnnotation] != "1,orders:31007" || s1.Spec.NodeName != "vm0" || s1.Status.PodIP != "10.1.0.1" {
+		t.Errorf("s1 = %+v", s1)
+	}
+	if s2.Annotations != nil || s2.Labels["role"] != "orders" || s2.Spec.Containers[0].Env[0].Value != "31002" {
+		t.Errorf("s2 = %+v", s2)
+	}
+	if a := snap.Nodes[1].Status.Addresses; len(a) != 2 || a[1].Address != "192.168.0.11" {
+		t.Errorf("vm1 addresses = %+v, want ip then ips", a)
+	}
+	if ips := s2.Status.PodIPs; len(ips) != 2 || ips[0].IP != "10.1.1.1" || ips[1].IP != "fd00:10:1:1::1" {
+		t.Errorf("s2 podIPs = %+v", ips)
+	}
+	if len(snap.Topics) != 1 || snap.Topics[0].Name != "orders" || snap.Topics[0].Spec.ID != 7 || snap.Topics[0].Spec.MaxFanout != 2 {
+		t.Errorf("topics = %+v", snap.Topics)
+	}
+
+	for _, bad := range []string{
+		"nodes: [{name: a, ip: 1.2.3.4}, {name: a, ip: 1.2.3.5}]",
+		"nodes: [{name: a, ip: nope}]",
+		"nodes: [{name: a, ip: 1.2.3.4, ips: [nope]}]",
+		"nodes: [{name: a, ip: 1.2.3.4}]\nsubscribers: [{name: s, node: b, ip: 10.0.0.1}]",
+		"nodes: [{name: a, ip: 1.2.3.4, typo: 1}]",
+	} {
+		if _, err := ParseSpec([]byte(bad)); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+// 바뀐 파일은 다시 읽고 알린다. 잘못된 내용으로 바뀌면 마지막 정상 내용을 유지한다.
+func TestFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "topology.yaml")
+	ctx := context.Background()
+	f := NewFile(path, 10*time.Millisecond)
+	if _, err := f.Snapshot(ctx); err == nil {
+		t.Fatal("snapshot of a missing file succeeded")
+	}
+
+	t0 := time.Now().Add(-time.Hour)
+	writeFile(t, path, testSpec, t0)
+	snap, err := f.Snapshot(ctx)
+	if err != nil || len(snap.Pods) != 2 {
+		t.Fatalf("snapshot = %+v, %v", snap, err)
+	}
+	snap.Topics[0].Status.Nodes = 5 // 호출마다 새 오브젝트
+	if again, _ := f.Snapshot(ctx); again.Topics[0].Status.Nodes != 0 {
+		t.Errorf("snapshots share objects")
+	}
+
+	rctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go f.Run(rctx)
+	writeFile(t, path, strings.Replace(testSpec, "  - {name: s2", "  - {name: s3", 1), t0.Add(time.Second))
+	select {
+	case <-f.Changed():
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change notification")
+	}
+	if snap, _ := f.Snapshot(ctx); snap.Pods[1].Name != "s3" {
+		t.Errorf("pods after reload = %v, %v", snap.Pods[0].Name, snap.Pods[1].Name)
+	}
+
+	writeFile(t, path, "nodes: [{name: broken", t0.Add(2*time.Second))
+	time.Sleep(100 * time.Millisecond) // 여러 번 폴링
+	snap, err = f.Snapshot(ctx)
+	if err != nil || len(snap.Pods) != 2 || snap.Pods[1].Name != "s3" {
+		t.Errorf("after a bad edit: %+v, %v; want the last good contents", snap, err)
+	}
+}
+
+// 제자리 덮어쓰기: 빈 파일은 잘못된 편집으로 보고, mtime/크기가 두 번 연속 같을 때만 다시 읽는다.
+func TestFilePollStable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "topology.yaml")
+	ctx := context.Background()
+	t0 := time.Now().Add(-time.Hour)
+	inPlace := func(s string, mod time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(s), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := NewFile(path, time.Hour) // Snapshot이 폴링 한 번
+	pods := func() string {
+		t.Helper()
+		snap, err := f.Snapshot(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, p := range snap.Pods {
+			names = append(names, p.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	inPlace(testSpec, t0)
+	if got := pods(); got != "s1,s2" {
+		t.Fatalf("first read = %q; want it without waiting for a second poll", got)
+	}
+	inPlace("", t0.Add(time.Second))
+	for i := 0; i < 3; i++ {
+		if got := pods(); got != "s1,s2" {
+			t.Fatalf("poll %d after truncation = %q, want the last good contents", i, got)
+		}
+	}
+	if f.err == nil || !strings.Contains(f.err.Error(), "empty") {
+		t.Errorf("err = %v, want empty file", f.err)
+	}
+
+	// 쓰다 만 파일(앞쪽 구독자만)은 다음 폴링에서 바뀌어 있으면 읽지 않는다
+	half := testSpec[:strings.Index(testSpec, "  - {name: s2")]
+	inPlace(half, t0.Add(2*time.Second))
+	if got := pods(); got != "s1,s2" {
+		t.Errorf("partial write read on first sight: %q", got)
+	}
+	inPlace(strings.Replace(testSpec, "  - {name: s2", "  - {name: s3", 1), t0.Add(3*time.Second))
+	if got := pods(); got != "s1,s2" {
+		t.Errorf("changed file read on first sight: %q", got)
+	}
+	if got := pods(); got != "s1,s3" {
+		t.Errorf("stable file = %q, want s1,s3", got)
+	}
+}
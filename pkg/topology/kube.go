@@ -0,0 +1,82 @@
+package topology
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/yourorg/psbench/pkg/kube"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Kubernetes: 클러스터 노드, Namespaces의 구독자 Pod(SubscriberSelector)와 CR, LoaderNamespace의 loader Pod(LoaderSelector).
+// 한 클러스터에 독립 배포가 여럿이면 배포마다 네임스페이스/셀렉터가 겹치지 않게 둔다.
+type Kubernetes struct {
+	Client             kubernetes.Interface
+	Dyn                dynamic.Interface
+	Namespaces         []string // "" (metav1.NamespaceAll) = 모든 네임스페이스
+	SubscriberSelector string   // 예: app=subscriber
+	LoaderNamespace    string
+	LoaderSelector     string // 예: app=psbench-loader
+	LoaderPort         int    // 0이면 DefaultLoaderPort
+}
+
+func (k *Kubernetes) Name() string { return "kubernetes" }
+
+func (k *Kubernetes) Snapshot(ctx context.Context) (*Snapshot, error) {
+	snap := &Snapshot{}
+	nodes, err := k.Client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil { return nil, &Error{"list_nodes", err} }
+	snap.Nodes = nodes.Items
+	for _, ns := range k.namespaces() {
+		pods, err := k.Client.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{LabelSelector: k.SubscriberSelector})
+		if err != nil { return nil, &Error{"list_pods", err} }
+		snap.Pods = append(snap.Pods, pods.Items...)
+		topics, err := kube.ListTopics(ctx, k.Dyn, ns)
+		if err != nil { return nil, &Error{"list_topics", err} }
+		snap.Topics = append(snap.Topics, topics...)
+		subs, err := kube.ListSubscriptions(ctx, k.Dyn, ns)
+		if err != nil { return nil, &Error{"list_subscriptions", err} }
+		snap.Subscriptions = append(snap.Subscriptions, subs...)
+	}
+	if snap.Loaders, err = k.loaders(ctx); err != nil { return nil, &Error{"list_loaders", err} }
+	return snap, nil
+}
+
+// namespaces: 중복 제거. 하나라도 ""(전체)면 전체 한 번.
+func (k *Kubernetes) namespaces() []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, ns := range k.Namespaces {
+		if ns == metav1.NamespaceAll { return []string{metav1.NamespaceAll} }
+		if !seen[ns] { out = append(out, ns) }
+		seen[ns] = true
+	}
+	return out
+}
+
+// loaders: 노드명 → loader API base URL (hostNetwork이므로 PodIP = 노드 IP)
+func (k *Kubernetes) loaders(ctx context.Context) (map[string]string, error) {
+	pods, err := k.Client.CoreV1().Pods(k.LoaderNamespace).List(ctx, metav1.ListOptions{LabelSelector: k.LoaderSelector})
+	if err != nil { return nil, err }
+	port := k.LoaderPort
+	if port == 0 { port = DefaultLoaderPort }
+	out := map[string]string{}
+	for _, p := range pods.Items {
+		if p.Status.Phase != v1.PodRunning || p.Spec.NodeName == "" { continue }
+		ip, err := netip.ParseAddr(p.Status.PodIP)
+		if err != nil { continue }
+		out[p.Spec.NodeName] = "http://" + netip.AddrPortFrom(ip, uint16(port)).String() // IPv6: http://[fd00::10]:9465
+	}
+	return out, nil
+}
+
+func (k *Kubernetes) UpdateTopicStatus(ctx context.Context, t *kube.PubSubTopic) error {
+	return kube.UpdateTopicStatus(ctx, k.Dyn, t)
+}
+
+func (k *Kubernetes) UpdateSubscriptionStatus(ctx context.Context, s *kube.PubSubSubscription) error {
+	return kube.UpdateSubscriptionStatus(ctx, k.Dyn, s)
+}
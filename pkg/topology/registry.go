@@ -0,0 +1,243 @@
+package topology
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yourorg/psbench/pkg/api"
+)
+
+// Registry: HTTP 등록 엔드포인트. 랩 노드의 loader와 구독자 프로세스가 스스로 등록한다.
+//
+//	GET    /v1/topology                   현재 Spec (만료 항목 제외)
+//	PUT    /v1/{kind}/{name}[?ttl=30s]    등록/갱신. kind: nodes|subscribers|topics|subscriptions, 본문은 Spec의 항목
+//	DELETE /v1/{kind}/{name}
+//
+// 모든 요청에 loader API와 같은 Bearer 토큰(pkg/api/auth.go)을 요구한다: 등록 내용이 곧 데이터패스 테이블이고,
+// controller는 노드의 loader URL로 그 토큰을 보내기 때문이다. 같은 이유로 노드의 loader URL 호스트는
+// 그 노드의 ip/ips 중 하나여야 한다.
+// 이름은 경로가 정한다 (본문의 name은 무시). ttl을 주면 그 안에 다시 PUT하지 않은 항목은 사라진다(heartbeat).
+// 등록 결과가 Spec.Validate를 통과하지 않으면 400 (예: 없는 노드의 구독자).
+// 노드가 만료되거나 지워지면 그 노드의 구독자는 스냅샷에서 빠진다.
+type Registry struct {
+	mu      sync.Mutex
+	entries map[string]map[string]regEntry // kind → name → 항목
+	now     func() time.Time
+	changed chan struct{}
+}
+
+type regEntry struct {
+	v       any // Node | Subscriber | Topic | Subscription
+	expires time.Time
+}
+
+var regKinds = []string{"nodes", "subscribers", "topics", "subscriptions"}
+
+// NewRegistry: initial은 만료 없는 초기 내용 (nil 가능)
+func NewRegistry(initial *Spec) (*Registry, error) {
+	r := &Registry{entries: map[string]map[string]regEntry{}, now: time.Now, changed: make(chan struct{}, 1)}
+	for _, k := range regKinds {
+		r.entries[k] = map[string]regEntry{}
+	}
+	if initial == nil { return r, nil }
+	if err := initial.Validate(); err != nil { return nil, err }
+	for _, n := range initial.Nodes {
+		r.entries["nodes"][n.Name] = regEntry{v: n}
+	}
+	for _, s := range initial.Subscribers {
+		r.entries["subscribers"][s.Name] = regEntry{v: s}
+	}
+	for _, t := range initial.Topics {
+		r.entries["topics"][t.Name] = regEntry{v: t}
+	}
+	for _, s := range initial.Subscriptions {
+		r.entries["subscriptions"][s.Name] = regEntry{v: s}
+	}
+	return r, nil
+}
+
+func (r *Registry) Name() string              { return "registry" }
+func (r *Registry) Changed() <-chan struct{} { return r.changed }
+
+func (r *Registry) Snapshot(context.Context) (*Snapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.spec(true).Snapshot(), nil
+}
+
+// spec: 만료 항목을 지우고 Spec을 만든다. prune이면 노드가 없는 구독자를 뺀다. r.mu를 잡고 호출.
+func (r *Registry) spec(prune bool) Spec {
+	now := r.now()
+	var s Spec
+	for _, k := range regKinds {
+		names := make([]string, 0, len(r.entries[k]))
+		for name, e := range r.entries[k] {
+			if !e.expires.IsZero() && now.After(e.expires) {
+				log.Printf("registry: %s/%s expired", k, name)
+				delete(r.entries[k], name)
+				continue
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			switch v := r.entries[k][name].v.(type) {
+			case Node:
+				s.Nodes = append(s.Nodes, v)
+			case Subscriber:
+				s.Subscribers = append(s.Subscribers, v)
+			case Topic:
+				s.Topics = append(s.Topics, v)
+			case Subscription:
+				s.Subscriptions = append(s.Subscriptions, v)
+			}
+		}
+	}
+	if prune {
+		nodes := map[string]bool{}
+		for _, n := range s.Nodes {
+			nodes[n.Name] = true
+		}
+		kept := s.Subscribers[:0]
+		for _, sb := range s.Subscribers {
+			if nodes[sb.Node] { kept = append(kept, sb) }
+		}
+		s.Subscribers = kept
+	}
+	return s
+}
+
+// Handler: 등록 API. token이 비면 인증 없음 (루프백에만 열 때).
+func (r *Registry) Handler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/topology", func(w http.ResponseWriter, _ *http.Request) {
+		r.mu.Lock()
+		s := r.spec(false)
+		r.mu.Unlock()
+		writeJSON(w, http.StatusOK, s)
+	})
+	mux.HandleFunc("PUT /v1/{kind}/{name}", r.handlePut)
+	mux.HandleFunc("DELETE /v1/{kind}/{name}", r.handleDelete)
+	return api.RequireToken(token, mux)
+}
+
+func (r *Registry) handlePut(w http.ResponseWriter, req *http.Request) {
+	kind, name := req.PathValue("kind"), req.PathValue("name")
+	var ttl time.Duration
+	if v := req.URL.Query().Get("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			writeJSON(w, http.StatusBadRequest, api.Error{Error: fmt.Sprintf("ttl %q: want a duration like 30s", v)})
+			return
+		}
+		ttl = d
+	}
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	var v any
+	var err error
+	switch kind {
+	case "nodes":
+		var n Node
+		err = dec.Decode(&n)
+		n.Name = name
+		if err == nil { err = checkLoaderHost(n) }
+		v = n
+	case "subscribers":
+		var s Subscriber
+		err = dec.Decode(&s)
+		s.Name = name
+		v = s
+	case "topics":
+		var t Topic
+		err = dec.Decode(&t)
+		t.Name = name
+		v = t
+	case "subscriptions":
+		var s Subscription
+		err = dec.Decode(&s)
+		s.Name = name
+		v = s
+	default:
+		writeJSON(w, http.StatusNotFound, api.Error{Error: fmt.Sprintf("unknown kind %q", kind)})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, api.Error{Error: err.Error()})
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e := regEntry{v: v}
+	if ttl > 0 { e.expires = r.now().Add(ttl) }
+	old, had := r.entries[kind][name]
+	r.entries[kind][name] = e
+	err = r.spec(true).Validate()
+	if sb, ok := v.(Subscriber); ok && err == nil {
+		if _, ok := r.entries["nodes"][sb.Node]; !ok { err = fmt.Errorf("subscriber %s: unknown node %q", name, sb.Node) }
+	}
+	if err != nil {
+		if had {
+			r.entries[kind][name] = old
+		} else {
+			delete(r.entries[kind], name)
+		}
+		writeJSON(w, http.StatusBadRequest, api.Error{Error: err.Error()})
+		return
+	}
+	// heartbeat(내용이 같은 재등록)는 reconcile을 깨우지 않는다
+	if !had || !sameJSON(old.v, v) { notify(r.changed) }
+	writeJSON(w, http.StatusOK, v)
+}
+
+func (r *Registry) handleDelete(w http.ResponseWriter, req *http.Request) {
+	kind, name := req.PathValue("kind"), req.PathValue("name")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	byName, ok := r.entries[kind]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, api.Error{Error: fmt.Sprintf("unknown kind %q", kind)})
+		return
+	}
+	if _, ok := byName[name]; !ok {
+		writeJSON(w, http.StatusNotFound, api.Error{Error: fmt.Sprintf("%s/%s not registered", kind, name)})
+		return
+	}
+	delete(byName, name)
+	notify(r.changed)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkLoaderHost: loader URL이 있으면 http(s)://<노드 ip 또는 ips 중 하나>:PORT 여야 한다.
+func checkLoaderHost(n Node) error {
+	if n.Loader == "" { return nil }
+	u, err := url.Parse(n.Loader)
+	if err != nil { return fmt.Errorf("loader %q: %w", n.Loader, err) }
+	host, err := netip.ParseAddr(u.Hostname())
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") { return fmt.Errorf("loader %q: want http://NODE-IP:PORT", n.Loader) }
+	for _, s := range append([]string{n.IP}, n.IPs...) {
+		if ip, err := netip.ParseAddr(s); err == nil && ip.Unmap() == host.Unmap() { return nil }
+	}
+	return fmt.Errorf("loader %q: host is not an address of node %s", n.Loader, n.Name)
+}
+
+func sameJSON(a, b any) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
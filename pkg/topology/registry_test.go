@@ -0,0 +1,122 @@
+package topology
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	r, err := NewRegistry(&Spec{Topics: []Topic{{Name: "orders"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1000, 0)
+	r.now = func() time.Time { return now }
+	srv := httptest.NewServer(r.Handler("s3cret"))
+	defer srv.Close()
+
+	token := "s3cret"
+	do := func(method, path, body string, want int) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%s %s: %d, want %d", method, path, resp.StatusCode, want)
+		}
+	}
+	changed := func() bool {
+		select {
+		case <-r.Changed():
+			return true
+		default:
+			return false
+		}
+	}
+	snapshot := func() *Snapshot {
+		t.Helper()
+		snap, err := r.Snapshot(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return snap
+	}
+
+	// 토큰이 없거나 틀리면 어떤 경로도 통과하지 못한다
+	for _, token = range []string{"", "wrong"} {
+		do("PUT", "/v1/nodes/vm0", `{"ip":"192.168.0.10"}`, 401)
+		do("GET", "/v1/topology", "", 401)
+	}
+	token = "s3cret"
+	if snap := snapshot(); len(snap.Nodes) != 0 {
+		t.Fatalf("unauthenticated registration: %+v", snap.Nodes)
+	}
+
+	do("PUT", "/v1/subscribers/s1", `{"node":"vm0","ip":"10.1.0.1"}`, 400) // 노드 먼저
+
+	// controller가 토큰을 보내는 loader URL은 그 노드의 주소여야 한다
+	do("PUT", "/v1/nodes/vm0", `{"ip":"192.168.0.10","loader":"http://10.9.9.9:9465"}`, 400)
+	do("PUT", "/v1/nodes/vm0", `{"ip":"192.168.0.10","loader":"http://127.0.0.1:9465"}`, 400)
+	do("PUT", "/v1/nodes/vm0", `{"ip":"192.168.0.10","loader":"file:///etc/passwd"}`, 400)
+	do("PUT", "/v1/nodes/vm0", `{"ip":"fd00::10","ips":["192.168.0.10"],"loader":"http://192.168.0.10:19465"}`, 200)
+
+	do("PUT", "/v1/nodes/vm0", `{"ip":"192.168.0.10"}`, 200)
+	do("PUT", "/v1/nodes/vm1", `{"ip":"192.168.0.11"}`, 200)
+	do("PUT", "/v1/subscribers/s1?ttl=30s", `{"node":"vm0","ip":"10.1.0.1","topics":["orders"]}`, 200)
+	do("PUT", "/v1/subscribers/s2", `{"node":"vm1","ip":"10.1.1.1"}`, 200)
+	do("PUT", "/v1/subscribers/s3", `{"node":"vm1","ip":"10.1.1.3","typo":1}`, 400)
+	do("PUT", "/v1/subscribers/s3?ttl=soon", `{"node":"vm1","ip":"10.1.1.3"}`, 400)
+	do("PUT", "/v1/widgets/w", `{}`, 404)
+	if !changed() {
+		t.Errorf("no change notification after registrations")
+	}
+	snap := snapshot()
+	if len(snap.Nodes) != 2 || len(snap.Pods) != 2 || len(snap.Topics) != 1 || snap.Loaders["vm1"] != "http://192.168.0.11:9465" {
+		t.Fatalf("snapshot = %+v", snap)
+	}
+
+	// 같은 내용의 heartbeat는 reconcile을 깨우지 않고 만료만 늦춘다
+	now = now.Add(20 * time.Second)
+	do("PUT", "/v1/subscribers/s1?ttl=30s", `{"node":"vm0","ip":"10.1.0.1","topics":["orders"]}`, 200)
+	if changed() {
+		t.Errorf("heartbeat woke the controller")
+	}
+	now = now.Add(20 * time.Second)
+	if snap := snapshot(); len(snap.Pods) != 2 {
+		t.Errorf("s1 expired despite heartbeat")
+	}
+	now = now.Add(20 * time.Second)
+	if snap := snapshot(); len(snap.Pods) != 1 || snap.Pods[0].Name != "s2" {
+		t.Errorf("pods = %+v, want s1 expired", snap.Pods)
+	}
+
+	// 노드를 지우면 그 노드의 구독자는 스냅샷에서 빠지지만 등록은 남는다
+	do("DELETE", "/v1/nodes/vm1", "", 204)
+	do("DELETE", "/v1/nodes/vm1", "", 404)
+	if snap := snapshot(); len(snap.Nodes) != 1 || len(snap.Pods) != 0 {
+		t.Errorf("snapshot after node delete = %+v", snap)
+	}
+	req, _ := http.NewRequest("GET", srv.URL+"/v1/topology", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var spec Spec
+	if err := json.NewDecoder(resp.Body).Decode(&spec); err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Nodes) != 1 || len(spec.Subscribers) != 1 || spec.Subscribers[0].Node != "vm1" {
+		t.Errorf("GET /v1/topology = %+v", spec)
+	}
+}
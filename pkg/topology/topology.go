@@ -0,0 +1,199 @@
+package topology
+
+// 토폴로지 원천: controller가 desired 테이블을 계산하는 입력(노드, 구독자, 토픽/구독, loader 주소).
+// 같은 reconcile/세대 플립 로직을 K8s 클러스터, 랩 VM, netns 테스트베드에서 쓰기 위해 원천만 바꾼다.
+//
+//	Kubernetes  노드/구독자 Pod/CR/loader Pod 조회 (kube.go). CR status를 되쓴다.
+//	File        정적 YAML 파일, mtime/크기 폴링으로 변경 감지 (file.go)
+//	Registry    HTTP 등록 엔드포인트, 항목별 TTL (registry.go)
+//
+// 원천은 K8s 오브젝트 모양(v1.Node/v1.Pod/kube CR)으로 돌려준다. 토픽 해석 규칙(ps/topics 어노테이션,
+// Subscription selector, 포트 우선순위)은 controller 한 곳에만 있다.
+// File/Registry의 구독자는 어노테이션과 라벨, PS_UDP_PORT env를 가진 Pod로 바뀐다 (Spec.Snapshot).
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yourorg/psbench/pkg/kube"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultLoaderPort: loader API 포트 (cmd/loader PS_API_ADDR 기본값)
+const DefaultLoaderPort = 9465
+
+// Snapshot: 원천 한 번 조회한 결과. controller가 status를 채우며 고치므로 호출마다 새로 만든다.
+type Snapshot struct {
+	Nodes         []v1.Node
+	Pods          []v1.Pod // 구독자 (Ready가 아니거나 종료 중인 것은 controller가 거른다)
+	Topics        []kube.PubSubTopic
+	Subscriptions []kube.PubSubSubscription
+	Loaders       map[string]string // 노드명 → loader API base URL. 없는 노드는 push 실패(no_loader)
+}
+
+type Source interface {
+	Name() string
+	Snapshot(ctx context.Context) (*Snapshot, error)
+}
+
+// Notifier: 변경을 알리는 원천. controller는 resync 주기를 기다리지 않고 바로 reconcile한다.
+type Notifier interface {
+	Changed() <-chan struct{}
+}
+
+// StatusWriter: 토픽/구독 status를 되쓸 수 있는 원천 (Kubernetes). 아니면 status는 로그/dry-run에만 남는다.
+type StatusWriter interface {
+	UpdateTopicStatus(ctx context.Context, t *kube.PubSubTopic) error
+	UpdateSubscriptionStatus(ctx context.Context, s *kube.PubSubSubscription) error
+}
+
+// Error: 원천 조회 실패. Stage는 controller health 보고용 (list_nodes, read_file, ...)
+type Error struct {
+	Stage string
+	Err   error
+}
+
+func (e *Error) Error() string { return e.Stage + ": " + e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// notify: 버퍼 1짜리 채널에 막힘 없이 알린다 (여러 번의 변경은 한 번으로 합쳐진다)
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// Spec: File/Registry 토폴로지 (YAML/JSON).
+//
+//	nodes:
+//	  - {name: vm1, ip: 192.168.0.10}                     # loader 생략 시 http://IP:9465
+//	  - {name: vm2, ip: 192.168.0.11, ips: [fd00::11], loader: http://127.0.0.1:19465}
+//	subscribers:
+//	  - {name: s1, node: vm1, ip: 10.1.0.1, topics: ["1", "orders:31007"]}
+//	  - {name: s2, node: vm2, ip: 10.1.1.1, ips: [fd00:10:1:1::1], port: 31002, labels: {role: orders}}
+//	topics:
+//	  - {name: orders, id: 7, maxFanout: 2}               # PubSubTopic spec
+//	subscriptions:
+//	  - {name: orders-all, topic: orders, selector: {matchLabels: {role: orders}}}
+//
+// node_id는 K8s와 같이 노드명 사전순 인덱스다. ips는 dual-stack의 추가 주소(InternalIP/PodIPs 뒤쪽 항목)로,
+// 토픽 family(controller -ip-family, 토픽 ipFamily)에 맞는 주소가 쓰인다.
+type Spec struct {
+	Nodes         []Node         `json:"nodes"`
+	Subscribers   []Subscriber   `json:"subscribers,omitempty"`
+	Topics        []Topic        `json:"topics,omitempty"`
+	Subscriptions []Subscription `json:"subscriptions,omitempty"`
+}
+
+type Node struct {
+	Name   string `json:"name"`
+	IP     string   `json:"ip"`               // 1차 목적지 주소 (K8s InternalIP 자리)
+	IPs    []string `json:"ips,omitempty"`    // dual-stack 추가 주소
+	Loader string   `json:"loader,omitempty"` // loader API base URL
+}
+
+type Subscriber struct {
+	Name   string            `json:"name"`
+	Node   string            `json:"node"`
+	IP     string            `json:"ip"`
+	IPs    []string          `json:"ips,omitempty"`    // dual-stack 추가 주소 (PodIPs)
+	Port   int               `json:"port,omitempty"`   // PS_UDP_PORT 자리, 0이면 기본 규칙
+	Topics []string          `json:"topics,omitempty"` // ps/topics 항목. 비면 Subscription 또는 topic 1
+	Labels map[string]string `json:"labels,omitempty"` // Subscription selector 대상
+}
+
+type Topic struct {
+	Name           string `json:"name"`
+	kube.TopicSpec `json:",inline"`
+}
+
+type Subscription struct {
+	Name                  string `json:"name"`
+	kube.SubscriptionSpec `json:",inline"`
+}
+
+// Validate: 이름 중복, 주소, 구독자의 노드를 확인한다. 토픽 항목 자체는 controller가 해석한다(경고 이벤트).
+func (s Spec) Validate() error {
+	nodes := map[string]bool{}
+	for _, n := range s.Nodes {
+		if n.Name == "" { return fmt.Errorf("node without name") }
+		if nodes[n.Name] { return fmt.Errorf("node %s: duplicate", n.Name) }
+		nodes[n.Name] = true
+		for _, ip := range append([]string{n.IP}, n.IPs...) {
+			if _, err := netip.ParseAddr(ip); err != nil { return fmt.Errorf("node %s: ip %q: %w", n.Name, ip, err) }
+		}
+	}
+	subs := map[string]bool{}
+	for _, sb := range s.Subscribers {
+		if sb.Name == "" { return fmt.Errorf("subscriber without name") }
+		if subs[sb.Name] { return fmt.Errorf("subscriber %s: duplicate", sb.Name) }
+		subs[sb.Name] = true
+		if !nodes[sb.Node] { return fmt.Errorf("subscriber %s: unknown node %q", sb.Name, sb.Node) }
+		for _, ip := range append([]string{sb.IP}, sb.IPs...) {
+			if _, err := netip.ParseAddr(ip); err != nil { return fmt.Errorf("subscriber %s: ip %q: %w", sb.Name, ip, err) }
+		}
+		if sb.Port < 0 || sb.Port > 65535 { return fmt.Errorf("subscriber %s: port %d", sb.Name, sb.Port) }
+	}
+	names := map[string]bool{}
+	for _, t := range s.Topics {
+		if t.Name == "" || names[t.Name] { return fmt.Errorf("topic %q: missing or duplicate name", t.Name) }
+		names[t.Name] = true
+	}
+	names = map[string]bool{}
+	for _, sc := range s.Subscriptions {
+		if sc.Name == "" || names[sc.Name] { return fmt.Errorf("subscription %q: missing or duplicate name", sc.Name) }
+		names[sc.Name] = true
+	}
+	return nil
+}
+
+// Snapshot: Spec → K8s 오브젝트 모양. Validate를 통과한 Spec이어야 한다.
+// 노드는 이름순, 구독자는 이름순으로 정렬한다 (같은 Spec은 같은 테이블).
+func (s Spec) Snapshot() *Snapshot {
+	snap := &Snapshot{Loaders: map[string]string{}}
+	for _, n := range s.Nodes {
+		node := v1.Node{ObjectMeta: metav1.ObjectMeta{Name: n.Name}}
+		for _, ip := range append([]string{n.IP}, n.IPs...) {
+			node.Status.Addresses = append(node.Status.Addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: ip})
+		}
+		snap.Nodes = append(snap.Nodes, node)
+		url := n.Loader
+		if url == "" { url = "http://" + netip.AddrPortFrom(netip.MustParseAddr(n.IP), DefaultLoaderPort).String() }
+		snap.Loaders[n.Name] = url
+	}
+	sort.Slice(snap.Nodes, func(i, j int) bool { return snap.Nodes[i].Name < snap.Nodes[j].Name })
+
+	for _, sb := range s.Subscribers {
+		p := v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: sb.Name, Labels: map[string]string{}},
+			Spec:       v1.PodSpec{NodeName: sb.Node, Containers: []v1.Container{{Name: "subscriber"}}},
+			// 등록된 구독자는 살아 있는 것으로 본다 (controller의 readiness 필터를 통과)
+			Status: v1.PodStatus{Phase: v1.PodRunning, PodIP: sb.IP,
+				Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}},
+		}
+		for _, ip := range append([]string{sb.IP}, sb.IPs...) {
+			p.Status.PodIPs = append(p.Status.PodIPs, v1.PodIP{IP: ip})
+		}
+		for k, v := range sb.Labels {
+			p.Labels[k] = v
+		}
+		if len(sb.Topics) > 0 { p.Annotations = map[string]string{kube.TopicsAnnotation: strings.Join(sb.Topics, ",")} }
+		if sb.Port > 0 { p.Spec.Containers[0].Env = []v1.EnvVar{{Name: kube.PortEnv, Value: strconv.Itoa(sb.Port)}} }
+		snap.Pods = append(snap.Pods, p)
+	}
+	sort.Slice(snap.Pods, func(i, j int) bool { return snap.Pods[i].Name < snap.Pods[j].Name })
+
+	for _, t := range s.Topics {
+		snap.Topics = append(snap.Topics, kube.PubSubTopic{ObjectMeta: metav1.ObjectMeta{Name: t.Name}, Spec: t.TopicSpec})
+	}
+	for _, sc := range s.Subscriptions {
+		snap.Subscriptions = append(snap.Subscriptions, kube.PubSubSubscription{ObjectMeta: metav1.ObjectMeta{Name: sc.Name}, Spec: sc.SubscriptionSpec})
+	}
+	return snap
+}
@@ -59,6 +59,13 @@ for case in "${CASES[@]}"; do
           K)
             kubectl -n $NS logs -l app=psbench-kafka-subscriber --tail=-1 > "results/${FN}" || true ;;
         esac
+        # 커널측 clone/drop 카운터(loader JSONL) — 구독자 관측 손실과 나란히 비교
+        # loader 로그에는 log.Printf 줄과 이벤트 JSONL이 섞이므로 metrics 레코드만 남긴다
+        case $case in
+          B|C)
+            kubectl -n $NS logs -l app=psbench-loader --since=${DUR}s \
+              | grep '^{"kind":"metrics"' > "results/kern_${FN}" || true ;;
+        esac
       done
     done
   done
@@ -0,0 +1,7 @@
+// Package e2e: K8s 없이 netns/veth 테스트베드에서 loader, controller, publisher, subscriber 바이너리를
+// 함께 돌려 fan-out을 확인하는 통합 테스트 (testbed_test.go, fanout_test.go).
+//
+//	sudo PS_E2E=1 go test ./test/e2e -v
+//
+// bpf 오브젝트(make -C bpf), iproute2, root가 필요하다.
+package e2e
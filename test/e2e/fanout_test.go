@@ -0,0 +1,311 @@
+package e2e
+
+// 퍼블리셔 노드 1 + 구독자 노드 2의 fan-out을 실제 바이너리로 확인한다 (case B: direct, case C: hierarchical).
+//
+//	           core (라우터, controller)
+//	     10.77.1.1   10.77.2.1   10.77.3.1
+//	        |            |           |
+//	   pub eth0     n1 eth0      n2 eth0        loader: pub eth0:egress, n1/n2 eth0:ingress
+//	  10.77.1.2    10.77.2.2    10.77.3.2
+//	                 lxc0         lxc0
+//	                   |            |
+//	              s1 10.88.2.2  s2 10.88.3.2    subscriber 파드
+//
+// 노드 사이에 라우터를 둬서 모든 프레임이 L3 홉을 거친다: 데이터패스는 MAC을 고치지 않으므로
+// clone된 프레임도 라우터 MAC으로 나가 주소(IP)만으로 배달된다.
+// publisher는 pub 노드에서 라우터 주소로 보내고, eth0 egress의 tc 프로그램이 hop 0 fan-out을 한다.
+// loader는 헤더 magic을 검사하고(PS_HDR_MAGIC) publisher는 같은 값을 싣는다(-magic).
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/yourorg/psbench/pkg/kube"
+	"github.com/yourorg/psbench/pkg/maps"
+	"github.com/yourorg/psbench/pkg/topology"
+	"sigs.k8s.io/yaml"
+)
+
+type e2eNode struct {
+	name, ip string // 노드 이름, eth0 주소 (/24, 게이트웨이 .1은 core)
+	sub, pod string // 구독자 파드 이름, 주소 (/24, 게이트웨이 .1은 노드 lxc0). 비면 없음
+}
+
+var e2eNodes = []e2eNode{
+	{name: "pub", ip: "10.77.1.2"},
+	{name: "n1", ip: "10.77.2.2", sub: "s1", pod: "10.88.2.2"},
+	{name: "n2", ip: "10.77.3.2", sub: "s2", pod: "10.88.3.2"},
+}
+
+// gw: 같은 /24의 .1, subnet: 그 /24
+func gw(ip string) string     { return ip[:strings.LastIndexByte(ip, '.')] + ".1" }
+func subnet(ip string) string { return ip[:strings.LastIndexByte(ip, '.')] + ".0/24" }
+
+// e2eSpec: case C(topic 1, hierarchical, 31001)와 case B(topic 2, direct, 31002)를 한 토폴로지에
+func e2eSpec() topology.Spec {
+	spec := topology.Spec{Topics: []topology.Topic{
+		{Name: "hierarchical", TopicSpec: kube.TopicSpec{ID: 1, TierMode: kube.TierHierarchical}},
+		{Name: "direct", TopicSpec: kube.TopicSpec{ID: 2, TierMode: kube.TierDirect, Port: 31002}},
+	}}
+	for _, n := range e2eNodes {
+		spec.Nodes = append(spec.Nodes, topology.Node{Name: n.name, IP: n.ip})
+		if n.sub != "" {
+			spec.Subscribers = append(spec.Subscribers, topology.Subscriber{Name: n.sub, Node: n.name, IP: n.pod, Topics: []string{"1", "2"}})
+		}
+	}
+	return spec
+}
+
+func setupNetwork(tb *testbed) {
+	tb.addNetns("core")
+	for _, n := range e2eNodes {
+		tb.addNetns(n.name)
+		tb.link(n.name, "eth0", n.ip+"/24", "core", n.name, gw(n.ip)+"/24")
+		tb.route(n.name, "default", "via", gw(n.ip))
+		if n.sub == "" {
+			continue
+		}
+		tb.addNetns(n.sub)
+		tb.link(n.sub, "eth0", n.pod+"/24", n.name, "lxc0", gw(n.pod)+"/24")
+		tb.route(n.sub, "default", "via", gw(n.pod))
+		// direct 토픽은 pub 노드에서 바로 파드 주소로 간다
+		tb.route("core", subnet(n.pod), "via", n.ip)
+	}
+}
+
+// e2eMagic: topic_hdr.flags ("PS")
+const e2eMagic = "0x5053"
+
+// startLoaders: API는 controller가 있는 core에서 닿도록 eth0 주소에 열고 토큰을 요구한다
+func startLoaders(tb *testbed, tokenFile string) {
+	obj, err := filepath.Abs(objPath)
+	if err != nil {
+		tb.t.Fatal(err)
+	}
+	for _, n := range e2eNodes {
+		// pub: 로컬 패킷이 나가는 eth0 egress에서 hop 0, 구독자 노드: eth0 ingress에서 hop 1
+		local, attach := "lxc0", "eth0:ingress"
+		if n.sub == "" {
+			local, attach = "eth0", "eth0:egress"
+		}
+		tb.start(n.name, "loader-"+n.name, []string{
+			"PS_OBJ=" + obj,
+			"PS_PIN_ROOT=" + filepath.Join(tb.bpffs, n.name),
+			"PS_EGRESS_IF=eth0",
+			"PS_LOCAL_ROUTE_IF=" + local,
+			"PS_ATTACH_DEV=" + attach,
+			"PS_API_ADDR=" + n.ip + ":9465",
+			"PS_API_TOKEN_FILE=" + tokenFile,
+			"PS_HDR_MAGIC=" + e2eMagic,
+		}, "loader")
+	}
+}
+
+// waitProgrammed: 모든 노드의 활성 세대에 두 토픽이 들어갈 때까지
+func waitProgrammed(tb *testbed, timeout time.Duration) {
+	tb.t.Helper()
+	deadline := time.Now().Add(timeout)
+	var last string
+	for time.Now().Before(deadline) {
+		ready := true
+		for _, n := range e2eNodes {
+			t, err := activeTables(filepath.Join(tb.bpffs, n.name))
+			if err != nil || len(t.Topics[1]) != 2 || len(t.Topics[2]) != 2 {
+				ready, last = false, n.name
+				break
+			}
+		}
+		if ready {
+			return
+		}
+		for _, p := range tb.procs {
+			if p.exited() {
+				tb.t.Fatalf("%s exited", p.name)
+			}
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	tb.t.Fatalf("node %s not programmed after %s", last, timeout)
+}
+
+func activeTables(pins string) (maps.Tables, error) {
+	dp, err := maps.OpenPinned(pins)
+	if err != nil {
+		return maps.Tables{}, err
+	}
+	defer dp.Close()
+	gen, err := dp.ActiveGen()
+	if err != nil {
+		return maps.Tables{}, err
+	}
+	return dp.ReadGeneration(gen)
+}
+
+func nodeMetrics(t *testing.T, tb *testbed, node string) maps.Metrics {
+	t.Helper()
+	m, err := ebpf.LoadPinnedMap(filepath.Join(tb.bpffs, node, "m_metrics"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	v, err := maps.ReadMetrics(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// received: subscriber 1초 레코드를 합산한 토픽별 수신 수. 구독하지 않은 토픽은 unexpected에.
+func received(p *proc) (got map[uint32]int, unexpected []uint32) {
+	got = map[uint32]int{}
+	sc := bufio.NewScanner(strings.NewReader(p.out.String()))
+	for sc.Scan() {
+		var r struct {
+			Topic      uint32  `json:"topic"`
+			QPS        float64 `json:"qps"`
+			Unexpected bool    `json:"unexpected"`
+		}
+		if json.Unmarshal(sc.Bytes(), &r) != nil {
+			continue
+		}
+		got[r.Topic] += int(r.QPS)
+		if r.Unexpected && r.QPS > 0 {
+			unexpected = append(unexpected, r.Topic)
+		}
+	}
+	return got, unexpected
+}
+
+func TestFanout(t *testing.T) {
+	requireE2E(t)
+	tb := newTestbed(t)
+	tb.build("loader", "controller", "publisher", "subscriber")
+	setupNetwork(tb)
+
+	b, err := yaml.Marshal(e2eSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	topo := filepath.Join(tb.dir, "topology.yaml")
+	if err := os.WriteFile(topo, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	token := filepath.Join(tb.dir, "api-token")
+	if err := os.WriteFile(token, []byte("e2e-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	startLoaders(tb, token)
+	tb.start("core", "controller", nil, "controller", "-source=file", "-topology="+topo, "-loader-token-file="+token)
+	waitProgrammed(tb, 30*time.Second)
+
+	subs := map[string]*proc{}
+	for _, n := range e2eNodes {
+		if n.sub != "" {
+			subs[n.sub] = tb.start(n.sub, n.sub, []string{"PS_TOPICS=1:31001,2:31002"}, "subscriber")
+		}
+	}
+	time.Sleep(500 * time.Millisecond) // 수신 소켓
+
+	const (
+		qps     = 200
+		window  = 3 * time.Second
+		minRecv = qps * 3 / 2 // window의 절반
+	)
+	for _, tc := range []struct {
+		name  string
+		topic uint32
+	}{
+		{"C/hierarchical", 1},
+		{"B/direct", 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			before := map[string]maps.Metrics{}
+			for _, n := range e2eNodes {
+				before[n.name] = nodeMetrics(t, tb, n.name)
+			}
+			base := map[string]int{}
+			for name, p := range subs {
+				got, _ := received(p)
+				base[name] = got[tc.topic]
+			}
+
+			pub := tb.start("pub", fmt.Sprintf("publisher-%d", tc.topic), nil, "publisher",
+				fmt.Sprintf("-topic=%d", tc.topic), fmt.Sprintf("-qps=%d", qps), "-payload=64", "-dst="+gw(e2eNodes[0].ip)+":32000", "-magic="+e2eMagic)
+			time.Sleep(window)
+			pub.stop()
+			time.Sleep(1500 * time.Millisecond) // 구독자의 마지막 1초 레코드
+
+			counts := map[string]int{}
+			for name, p := range subs {
+				got, unexpected := received(p)
+				counts[name] = got[tc.topic] - base[name]
+				if len(unexpected) > 0 {
+					t.Errorf("%s: unexpected topics %v", name, unexpected)
+				}
+			}
+			t.Logf("received %v", counts)
+			lo, hi := counts["s1"], counts["s2"]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if lo < minRecv {
+				t.Fatalf("delivery: %v, want at least %d per subscriber", counts, minRecv)
+			}
+			// 같은 메시지가 두 구독자 모두에게: 수신 수가 거의 같아야 한다
+			if hi-lo > hi/20 {
+				t.Errorf("fan-out uneven: %v", counts)
+			}
+
+			d := func(node string) maps.Metrics {
+				a, b := nodeMetrics(t, tb, node), before[node]
+				out := maps.Metrics{Tier1Clones: a.Tier1Clones - b.Tier1Clones, Tier2Clones: a.Tier2Clones - b.Tier2Clones}
+				for i := range out.Drops {
+					out.Drops[i] = a.Drops[i] - b.Drops[i]
+				}
+				return out
+			}
+			// 목적지 2개: 메시지마다 clone 1번 + 원본
+			if c := d("pub").Tier1Clones; c < uint64(lo)*9/10 {
+				t.Errorf("pub tier-1 clones %d for %d messages", c, lo)
+			}
+			for _, n := range []string{"n1", "n2"} {
+				m := d(n)
+				// hierarchical은 노드 로컬 집합에서, direct는 hop=2로 와서 그대로 통과: 어느 쪽도 드롭이 없다
+				if m.Drops != ([maps.DrMax]uint64{}) {
+					t.Errorf("%s: drops %v", n, m.Drops)
+				}
+				if tc.topic == 2 && m.Tier2Clones != 0 {
+					t.Errorf("%s: %d tier-2 clones for direct packets", n, m.Tier2Clones)
+				}
+			}
+		})
+	}
+
+	// magic이 다른 패킷은 psbench 트래픽이 아니다: fan-out 없이 그대로 나가고 드롭이 아닌 skipped로 센다
+	t.Run("magic mismatch", func(t *testing.T) {
+		before := nodeMetrics(t, tb, "pub")
+		pub := tb.start("pub", "publisher-nomagic", nil, "publisher",
+			"-topic=1", fmt.Sprintf("-qps=%d", qps), "-payload=64", "-dst="+gw(e2eNodes[0].ip)+":32000", "-magic=0")
+		time.Sleep(time.Second)
+		pub.stop()
+		after := nodeMetrics(t, tb, "pub")
+		if c := after.Tier1Clones - before.Tier1Clones; c != 0 {
+			t.Errorf("%d tier-1 clones for packets without the magic", c)
+		}
+		if s := after.Skipped - before.Skipped; s < qps/2 {
+			t.Errorf("skipped %d, want about %d", s, qps)
+		}
+		for i := range after.Drops {
+			if after.Drops[i] != before.Drops[i] {
+				t.Errorf("drop %s moved: %d → %d", maps.DropReasons[i], before.Drops[i], after.Drops[i])
+			}
+		}
+	})
+}
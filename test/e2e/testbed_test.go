@@ -0,0 +1,214 @@
+package e2e
+
+// netns/veth 테스트베드: K8s 없이 한 리눅스 박스에서 노드/Pod를 네트워크 네임스페이스로 흉내 낸다.
+// iproute2(ip)로 만들고, 프로세스는 `ip netns exec`로 띄운다. 맵 핀은 테스트 전용 bpffs 마운트에 둔다.
+// 실행 조건: PS_E2E=1, root, ip, 빌드된 bpf 오브젝트 (make -C bpf). 아니면 skip. 오브젝트가 낡았으면 실패.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/yourorg/psbench/pkg/maps"
+	"golang.org/x/sys/unix"
+)
+
+const objPath = "../../bpf/tc_hier_pubsub_kern.o"
+
+func requireE2E(t *testing.T) {
+	t.Helper()
+	if os.Getenv("PS_E2E") != "1" {
+		t.Skip("set PS_E2E=1 to run the netns end-to-end test")
+	}
+	if os.Geteuid() != 0 {
+		t.Skip("needs root (netns, veth, bpffs, tc)")
+	}
+	if _, err := exec.LookPath("ip"); err != nil {
+		t.Skip("needs iproute2 ip")
+	}
+	if _, err := os.Stat(objPath); err != nil {
+		t.Skipf("bpf object not built (make -C bpf): %v", err)
+	}
+	spec, err := ebpf.LoadCollectionSpec(objPath)
+	if err == nil {
+		err = maps.CheckSpec(spec)
+	}
+	if err != nil {
+		t.Fatalf("stale bpf object, rebuild with make -C bpf: %v", err)
+	}
+}
+
+type testbed struct {
+	t      *testing.T
+	prefix string // netns 이름 접두어 (동시 실행 구분)
+	dir    string // 바이너리, 로그, 토폴로지 파일
+	bpffs  string // 노드별 핀 루트의 부모
+	netns  []string
+	procs  []*proc
+}
+
+func newTestbed(t *testing.T) *testbed {
+	tb := &testbed{t: t, prefix: fmt.Sprintf("ps%d", os.Getpid()), dir: t.TempDir()}
+	t.Cleanup(tb.close)
+	fs := filepath.Join(tb.dir, "bpffs")
+	if err := os.Mkdir(fs, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Mount("bpf", fs, "bpf", 0, ""); err != nil {
+		t.Fatalf("mount bpffs: %v", err)
+	}
+	tb.bpffs = fs
+	return tb
+}
+
+// build: cmd/<name> 바이너리를 tb.dir에 빌드
+func (tb *testbed) build(names ...string) {
+	tb.t.Helper()
+	for _, n := range names {
+		cmd := exec.Command("go", "build", "-o", filepath.Join(tb.dir, n), "./cmd/"+n)
+		cmd.Dir = "../.."
+		if out, err := cmd.CombinedOutput(); err != nil {
+			tb.t.Fatalf("build %s: %v\n%s", n, err, out)
+		}
+	}
+}
+
+func (tb *testbed) run(name string, args ...string) {
+	tb.t.Helper()
+	if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		tb.t.Fatalf("%s %s: %v\n%s", name, strings.Join(args, " "), err, out)
+	}
+}
+
+func (tb *testbed) ns(name string) string { return tb.prefix + "-" + name }
+
+// addNetns: 라우터처럼 동작하는 네임스페이스 (forwarding on, rp_filter off, lo up)
+func (tb *testbed) addNetns(name string) {
+	tb.t.Helper()
+	ns := tb.ns(name)
+	tb.run("ip", "netns", "add", ns)
+	tb.netns = append(tb.netns, ns)
+	tb.run("ip", "-n", ns, "link", "set", "lo", "up")
+	tb.run("ip", "netns", "exec", ns, "sysctl", "-qw",
+		"net.ipv4.ip_forward=1", "net.ipv4.conf.all.rp_filter=0", "net.ipv4.conf.default.rp_filter=0")
+}
+
+// link: a의 ifA(addrA)와 b의 ifB(addrB)를 veth로 잇는다. 주소는 CIDR.
+func (tb *testbed) link(a, ifA, addrA, b, ifB, addrB string) {
+	tb.t.Helper()
+	tb.run("ip", "link", "add", ifA, "netns", tb.ns(a), "type", "veth", "peer", "name", ifB, "netns", tb.ns(b))
+	for _, e := range [][3]string{{a, ifA, addrA}, {b, ifB, addrB}} {
+		tb.run("ip", "-n", tb.ns(e[0]), "addr", "add", e[2], "dev", e[1])
+		tb.run("ip", "-n", tb.ns(e[0]), "link", "set", e[1], "up")
+	}
+}
+
+func (tb *testbed) route(ns string, args ...string) {
+	tb.t.Helper()
+	tb.run("ip", append([]string{"-n", tb.ns(ns), "route", "add"}, args...)...)
+}
+
+// proc: 네임스페이스 안에서 도는 프로세스. stdout은 메모리에도 남긴다 (subscriber JSON).
+type proc struct {
+	name string
+	cmd  *exec.Cmd
+	log  string
+	out  syncBuffer
+	done chan struct{}
+}
+
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+// start: ns 안에서 tb.dir의 바이너리 bin을 띄운다. env는 현재 환경 뒤에 붙는다.
+func (tb *testbed) start(ns, name string, env []string, bin string, args ...string) *proc {
+	tb.t.Helper()
+	p := &proc{name: name, log: filepath.Join(tb.dir, name+".log"), done: make(chan struct{})}
+	f, err := os.Create(p.log)
+	if err != nil {
+		tb.t.Fatal(err)
+	}
+	p.cmd = exec.Command("ip", append([]string{"netns", "exec", tb.ns(ns), filepath.Join(tb.dir, bin)}, args...)...)
+	p.cmd.Env = append(os.Environ(), env...)
+	p.cmd.Stdout = io.MultiWriter(f, &p.out)
+	p.cmd.Stderr = f
+	if err := p.cmd.Start(); err != nil {
+		f.Close()
+		tb.t.Fatalf("start %s: %v", name, err)
+	}
+	tb.procs = append(tb.procs, p)
+	go func() {
+		p.cmd.Wait()
+		f.Close()
+		close(p.done)
+	}()
+	return p
+}
+
+// stop: SIGTERM, 2초 안에 끝나지 않으면 SIGKILL
+func (p *proc) stop() {
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	p.cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-p.done:
+	case <-time.After(2 * time.Second):
+		p.cmd.Process.Kill()
+		<-p.done
+	}
+}
+
+func (p *proc) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// close: 프로세스 역순 종료 → 네임스페이스 삭제(veth도 함께) → bpffs 해제. 실패하면 로그를 남긴다.
+func (tb *testbed) close() {
+	for i := len(tb.procs) - 1; i >= 0; i-- {
+		tb.procs[i].stop()
+	}
+	if tb.t.Failed() {
+		for _, p := range tb.procs {
+			if b, err := os.ReadFile(p.log); err == nil {
+				tb.t.Logf("--- %s ---\n%s", p.name, b)
+			}
+		}
+	}
+	for _, ns := range tb.netns {
+		exec.Command("ip", "netns", "del", ns).Run()
+	}
+	if tb.bpffs != "" {
+		unix.Unmount(tb.bpffs, unix.MNT_DETACH)
+	}
+}